@@ -0,0 +1,335 @@
+package addrselect
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/routes"
+)
+
+const (
+	scopeLinkLocal = 2
+	scopeSiteLocal = 5
+	scopeGlobal    = 14
+)
+
+// LocalAddr is an address assigned to a local interface.
+type LocalAddr struct {
+	Prefix     netip.Prefix `json:"prefix"`
+	Iface      string       `json:"iface"`
+	Deprecated bool         `json:"deprecated"`
+}
+
+// LocalAddrs lists the addresses of the up interfaces.
+// Deprecated IPv6 addresses are flagged on Linux only, see ifaces.Addresses.
+func LocalAddrs() ([]LocalAddr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	deprecated := deprecatedAddrs()
+	locals := make([]LocalAddr, 0)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			ones, _ := ipNet.Mask.Size()
+			locals = append(locals, LocalAddr{
+				Prefix:     netip.PrefixFrom(addr, ones),
+				Iface:      iface.Name,
+				Deprecated: deprecated[addr],
+			})
+		}
+	}
+	return locals, nil
+}
+
+func deprecatedAddrs() map[netip.Addr]bool {
+	found := make(map[netip.Addr]bool)
+	addrs, err := ifaces.Addresses()
+	if err != nil {
+		return found
+	}
+	for _, a := range addrs {
+		if a.HasFlag("deprecated") {
+			found[a.Prefix.Addr()] = true
+		}
+	}
+	return found
+}
+
+// Destination is one sorted address with the attributes the rules used.
+type Destination struct {
+	Addr       netip.Addr `json:"addr"`
+	Reachable  bool       `json:"reachable"`
+	Source     netip.Addr `json:"source"`
+	Scope      int        `json:"scope"`
+	Label      int        `json:"label"`
+	Precedence int        `json:"precedence"`
+	// rule that ranked it above the next destination, empty for the last one
+	Rule string `json:"rule,omitempty"`
+
+	source LocalAddr
+}
+
+func (d Destination) ToPortableJSON() string {
+	data, err := json.Marshal(d)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (d Destination) ToTableString() string {
+	src := "unreachable"
+	if d.Reachable {
+		src = d.Source.String()
+	}
+	return fmt.Sprintf("%s\tsrc %s\tscope %d\tlabel %d\tprecedence %d\t%s\n", d.Addr, src, d.Scope, d.Label, d.Precedence, d.Rule)
+}
+
+// Selector sorts destination addresses like getaddrinfo, RFC 6724 section 6.
+// Rules 4 (home addresses) and 7 (native transport) are not applied.
+type Selector struct {
+	Policy *Policy // nil is GlibcPolicy, RFC6724Policy for the RFC table
+	Locals []LocalAddr
+	// the route of a destination picks the interface of its source address,
+	// a family missing from the table is left to the kernel
+	Routes []routes.NetRoute
+	// ask the kernel for the source with a connected UDP socket,
+	// which sends nothing, when the route table has no answer
+	Kernel bool
+}
+
+// NewSystemSelector reads gai.conf, the local addresses and the route table.
+func NewSystemSelector() (*Selector, error) {
+	policy, err := ReadGaiConf(GAI_CONF_PATH)
+	if err != nil {
+		return nil, err
+	}
+	locals, err := LocalAddrs()
+	if err != nil {
+		return nil, err
+	}
+	// sorting still works from the kernel answers alone
+	table, _ := routes.Retrieve()
+	return &Selector{Policy: policy, Locals: locals, Routes: table, Kernel: true}, nil
+}
+
+// Sort orders addrs like getaddrinfo would on this host.
+func Sort(addrs []netip.Addr) ([]netip.Addr, error) {
+	s, err := NewSystemSelector()
+	if err != nil {
+		return nil, err
+	}
+	return s.Sort(addrs), nil
+}
+
+// Sort returns a sorted copy of addrs.
+func (s *Selector) Sort(addrs []netip.Addr) []netip.Addr {
+	ranked := s.Rank(addrs)
+	sorted := make([]netip.Addr, len(ranked))
+	for i, d := range ranked {
+		sorted[i] = d.Addr
+	}
+	return sorted
+}
+
+// Rank sorts addrs and tells for each destination why it comes first.
+func (s *Selector) Rank(addrs []netip.Addr) []Destination {
+	policy := s.Policy
+	if policy == nil {
+		policy = GlibcPolicy()
+	}
+	dests := make([]Destination, len(addrs))
+	for i, addr := range addrs {
+		addr = addr.Unmap()
+		d := Destination{
+			Addr:       addr,
+			Scope:      policy.Scope(addr),
+			Label:      policy.Label(addr),
+			Precedence: policy.Precedence(addr),
+		}
+		d.source, d.Reachable = s.sourceFor(policy, addr)
+		if d.Reachable {
+			d.Source = d.source.Prefix.Addr()
+		}
+		dests[i] = d
+	}
+	sort.SliceStable(dests, func(i, j int) bool {
+		less, _ := compare(policy, &dests[i], &dests[j])
+		return less
+	})
+	for i := 0; i+1 < len(dests); i++ {
+		_, dests[i].Rule = compare(policy, &dests[i], &dests[i+1])
+	}
+	return dests
+}
+
+// compare reports whether da goes before db and the deciding rule.
+func compare(p *Policy, da, db *Destination) (bool, string) {
+	// rule 1: avoid unusable destinations
+	if da.Reachable != db.Reachable {
+		return da.Reachable, "rule 1 reachable"
+	}
+	if da.Reachable {
+		sa, sb := da.source.Prefix.Addr(), db.source.Prefix.Addr()
+		// rule 2: prefer matching scope
+		ma, mb := da.Scope == p.Scope(sa), db.Scope == p.Scope(sb)
+		if ma != mb {
+			return ma, "rule 2 matching scope"
+		}
+		// rule 3: avoid deprecated addresses
+		if da.source.Deprecated != db.source.Deprecated {
+			return db.source.Deprecated, "rule 3 deprecated source"
+		}
+		// rule 5: prefer matching label
+		ma, mb = da.Label == p.Label(sa), db.Label == p.Label(sb)
+		if ma != mb {
+			return ma, "rule 5 matching label"
+		}
+	}
+	// rule 6: prefer higher precedence
+	if da.Precedence != db.Precedence {
+		return da.Precedence > db.Precedence, "rule 6 precedence"
+	}
+	// rule 8: prefer smaller scope
+	if da.Scope != db.Scope {
+		return da.Scope < db.Scope, "rule 8 smaller scope"
+	}
+	// rule 9: use longest matching prefix, glibc applies it to IPv4 too
+	if da.Reachable && db.Reachable && da.Addr.BitLen() == db.Addr.BitLen() {
+		ca, cb := commonPrefixLen(da.Addr, da.source), commonPrefixLen(db.Addr, db.source)
+		if ca != cb {
+			return ca > cb, "rule 9 longest prefix"
+		}
+	}
+	// rule 10: otherwise leave the order unchanged
+	return false, "rule 10 order"
+}
+
+// commonPrefixLen counts the leading bits dst shares with the source,
+// up to the prefix length of the source.
+func commonPrefixLen(dst netip.Addr, src LocalAddr) int {
+	a, b := dst.AsSlice(), src.Prefix.Addr().AsSlice()
+	if len(a) != len(b) {
+		return 0
+	}
+	n := 0
+	for i := range a {
+		x := a[i] ^ b[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+	if bits := src.Prefix.Bits(); n > bits {
+		n = bits
+	}
+	return n
+}
+
+// sourceFor picks the source address for dst, false when unreachable.
+func (s *Selector) sourceFor(p *Policy, dst netip.Addr) (LocalAddr, bool) {
+	for _, la := range s.Locals {
+		if la.Prefix.Addr() == dst {
+			return la, true
+		}
+	}
+	if dst.IsLoopback() {
+		return LocalAddr{Prefix: netip.PrefixFrom(dst, dst.BitLen())}, true
+	}
+	if s.hasFamily(dst) {
+		nr, err := routes.Lookup(s.Routes, dst)
+		if err != nil {
+			return LocalAddr{}, false
+		}
+		var best *LocalAddr
+		for i := range s.Locals {
+			la := &s.Locals[i]
+			if la.Iface != nr.NetIf || la.Prefix.Addr().BitLen() != dst.BitLen() {
+				continue
+			}
+			if best == nil || betterSource(p, dst, la, best) {
+				best = la
+			}
+		}
+		if best != nil {
+			return *best, true
+		}
+	}
+	if !s.Kernel {
+		return LocalAddr{}, false
+	}
+	return s.kernelSource(dst)
+}
+
+func (s *Selector) hasFamily(dst netip.Addr) bool {
+	for _, nr := range s.Routes {
+		if prefix, err := routes.ParseDestination(nr.Destination); err == nil && prefix.Addr().BitLen() == dst.BitLen() {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelSource connects a UDP socket to dst, as glibc does.
+func (s *Selector) kernelSource(dst netip.Addr) (LocalAddr, bool) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(dst, 9)))
+	if err != nil {
+		return LocalAddr{}, false
+	}
+	defer conn.Close()
+	src := conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap()
+	for _, la := range s.Locals {
+		if la.Prefix.Addr() == src {
+			return la, true
+		}
+	}
+	return LocalAddr{Prefix: netip.PrefixFrom(src, src.BitLen())}, true
+}
+
+// betterSource compares two candidate sources for dst, RFC 6724 section 5.
+func betterSource(p *Policy, dst netip.Addr, sa, sb *LocalAddr) bool {
+	a, b := sa.Prefix.Addr(), sb.Prefix.Addr()
+	// rule 2: prefer appropriate scope
+	if scA, scB, scD := p.Scope(a), p.Scope(b), p.Scope(dst); scA != scB {
+		if scA < scB {
+			return scA >= scD
+		}
+		return scB < scD
+	}
+	// rule 3: avoid deprecated addresses
+	if sa.Deprecated != sb.Deprecated {
+		return sb.Deprecated
+	}
+	// rule 6: prefer matching label
+	if la, lb, ld := p.Label(a), p.Label(b), p.Label(dst); (la == ld) != (lb == ld) {
+		return la == ld
+	}
+	// rule 8: use longest matching prefix
+	return commonPrefixLen(dst, *sa) > commonPrefixLen(dst, *sb)
+}
@@ -0,0 +1,84 @@
+package addrselect
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/kmahyyg/go-network-compo/routes"
+)
+
+// testSelector has an IPv4 address and the given IPv6 source on eth0,
+// with default routes for both families.
+func testSelector(policy *Policy, v6 string) *Selector {
+	s := &Selector{
+		Policy: policy,
+		Locals: []LocalAddr{{Prefix: netip.MustParsePrefix("192.0.2.10/24"), Iface: "eth0"}},
+		Routes: []routes.NetRoute{{Destination: "0.0.0.0/0", Gateway: "192.0.2.1", Flags: "U,G", NetIf: "eth0"}},
+	}
+	if v6 != "" {
+		s.Locals = append(s.Locals, LocalAddr{Prefix: netip.MustParsePrefix(v6), Iface: "eth0"})
+		s.Routes = append(s.Routes, routes.NetRoute{Destination: "::/0", Gateway: "fe80::1", Flags: "U,G", NetIf: "eth0"})
+	}
+	return s
+}
+
+func addrs(list ...string) []netip.Addr {
+	out := make([]netip.Addr, len(list))
+	for i, s := range list {
+		out[i] = netip.MustParseAddr(s)
+	}
+	return out
+}
+
+// orderings getaddrinfo gives on such a host without gai.conf
+func TestSortGlibcDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		v6   string // IPv6 source, "" for none
+		in   []netip.Addr
+		want []netip.Addr
+		rule string // deciding rule of the first destination
+	}{
+		{"ula before ipv4", "fd00:1::10/64",
+			addrs("198.51.100.1", "fd00:2::5"), addrs("fd00:2::5", "198.51.100.1"), "rule 6 precedence"},
+		{"global ipv6 before ipv4", "2001:db8::10/64",
+			addrs("198.51.100.1", "2001:db8:1::1"), addrs("2001:db8:1::1", "198.51.100.1"), "rule 6 precedence"},
+		{"ipv4 only host", "",
+			addrs("2001:db8:1::1", "198.51.100.1"), addrs("198.51.100.1", "2001:db8:1::1"), "rule 1 reachable"},
+		{"native before 6to4", "2001:db8::10/64",
+			addrs("2002:c000:204::1", "2001:db8:1::1"), addrs("2001:db8:1::1", "2002:c000:204::1"), "rule 5 matching label"},
+		{"teredo after ipv4", "2001:db8::10/64",
+			addrs("2001:0:4136:e378::1", "198.51.100.1"), addrs("198.51.100.1", "2001:0:4136:e378::1"), "rule 5 matching label"},
+		{"loopback", "",
+			addrs("127.0.0.1", "::1"), addrs("::1", "127.0.0.1"), "rule 6 precedence"},
+		{"longest prefix among ipv4", "",
+			addrs("198.51.100.1", "192.0.2.77"), addrs("192.0.2.77", "198.51.100.1"), "rule 9 longest prefix"},
+	}
+	for _, tt := range tests {
+		ranked := testSelector(nil, tt.v6).Rank(tt.in)
+		got := make([]netip.Addr, len(ranked))
+		for i, d := range ranked {
+			got[i] = d.Addr
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Sort = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		if ranked[0].Rule != tt.rule {
+			t.Errorf("%s: decided by %q, want %q", tt.name, ranked[0].Rule, tt.rule)
+		}
+	}
+}
+
+// the RFC 6724 table turns the ULA case around
+func TestSortRFC6724(t *testing.T) {
+	s := testSelector(RFC6724Policy(), "fd00:1::10/64")
+	if got, want := s.Sort(addrs("fd00:2::5", "198.51.100.1")), addrs("198.51.100.1", "fd00:2::5"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort = %v, want %v", got, want)
+	}
+	s = testSelector(RFC6724Policy(), "2001:db8::10/64")
+	if got, want := s.Sort(addrs("198.51.100.1", "2001:db8:1::1")), addrs("2001:db8:1::1", "198.51.100.1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package addrselect
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const GAI_CONF_PATH = "/etc/gai.conf"
+
+// PolicyEntry maps a prefix to a label, precedence or scope.
+type PolicyEntry struct {
+	Prefix netip.Prefix `json:"prefix"`
+	Value  int          `json:"value"`
+}
+
+// Policy is the RFC 6724 policy table, split into a label and a precedence
+// table the way glibc does. Labels and precedences are IPv6 prefixes,
+// IPv4 addresses are looked up as ::ffff:a.b.c.d. ScopesV4 overrides the
+// scope of IPv4 prefixes. Warnings lists the gai.conf lines that were
+// ignored.
+type Policy struct {
+	Labels      []PolicyEntry `json:"labels"`
+	Precedences []PolicyEntry `json:"precedences"`
+	ScopesV4    []PolicyEntry `json:"scopes_v4"`
+	Reload      bool          `json:"reload"`
+	Warnings    []string      `json:"warnings,omitempty"`
+}
+
+func (p *Policy) ToPortableJSON() string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// GlibcPolicy returns the table getaddrinfo uses without gai.conf. glibc
+// still ships the RFC 3484 defaults, which put ULA above IPv4 and give
+// IPv4 the lowest precedence.
+func GlibcPolicy() *Policy {
+	return &Policy{
+		Labels: []PolicyEntry{
+			{netip.MustParsePrefix("::1/128"), 0},
+			{netip.MustParsePrefix("2002::/16"), 2},
+			{netip.MustParsePrefix("::/96"), 3},
+			{netip.MustParsePrefix("::ffff:0:0/96"), 4},
+			{netip.MustParsePrefix("fec0::/10"), 5},
+			{netip.MustParsePrefix("fc00::/7"), 6},
+			{netip.MustParsePrefix("2001::/32"), 7},
+			{netip.MustParsePrefix("::/0"), 1},
+		},
+		Precedences: []PolicyEntry{
+			{netip.MustParsePrefix("::1/128"), 50},
+			{netip.MustParsePrefix("2002::/16"), 30},
+			{netip.MustParsePrefix("::/96"), 20},
+			{netip.MustParsePrefix("::ffff:0:0/96"), 10},
+			{netip.MustParsePrefix("::/0"), 40},
+		},
+		ScopesV4: defaultScopesV4(),
+	}
+}
+
+// RFC6724Policy returns the default policy table of RFC 6724 section 2.1,
+// which prefers IPv4 over ULA and Teredo.
+func RFC6724Policy() *Policy {
+	return &Policy{
+		Labels: []PolicyEntry{
+			{netip.MustParsePrefix("::1/128"), 0},
+			{netip.MustParsePrefix("::/0"), 1},
+			{netip.MustParsePrefix("::ffff:0:0/96"), 4},
+			{netip.MustParsePrefix("2002::/16"), 2},
+			{netip.MustParsePrefix("2001::/32"), 5},
+			{netip.MustParsePrefix("fc00::/7"), 13},
+			{netip.MustParsePrefix("::/96"), 3},
+			{netip.MustParsePrefix("fec0::/10"), 11},
+			{netip.MustParsePrefix("3ffe::/16"), 12},
+		},
+		Precedences: []PolicyEntry{
+			{netip.MustParsePrefix("::1/128"), 50},
+			{netip.MustParsePrefix("::/0"), 40},
+			{netip.MustParsePrefix("::ffff:0:0/96"), 35},
+			{netip.MustParsePrefix("2002::/16"), 30},
+			{netip.MustParsePrefix("2001::/32"), 5},
+			{netip.MustParsePrefix("fc00::/7"), 3},
+			{netip.MustParsePrefix("::/96"), 1},
+			{netip.MustParsePrefix("fec0::/10"), 1},
+			{netip.MustParsePrefix("3ffe::/16"), 1},
+		},
+		ScopesV4: defaultScopesV4(),
+	}
+}
+
+// link-local and loopback IPv4 are link scope, the rest global, RFC 6724 section 3.2
+func defaultScopesV4() []PolicyEntry {
+	return []PolicyEntry{
+		{netip.MustParsePrefix("169.254.0.0/16"), scopeLinkLocal},
+		{netip.MustParsePrefix("127.0.0.0/8"), scopeLinkLocal},
+		{netip.MustParsePrefix("0.0.0.0/0"), scopeGlobal},
+	}
+}
+
+// ReadGaiConf reads gai.conf, a missing file gives the glibc defaults.
+func ReadGaiConf(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return GlibcPolicy(), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return ParseGaiConf(f)
+}
+
+// ParseGaiConf applies gai.conf(5) on the glibc defaults. As in glibc a
+// single label or precedence line replaces the whole default table, and
+// scopev4 lines replace the default scopes, with everything else global.
+// Lines glibc cannot parse are skipped and listed in Warnings.
+func ParseGaiConf(r io.Reader) (*Policy, error) {
+	p := GlibcPolicy()
+	var labels, precedences, scopes []PolicyEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !parseGaiLine(p, fields, &labels, &precedences, &scopes) {
+			p.Warnings = append(p.Warnings, "line "+strconv.Itoa(n)+": ignored "+strings.Join(fields, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if labels != nil {
+		p.Labels = labels
+	}
+	if precedences != nil {
+		p.Precedences = precedences
+	}
+	if scopes != nil {
+		p.ScopesV4 = append(scopes, PolicyEntry{netip.MustParsePrefix("0.0.0.0/0"), scopeGlobal})
+	}
+	return p, nil
+}
+
+// parseGaiLine applies one line, false if it is malformed or unknown.
+func parseGaiLine(p *Policy, fields []string, labels, precedences, scopes *[]PolicyEntry) bool {
+	if fields[0] == "reload" {
+		if len(fields) != 2 {
+			return false
+		}
+		p.Reload = fields[1] == "yes" || fields[1] == "true"
+		return true
+	}
+	if len(fields) != 3 {
+		return false
+	}
+	value, err := strconv.Atoi(fields[2])
+	if err != nil || value < 0 {
+		return false
+	}
+	prefix, ok := parseMask(fields[1])
+	if !ok {
+		return false
+	}
+	switch fields[0] {
+	case "label", "precedence":
+		if prefix.Addr().Is4() {
+			prefix = netip.PrefixFrom(netip.AddrFrom16(prefix.Addr().As16()), prefix.Bits()+96)
+		}
+		if fields[0] == "label" {
+			*labels = append(*labels, PolicyEntry{prefix, value})
+		} else {
+			*precedences = append(*precedences, PolicyEntry{prefix, value})
+		}
+	case "scopev4":
+		addr := prefix.Addr()
+		if addr.Is4In6() {
+			if prefix.Bits() < 96 {
+				return false
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+		} else if !addr.Is4() {
+			return false
+		}
+		*scopes = append(*scopes, PolicyEntry{prefix.Masked(), value})
+	default:
+		return false
+	}
+	return true
+}
+
+// parseMask reads "addr/len", a bare address is a host prefix.
+func parseMask(s string) (netip.Prefix, bool) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix.Masked(), true
+}
+
+// lookup returns the value of the longest prefix containing addr.
+func lookup(table []PolicyEntry, addr netip.Addr) (int, bool) {
+	best, bits := 0, -1
+	for _, e := range table {
+		if e.Prefix.Bits() > bits && e.Prefix.Contains(addr) {
+			best, bits = e.Value, e.Prefix.Bits()
+		}
+	}
+	return best, bits >= 0
+}
+
+// Label returns the label of addr, IPv4 as mapped IPv6.
+func (p *Policy) Label(addr netip.Addr) int {
+	v, _ := lookup(p.Labels, netip.AddrFrom16(addr.As16()))
+	return v
+}
+
+// Precedence returns the precedence of addr, IPv4 as mapped IPv6.
+func (p *Policy) Precedence(addr netip.Addr) int {
+	v, _ := lookup(p.Precedences, netip.AddrFrom16(addr.As16()))
+	return v
+}
+
+// Scope returns the RFC 4007 scope of addr: 1 interface, 2 link, 5 site,
+// 8 organization, 14 global.
+func (p *Policy) Scope(addr netip.Addr) int {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		if v, ok := lookup(p.ScopesV4, addr); ok {
+			return v
+		}
+		return scopeGlobal
+	}
+	switch {
+	case addr.IsMulticast():
+		return int(addr.As16()[1] & 0x0f)
+	case addr.IsLoopback(), addr.IsLinkLocalUnicast():
+		return scopeLinkLocal
+	case netip.MustParsePrefix("fec0::/10").Contains(addr):
+		return scopeSiteLocal
+	}
+	return scopeGlobal
+}
@@ -0,0 +1,91 @@
+package addrselect
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlibcPolicyValues(t *testing.T) {
+	p := GlibcPolicy()
+	tests := []struct {
+		addr       string
+		label      int
+		precedence int
+	}{
+		{"::1", 0, 50},
+		{"2001:db8::1", 1, 40},
+		{"2002:c000:204::1", 2, 30},
+		{"::c000:204", 3, 20},
+		{"192.0.2.4", 4, 10},
+		{"fec0::1", 5, 40},
+		{"fd00::1", 6, 40},
+		{"2001:0:4136:e378::1", 7, 40},
+	}
+	for _, tt := range tests {
+		addr := netip.MustParseAddr(tt.addr)
+		if l, pr := p.Label(addr), p.Precedence(addr); l != tt.label || pr != tt.precedence {
+			t.Errorf("%s: label %d precedence %d, want %d %d", tt.addr, l, pr, tt.label, tt.precedence)
+		}
+	}
+}
+
+func TestParseGaiConf(t *testing.T) {
+	conf := `# prefer IPv4, the usual reason for a gai.conf
+precedence ::ffff:0:0/96 100
+precedence ::/0 40
+label 10.0.0.0/8 20
+scopev4 ::ffff:10.0.0.0/104 5
+reload yes
+bogus line here
+precedence ::/0
+precedence not-an-address 10
+scopev4 2001:db8::/32 5
+`
+	p, err := ParseGaiConf(strings.NewReader(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPrec := []PolicyEntry{
+		{netip.MustParsePrefix("::ffff:0:0/96"), 100},
+		{netip.MustParsePrefix("::/0"), 40},
+	}
+	if !reflect.DeepEqual(p.Precedences, wantPrec) {
+		t.Errorf("precedences %v, want %v", p.Precedences, wantPrec)
+	}
+	// one label line replaces the whole default label table
+	wantLabels := []PolicyEntry{{netip.MustParsePrefix("::ffff:10.0.0.0/104"), 20}}
+	if !reflect.DeepEqual(p.Labels, wantLabels) {
+		t.Errorf("labels %v, want %v", p.Labels, wantLabels)
+	}
+	if s := p.Scope(netip.MustParseAddr("10.1.2.3")); s != 5 {
+		t.Errorf("scope of 10.1.2.3 = %d, want 5", s)
+	}
+	// scopev4 lines replace the defaults, 127/8 is global now
+	if s := p.Scope(netip.MustParseAddr("127.0.0.1")); s != scopeGlobal {
+		t.Errorf("scope of 127.0.0.1 = %d, want %d", s, scopeGlobal)
+	}
+	if !p.Reload {
+		t.Error("reload not set")
+	}
+	// glibc skips what it cannot parse
+	if len(p.Warnings) != 4 || !strings.HasPrefix(p.Warnings[0], "line 7:") {
+		t.Errorf("warnings %q, want the 4 bad lines", p.Warnings)
+	}
+
+	s := testSelector(p, "2001:db8::10/64")
+	if got, want := s.Sort(addrs("2001:db8:1::1", "198.51.100.1")), addrs("198.51.100.1", "2001:db8:1::1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sort with IPv4 preferred = %v, want %v", got, want)
+	}
+}
+
+func TestParseGaiConfEmpty(t *testing.T) {
+	p, err := ParseGaiConf(strings.NewReader("# nothing\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := GlibcPolicy(); !reflect.DeepEqual(p, want) {
+		t.Errorf("empty gai.conf = %v, want the glibc defaults", p)
+	}
+}
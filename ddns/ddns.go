@@ -0,0 +1,350 @@
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+const (
+	DefaultTTL          = 300
+	DefaultMinInterval  = 30 * time.Second
+	DefaultRetry        = 5 * time.Second
+	DefaultMaxRetry     = 5 * time.Minute
+	DefaultPollInterval = 30 * time.Second
+	DefaultTimeout      = 10 * time.Second
+)
+
+var ErrNoAddress = errors.New("no address to register")
+
+// Config is what and where to register, zero durations take the defaults.
+type Config struct {
+	Server netip.AddrPort     // authoritative server accepting updates
+	Zone   string             // "lab.example."
+	Name   string             // "host1.lab.example."
+	TTL    uint32             // of the registered records
+	Key    *dnsclient.TSIGKey // nil sends unsigned updates
+	Iface  string             // register the global addresses of this interface, "" the default route source
+	IPv4   bool               // manage the A RRset
+	IPv6   bool               // manage the AAAA RRset
+
+	MinInterval  time.Duration // rate limit between two updates
+	Retry        time.Duration // first retry delay after a failure, doubled up to MaxRetry
+	MaxRetry     time.Duration
+	PollInterval time.Duration // address check without change notification
+	Timeout      time.Duration // per update
+}
+
+// Result reports one update attempt.
+type Result struct {
+	Time  time.Time    `json:"time"`
+	Addrs []netip.Addr `json:"addrs"`
+	Err   error        `json:"-"`
+	Error string       `json:"error,omitempty"`
+}
+
+func (r Result) ToPortableJSON() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Updater keeps Name pointing at the current addresses of the host.
+type Updater struct {
+	Results <-chan Result
+
+	cfg     Config
+	results chan Result
+	trigger chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// addrs is CurrentAddrs, tests replace it
+	addrs func() ([]netip.Addr, error)
+
+	mu         sync.Mutex
+	registered []netip.Addr
+	lastUpdate time.Time
+}
+
+// New checks cfg and fills in the defaults, Start runs the updater.
+func New(cfg Config) (*Updater, error) {
+	if !cfg.Server.IsValid() || cfg.Zone == "" || cfg.Name == "" {
+		return nil, errors.New("ddns needs server, zone and name")
+	}
+	if !cfg.IPv4 && !cfg.IPv6 {
+		cfg.IPv4 = true
+	}
+	cfg.Zone, cfg.Name = dnsclient.Fqdn(cfg.Zone), dnsclient.Fqdn(cfg.Name)
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = DefaultMinInterval
+	}
+	if cfg.Retry <= 0 {
+		cfg.Retry = DefaultRetry
+	}
+	if cfg.MaxRetry < cfg.Retry {
+		cfg.MaxRetry = DefaultMaxRetry
+		if cfg.MaxRetry < cfg.Retry {
+			cfg.MaxRetry = cfg.Retry
+		}
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	results := make(chan Result, 16)
+	u := &Updater{
+		Results: results,
+		cfg:     cfg,
+		results: results,
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	u.addrs = u.CurrentAddrs
+	return u, nil
+}
+
+// Registered returns the addresses of the last successful update.
+func (u *Updater) Registered() []netip.Addr {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]netip.Addr{}, u.registered...)
+}
+
+// Trigger asks for an address check now, e.g. after a known network change.
+func (u *Updater) Trigger() {
+	select {
+	case u.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Start watches address changes in the background.
+func (u *Updater) Start() error {
+	wake, stop, err := watchAddrs()
+	if err != nil {
+		return err
+	}
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		defer stop()
+		u.run(wake)
+	}()
+	return nil
+}
+
+// Close stops the updater, the records stay registered.
+func (u *Updater) Close() error {
+	select {
+	case <-u.done:
+		return nil
+	default:
+	}
+	close(u.done)
+	u.wg.Wait()
+	return nil
+}
+
+func (u *Updater) run(wake <-chan struct{}) {
+	poll := time.NewTicker(u.cfg.PollInterval)
+	defer poll.Stop()
+	retry := u.cfg.Retry
+	// timer for rate limiting and retries, fires at once for the first check
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	pending := true
+	for {
+		select {
+		case <-u.done:
+			return
+		case <-wake:
+		case <-u.trigger:
+		case <-poll.C:
+		case <-timer.C:
+			pending = false
+			addrs, err := u.addrs()
+			if err == nil && u.upToDate(addrs) {
+				retry = u.cfg.Retry
+				continue
+			}
+			if err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), u.cfg.Timeout)
+				err = u.Update(ctx, addrs)
+				cancel()
+			}
+			u.report(Result{Time: time.Now(), Addrs: addrs, Err: err})
+			if err != nil {
+				// retry with backoff even without another change
+				pending = true
+				timer.Reset(retry)
+				if retry *= 2; retry > u.cfg.MaxRetry {
+					retry = u.cfg.MaxRetry
+				}
+			} else {
+				retry = u.cfg.Retry
+			}
+			continue
+		}
+		if pending {
+			continue
+		}
+		// rate limit: wait until MinInterval after the last update
+		pending = true
+		u.mu.Lock()
+		wait := time.Until(u.lastUpdate.Add(u.cfg.MinInterval))
+		u.mu.Unlock()
+		if wait < 0 {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+func (u *Updater) upToDate(addrs []netip.Addr) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.registered != nil && reflect.DeepEqual(u.registered, addrs)
+}
+
+func (u *Updater) report(r Result) {
+	if r.Err != nil {
+		r.Error = r.Err.Error()
+	}
+	select {
+	case u.results <- r:
+	default:
+		// nobody listens, drop it
+	}
+}
+
+// Update replaces the managed RRsets of Name with addrs right away.
+func (u *Updater) Update(ctx context.Context, addrs []netip.Addr) error {
+	if len(addrs) == 0 {
+		return ErrNoAddress
+	}
+	msg := dnsclient.NewUpdate(u.cfg.Zone)
+	if u.cfg.IPv4 {
+		msg.DeleteRRset(u.cfg.Name, dnsclient.TypeA)
+	}
+	if u.cfg.IPv6 {
+		msg.DeleteRRset(u.cfg.Name, dnsclient.TypeAAAA)
+	}
+	for _, addr := range addrs {
+		rr := dnsclient.Resource{Name: u.cfg.Name, TTL: u.cfg.TTL}
+		switch {
+		case addr.Is4() && u.cfg.IPv4:
+			rr.Type, rr.Data = dnsclient.TypeA, &dnsclient.A{Addr: addr}
+		case addr.Is6() && u.cfg.IPv6:
+			rr.Type, rr.Data = dnsclient.TypeAAAA, &dnsclient.AAAA{Addr: addr}
+		default:
+			continue
+		}
+		msg.Add(rr)
+	}
+	var (
+		resp *dnsclient.Message
+		err  error
+	)
+	if u.cfg.Key != nil {
+		resp, err = dnsclient.ExchangeSigned(ctx, u.cfg.Server, msg, u.cfg.Key)
+	} else {
+		resp, err = (&dnsclient.Plain{Addr: u.cfg.Server}).Exchange(ctx, msg)
+	}
+	if err != nil {
+		return err
+	}
+	if resp.RCode != dnsclient.RCodeSuccess {
+		return fmt.Errorf("dns update of %s refused: %s", u.cfg.Name, resp.RCode)
+	}
+	u.mu.Lock()
+	u.registered = append([]netip.Addr{}, addrs...)
+	u.lastUpdate = time.Now()
+	u.mu.Unlock()
+	return nil
+}
+
+// CurrentAddrs returns the addresses to register, sorted: the global
+// unicast addresses of Iface, or the source addresses of the default routes.
+func (u *Updater) CurrentAddrs() ([]netip.Addr, error) {
+	addrs := make([]netip.Addr, 0)
+	if u.cfg.Iface != "" {
+		iface, err := net.InterfaceByName(u.cfg.Iface)
+		if err != nil {
+			return nil, err
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range ifAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			if u.wanted(addr) && addr.IsGlobalUnicast() {
+				addrs = append(addrs, addr)
+			}
+		}
+	} else {
+		if u.cfg.IPv4 {
+			if addr, err := RouteSource("udp4"); err == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+		if u.cfg.IPv6 {
+			if addr, err := RouteSource("udp6"); err == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoAddress
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+	return addrs, nil
+}
+
+func (u *Updater) wanted(addr netip.Addr) bool {
+	return (addr.Is4() && u.cfg.IPv4) || (addr.Is6() && u.cfg.IPv6)
+}
+
+// RouteSource returns the source address the kernel picks for the default
+// route of network "udp4" or "udp6". Connecting a UDP socket sends nothing.
+func RouteSource(network string) (netip.Addr, error) {
+	target := "192.0.2.1:9" // TEST-NET-1
+	if network == "udp6" {
+		target = "[2001:db8::1]:9"
+	}
+	conn, err := net.Dial(network, target)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	ap, err := netip.ParseAddrPort(conn.LocalAddr().String())
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return ap.Addr().Unmap(), nil
+}
@@ -0,0 +1,231 @@
+package ddns
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+	"github.com/kmahyyg/go-network-compo/internal/dnstest"
+)
+
+var testKey = &dnsclient.TSIGKey{Name: "ddns-key.", Secret: []byte("0123456789abcdef0123456789abcdef")}
+
+// stubServer is a stand-in authoritative server checking the TSIG of each
+// update and answering with the next of rcodes, the last one repeats.
+type stubServer struct {
+	mu     sync.Mutex
+	rcodes []dnsclient.RCode
+	reqs   []*dnsclient.Message
+	times  []time.Time
+	errs   []error // TSIG verification of each request
+}
+
+func (s *stubServer) handle(b []byte) []byte {
+	req := new(dnsclient.Message)
+	if err := req.Unpack(b); err != nil || len(req.Additionals) == 0 {
+		return nil
+	}
+	tsig, _ := req.Additionals[len(req.Additionals)-1].Data.(*dnsclient.TSIG)
+	s.mu.Lock()
+	s.reqs = append(s.reqs, req)
+	s.times = append(s.times, time.Now())
+	s.errs = append(s.errs, testKey.Verify(b, nil, time.Now()))
+	rcode := s.rcodes[0]
+	if len(s.rcodes) > 1 {
+		s.rcodes = s.rcodes[1:]
+	}
+	s.mu.Unlock()
+	if tsig == nil {
+		return nil
+	}
+	resp := &dnsclient.Message{
+		Header:    dnsclient.Header{ID: req.ID, Response: true, Opcode: dnsclient.OpcodeUpdate, RCode: rcode},
+		Questions: req.Questions,
+	}
+	out, _, err := testKey.Sign(resp, tsig.MAC, time.Now())
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func (s *stubServer) start(t *testing.T, rcodes ...dnsclient.RCode) netip.AddrPort {
+	s.rcodes = rcodes
+	return (&dnstest.Server{UDP: s.handle}).Start(t)
+}
+
+func (s *stubServer) requests() ([]*dnsclient.Message, []time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*dnsclient.Message{}, s.reqs...), append([]time.Time{}, s.times...)
+}
+
+func newUpdater(t *testing.T, cfg Config) *Updater {
+	t.Helper()
+	cfg.Zone, cfg.Name, cfg.Key = "lab.example", "host1.lab.example", testKey
+	u, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// run starts the update loop without change notifications.
+func run(t *testing.T, u *Updater, addrs func() ([]netip.Addr, error)) {
+	u.addrs = addrs
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		u.run(nil)
+	}()
+	t.Cleanup(func() { u.Close() })
+}
+
+func TestUpdateMessage(t *testing.T) {
+	srv := &stubServer{}
+	u := newUpdater(t, Config{Server: srv.start(t, dnsclient.RCodeSuccess), IPv4: true, IPv6: true, TTL: 60})
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.7"), netip.MustParseAddr("2001:db8::7")}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := u.Update(ctx, addrs); err != nil {
+		t.Fatal(err)
+	}
+	reqs, _ := srv.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("%d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.Opcode != dnsclient.OpcodeUpdate || len(req.Answers) != 0 {
+		t.Errorf("opcode %v prerequisites %v", req.Opcode, req.Answers)
+	}
+	zone := []dnsclient.Question{{Name: "lab.example.", Type: dnsclient.TypeSOA, Class: dnsclient.ClassINET}}
+	if !reflect.DeepEqual(req.Questions, zone) {
+		t.Errorf("zone section %v, want %v", req.Questions, zone)
+	}
+	// the managed RRsets are deleted, then the current addresses added
+	want := []struct {
+		typ   dnsclient.Type
+		class dnsclient.Class
+		ttl   uint32
+		data  string
+	}{
+		{dnsclient.TypeA, dnsclient.ClassANY, 0, ""},
+		{dnsclient.TypeAAAA, dnsclient.ClassANY, 0, ""},
+		{dnsclient.TypeA, dnsclient.ClassINET, 60, "192.0.2.7"},
+		{dnsclient.TypeAAAA, dnsclient.ClassINET, 60, "2001:db8::7"},
+	}
+	if len(req.Authorities) != len(want) {
+		t.Fatalf("update section %v", req.Authorities)
+	}
+	for i, w := range want {
+		rr := req.Authorities[i]
+		data := ""
+		if rr.Data != nil {
+			data = rr.Data.String()
+		}
+		if rr.Name != "host1.lab.example." || rr.Type != w.typ || rr.Class != w.class || rr.TTL != w.ttl || data != w.data {
+			t.Errorf("update %d = %v", i, rr)
+		}
+	}
+	srv.mu.Lock()
+	if err := srv.errs[0]; err != nil {
+		t.Errorf("request TSIG: %v", err)
+	}
+	srv.mu.Unlock()
+	if got := u.Registered(); !reflect.DeepEqual(got, addrs) {
+		t.Errorf("Registered = %v, want %v", got, addrs)
+	}
+
+	// an IPv4 only updater leaves the AAAA RRset alone
+	u4 := newUpdater(t, Config{Server: u.cfg.Server, IPv4: true})
+	if err := u4.Update(ctx, addrs); err != nil {
+		t.Fatal(err)
+	}
+	reqs, _ = srv.requests()
+	for _, rr := range reqs[1].Authorities {
+		if rr.Type != dnsclient.TypeA {
+			t.Errorf("IPv4 only update touches %v", rr)
+		}
+	}
+}
+
+func TestUpdateRetryBackoff(t *testing.T) {
+	srv := &stubServer{}
+	addr := srv.start(t, dnsclient.RCodeRefused, dnsclient.RCodeRefused, dnsclient.RCodeRefused,
+		dnsclient.RCodeRefused, dnsclient.RCodeRefused, dnsclient.RCodeSuccess)
+	u := newUpdater(t, Config{Server: addr, Retry: 50 * time.Millisecond, MaxRetry: 200 * time.Millisecond})
+	addrs := []netip.Addr{netip.MustParseAddr("192.0.2.7")}
+	run(t, u, func() ([]netip.Addr, error) { return addrs, nil })
+
+	for i := 0; i < 5; i++ {
+		select {
+		case r := <-u.Results:
+			if r.Err == nil {
+				t.Fatalf("result %d succeeded against a refusing server", i)
+			}
+			if got := u.Registered(); len(got) != 0 {
+				t.Errorf("registered %v after a refused update", got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no result %d", i)
+		}
+	}
+	select {
+	case r := <-u.Results:
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no retry after the last refusal")
+	}
+	if got := u.Registered(); !reflect.DeepEqual(got, addrs) {
+		t.Errorf("Registered = %v, want %v", got, addrs)
+	}
+
+	// 50, 100, 200 and then capped at MaxRetry
+	_, times := srv.requests()
+	for i, want := range []time.Duration{50, 100, 200, 200, 200} {
+		want *= time.Millisecond
+		if gap := times[i+1].Sub(times[i]); gap < want-10*time.Millisecond || gap > want+150*time.Millisecond {
+			t.Errorf("retry %d after %s, want %s", i+1, gap, want)
+		}
+	}
+}
+
+func TestTriggerCoalesced(t *testing.T) {
+	srv := &stubServer{}
+	u := newUpdater(t, Config{Server: srv.start(t, dnsclient.RCodeSuccess), MinInterval: 300 * time.Millisecond})
+	var mu sync.Mutex
+	n := 0
+	// a new address on every check, so each one needs an update
+	run(t, u, func() ([]netip.Addr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return []netip.Addr{netip.AddrFrom4([4]byte{192, 0, 2, byte(n)})}, nil
+	})
+	select {
+	case <-u.Results:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no first update")
+	}
+	for i := 0; i < 5; i++ {
+		u.Trigger()
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(600 * time.Millisecond)
+	_, times := srv.requests()
+	if len(times) != 2 {
+		t.Fatalf("%d updates, want the triggers coalesced into one", len(times))
+	}
+	if gap := times[1].Sub(times[0]); gap < 290*time.Millisecond {
+		t.Errorf("second update after %s, want MinInterval", gap)
+	}
+	if got := u.Registered(); len(got) != 1 || got[0] != netip.MustParseAddr("192.0.2.2") {
+		t.Errorf("Registered = %v", got)
+	}
+}
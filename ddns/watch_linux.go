@@ -0,0 +1,36 @@
+//go:build linux
+
+package ddns
+
+import (
+	"errors"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// address and route changes, the default route source follows both
+const rtnlGroups = unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR | unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE
+
+// watchAddrs subscribes to rtnetlink notifications, every message wakes
+// the updater which then compares the addresses itself.
+func watchAddrs() (<-chan struct{}, func(), error) {
+	conn, err := rtnl.Listen(rtnlGroups)
+	if err != nil {
+		return nil, nil, err
+	}
+	wake := make(chan struct{}, 1)
+	go func() {
+		for {
+			// ENOBUFS on overflow is a change too
+			if _, err := conn.Receive(); err != nil && !errors.Is(err, unix.ENOBUFS) {
+				return
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return wake, func() { conn.Close() }, nil
+}
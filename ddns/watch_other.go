@@ -0,0 +1,8 @@
+//go:build !linux
+
+package ddns
+
+// watchAddrs has no change notification here, the updater polls.
+func watchAddrs() (<-chan struct{}, func(), error) {
+	return nil, func() {}, nil
+}
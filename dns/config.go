@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+)
+
+// Config is the structured counterpart of Retrieve.
+type Config struct {
+	ResolvConf *ResolvConf      `json:"resolv_conf"`
+	Resolved   *ResolvedSetting `json:"systemd_resolved,omitempty"` // nil if systemd-resolved is not running
+	Scoped     []ScopedResolver `json:"scoped,omitempty"`           // Mac OS only
+	NRPT       []NRPTRule       `json:"nrpt,omitempty"`             // Windows only
+}
+
+// ResolvedSetting is what systemd-resolved reports over D-Bus.
+// IfIndex 0 means the global setting.
+type ResolvedSetting struct {
+	Servers []ResolvedServer `json:"servers"`
+	Domains []ResolvedDomain `json:"domains"`
+	Links   []ResolvedLink   `json:"links"`
+}
+
+type ResolvedServer struct {
+	IfIndex int        `json:"ifindex"`
+	Addr    netip.Addr `json:"addr"`
+}
+
+type ResolvedDomain struct {
+	IfIndex     int    `json:"ifindex"`
+	Domain      string `json:"domain"`
+	RoutingOnly bool   `json:"routing_only"` // "~corp.example" style
+}
+
+type ResolvedLink struct {
+	Index        int              `json:"index"`
+	Name         string           `json:"name"`
+	Servers      []netip.Addr     `json:"servers"`
+	Domains      []ResolvedDomain `json:"domains"`
+	DefaultRoute bool             `json:"default_route"`
+}
+
+func (c *Config) Equal(other *Config) bool {
+	return reflect.DeepEqual(c, other)
+}
+
+func (c *Config) ToPortableJSON() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Nameservers returns every server of the config without duplicates,
+// systemd-resolved upstreams first since resolv.conf then points at the stub.
+func (c *Config) Nameservers() []netip.Addr {
+	seen := make(map[netip.Addr]bool)
+	list := make([]netip.Addr, 0)
+	add := func(addr netip.Addr) {
+		if !seen[addr] {
+			seen[addr] = true
+			list = append(list, addr)
+		}
+	}
+	if c.Resolved != nil {
+		for _, srv := range c.Resolved.Servers {
+			add(srv.Addr)
+		}
+	}
+	if c.ResolvConf != nil {
+		for _, addr := range c.ResolvConf.Nameservers {
+			// skip the resolved stub if its upstreams are known
+			if c.Resolved != nil && len(c.Resolved.Servers) != 0 && isResolvedStub(addr) {
+				continue
+			}
+			add(addr)
+		}
+	}
+	return list
+}
+
+func isResolvedStub(addr netip.Addr) bool {
+	return addr == netip.AddrFrom4([4]byte{127, 0, 0, 53}) || addr == netip.AddrFrom4([4]byte{127, 0, 0, 54})
+}
@@ -0,0 +1,13 @@
+//go:build dragonfly || freebsd || netbsd || openbsd
+
+package dns
+
+// systemd-resolved is linux only
+func retrieveResolved() *ResolvedSetting {
+	return nil
+}
+
+// scoped resolvers are mac os only
+func retrieveScoped() []ScopedResolver {
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build darwin
+
+package dns
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// systemd-resolved is linux only
+func retrieveResolved() *ResolvedSetting {
+	return nil
+}
+
+// retrieveScoped asks configd with `scutil --dns` and adds the
+// /etc/resolver files it does not list, nil if neither is available.
+func retrieveScoped() []ScopedResolver {
+	resolvers := make([]ScopedResolver, 0)
+	if out, err := exec.Command("/usr/sbin/scutil", "--dns").Output(); err == nil {
+		if parsed, err := ParseScutilDNS(bytes.NewReader(out)); err == nil {
+			resolvers = parsed
+		}
+	}
+	if files, err := ReadResolverDir(RESOLVER_DIR_PATH); err == nil {
+		resolvers = MergeResolverFiles(resolvers, files)
+	}
+	if len(resolvers) == 0 {
+		return nil
+	}
+	return resolvers
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package dns
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+// retrieveResolved returns nil when there is no system bus or no systemd-resolved.
+func retrieveResolved() *ResolvedSetting {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	rs, err := readResolved(conn)
+	if err != nil {
+		return nil
+	}
+	return rs
+}
+
+// scoped resolvers are mac os only
+func retrieveScoped() []ScopedResolver {
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build linux || dragonfly || freebsd || netbsd || openbsd || darwin
+
+package dns
+
+// RetrieveConfig returns the structured DNS configuration:
+// /etc/resolv.conf plus systemd-resolved state or the Mac OS scoped
+// resolvers where available.
+func RetrieveConfig() (*Config, error) {
+	rc, err := ReadResolvConf(RESOLV_CONF_PATH)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{ResolvConf: rc}
+	cfg.Resolved = retrieveResolved()
+	cfg.Scoped = retrieveScoped()
+	return cfg, nil
+}
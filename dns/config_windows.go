@@ -0,0 +1,31 @@
+//go:build windows
+
+package dns
+
+import (
+	"net/netip"
+
+	"github.com/kmahyyg/go-network-compo/wintypes"
+)
+
+// RetrieveConfig builds a resolv.conf equivalent from the system server list,
+// options stay at the libc defaults. The NRPT rules are added when readable.
+func RetrieveConfig() (*Config, error) {
+	data, err := wintypes.DnsQueryConfig_DNSServerList()
+	if err != nil {
+		return nil, err
+	}
+	rc := NewResolvConf()
+	for _, v := range data {
+		addr, ok := netip.AddrFromSlice(v)
+		if !ok {
+			continue
+		}
+		rc.Nameservers = append(rc.Nameservers, addr.Unmap())
+	}
+	cfg := &Config{ResolvConf: rc}
+	if rules, err := ReadNRPT(); err == nil && len(rules) != 0 {
+		cfg.NRPT = rules
+	}
+	return cfg, nil
+}
@@ -0,0 +1,39 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// NRPT registry locations, rules of a group policy replace the local ones.
+const (
+	NRPT_LOCAL_KEY_PATH  = `SYSTEM\CurrentControlSet\Services\Dnscache\Parameters\DnsPolicyConfig`
+	NRPT_POLICY_KEY_PATH = `SOFTWARE\Policies\Microsoft\Windows NT\DNSClient\DnsPolicyConfig`
+
+	// ConfigOptions bit telling GenericDNSServers is in use
+	NRPTOptionGenericServers = 0x8
+)
+
+// NRPTRule is one rule of the Windows Name Resolution Policy Table.
+// Namespaces starting with a dot are suffixes, others are FQDNs.
+type NRPTRule struct {
+	Key           string       `json:"key"`
+	Namespaces    []string     `json:"namespaces"`
+	Servers       []netip.Addr `json:"servers"`
+	ConfigOptions uint32       `json:"config_options"`
+	Comment       string       `json:"comment,omitempty"`
+	Policy        bool         `json:"policy"` // from group policy
+}
+
+// ParseNRPTServers splits the GenericDNSServers value, "10.0.0.1;10.0.0.2".
+func ParseNRPTServers(value string) []netip.Addr {
+	servers := make([]netip.Addr, 0)
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	}) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			servers = append(servers, addr)
+		}
+	}
+	return servers
+}
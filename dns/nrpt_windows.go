@@ -0,0 +1,67 @@
+//go:build windows
+
+package dns
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// ReadNRPT reads the NRPT rules from the registry, the group policy ones
+// if any exist, the local ones otherwise.
+func ReadNRPT() ([]NRPTRule, error) {
+	rules, err := readNRPTKey(NRPT_POLICY_KEY_PATH, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) != 0 {
+		return rules, nil
+	}
+	return readNRPTKey(NRPT_LOCAL_KEY_PATH, false)
+}
+
+func readNRPTKey(path string, policy bool) ([]NRPTRule, error) {
+	rules := make([]NRPTRule, 0)
+	root, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS|registry.QUERY_VALUE)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return rules, nil
+		}
+		return nil, err
+	}
+	defer root.Close()
+	names, err := root.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		rule, err := func() (*NRPTRule, error) {
+			key, err := registry.OpenKey(root, name, registry.QUERY_VALUE)
+			if err != nil {
+				return nil, err
+			}
+			defer key.Close()
+			rule := &NRPTRule{Key: name, Policy: policy, Servers: ParseNRPTServers("")}
+			// Name is REG_MULTI_SZ, some tools write REG_SZ
+			if ns, _, err := key.GetStringsValue("Name"); err == nil {
+				rule.Namespaces = ns
+			} else if ns, _, err := key.GetStringValue("Name"); err == nil {
+				rule.Namespaces = []string{ns}
+			}
+			if opts, _, err := key.GetIntegerValue("ConfigOptions"); err == nil {
+				rule.ConfigOptions = uint32(opts)
+			}
+			if rule.ConfigOptions&NRPTOptionGenericServers != 0 {
+				if servers, _, err := key.GetStringValue("GenericDNSServers"); err == nil {
+					rule.Servers = ParseNRPTServers(servers)
+				}
+			}
+			rule.Comment, _, _ = key.GetStringValue("Comment")
+			return rule, nil
+		}()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,184 @@
+package dns
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	RESOLV_CONF_PATH = "/etc/resolv.conf"
+
+	// defaults from resolv.conf(5)
+	defaultNdots    = 1
+	defaultTimeout  = 5
+	defaultAttempts = 2
+	maxNdots        = 15
+	maxTimeout      = 30
+	maxAttempts     = 5
+)
+
+// ResolvConf is the structured form of a resolv.conf file.
+type ResolvConf struct {
+	Nameservers []netip.Addr `json:"nameservers"`
+	Domain      string       `json:"domain,omitempty"`
+	Search      []string     `json:"search,omitempty"`
+	Sortlist    []string     `json:"sortlist,omitempty"`
+	Options     ResolvOpts   `json:"options"`
+}
+
+// ResolvOpts holds the "options" line, unknown options are kept verbatim.
+type ResolvOpts struct {
+	Ndots         int      `json:"ndots"`
+	Timeout       int      `json:"timeout"`  // seconds
+	Attempts      int      `json:"attempts"` // per nameserver
+	Rotate        bool     `json:"rotate"`
+	EDNS0         bool     `json:"edns0"`
+	TrustAD       bool     `json:"trust_ad"`
+	UseVC         bool     `json:"use_vc"`
+	SingleRequest bool     `json:"single_request"`
+	NoAAAA        bool     `json:"no_aaaa"`
+	NoTLDQuery    bool     `json:"no_tld_query"` // glibc: no single label as-is after the search list
+	Unknown       []string `json:"unknown,omitempty"`
+}
+
+// NewResolvConf returns an empty config carrying the libc defaults.
+func NewResolvConf() *ResolvConf {
+	return &ResolvConf{
+		Nameservers: make([]netip.Addr, 0),
+		Options: ResolvOpts{
+			Ndots:    defaultNdots,
+			Timeout:  defaultTimeout,
+			Attempts: defaultAttempts,
+		},
+	}
+}
+
+// ReadResolvConf parses the file at path, usually RESOLV_CONF_PATH.
+func ReadResolvConf(path string) (*ResolvConf, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return ParseResolvConf(fd)
+}
+
+// ParseResolvConf follows the glibc reading rules: "domain" and "search"
+// override each other with the last one winning, unparsable nameservers
+// are skipped.
+func ParseResolvConf(r io.Reader) (*ResolvConf, error) {
+	rc := NewResolvConf()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// both ; and # start a comment
+		if idx := strings.IndexAny(line, "#;"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) < 2 {
+				continue
+			}
+			addr, err := netip.ParseAddr(fields[1])
+			if err != nil {
+				continue
+			}
+			rc.Nameservers = append(rc.Nameservers, addr)
+		case "domain":
+			if len(fields) < 2 {
+				continue
+			}
+			rc.Domain = fields[1]
+			rc.Search = nil
+		case "search":
+			rc.Search = append([]string{}, fields[1:]...)
+			rc.Domain = ""
+		case "sortlist":
+			rc.Sortlist = append([]string{}, fields[1:]...)
+		case "options":
+			for _, opt := range fields[1:] {
+				rc.Options.apply(opt)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func (ro *ResolvOpts) apply(opt string) {
+	name, value, hasValue := strings.Cut(opt, ":")
+	intValue := func(max int) (int, bool) {
+		if !hasValue {
+			return 0, false
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		if n > max {
+			n = max
+		}
+		return n, true
+	}
+	switch name {
+	case "ndots":
+		if n, ok := intValue(maxNdots); ok {
+			ro.Ndots = n
+			return
+		}
+	case "timeout":
+		if n, ok := intValue(maxTimeout); ok && n > 0 {
+			ro.Timeout = n
+			return
+		}
+	case "attempts":
+		if n, ok := intValue(maxAttempts); ok && n > 0 {
+			ro.Attempts = n
+			return
+		}
+	case "rotate":
+		ro.Rotate = true
+		return
+	case "edns0":
+		ro.EDNS0 = true
+		return
+	case "trust-ad":
+		ro.TrustAD = true
+		return
+	case "use-vc":
+		ro.UseVC = true
+		return
+	case "single-request":
+		ro.SingleRequest = true
+		return
+	case "no-aaaa":
+		ro.NoAAAA = true
+		return
+	case "no-tld-query":
+		ro.NoTLDQuery = true
+		return
+	}
+	ro.Unknown = append(ro.Unknown, opt)
+}
+
+// SearchList returns the effective search list, "domain" is a one-entry list.
+func (rc *ResolvConf) SearchList() []string {
+	if len(rc.Search) != 0 {
+		return rc.Search
+	}
+	if rc.Domain != "" {
+		return []string{rc.Domain}
+	}
+	return nil
+}
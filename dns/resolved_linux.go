@@ -0,0 +1,120 @@
+//go:build linux
+
+package dns
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sort"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// D-Bus names of systemd-resolved, shared with dnscache
+const (
+	ResolvedBusName   = "org.freedesktop.resolve1"
+	ResolvedObjPath   = dbus.ObjectPath("/org/freedesktop/resolve1")
+	ResolvedManagerIf = "org.freedesktop.resolve1.Manager"
+	resolvedLinkIf    = "org.freedesktop.resolve1.Link"
+)
+
+var ErrResolvedNotRunning = errors.New("systemd-resolved is not running")
+
+// ResolvedRunning checks the bus name has an owner instead of scanning /proc.
+func ResolvedRunning(conn *dbus.Conn) bool {
+	var hasOwner bool
+	err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, ResolvedBusName).Store(&hasOwner)
+	return err == nil && hasOwner
+}
+
+// readResolved fetches the global and per-link settings from systemd-resolved,
+// replacing a `resolvectl status` subprocess.
+func readResolved(conn *dbus.Conn) (*ResolvedSetting, error) {
+	if !ResolvedRunning(conn) {
+		return nil, ErrResolvedNotRunning
+	}
+	mgr := conn.Object(ResolvedBusName, ResolvedObjPath)
+
+	// a(iiay): ifindex, family, address
+	var rawServers []struct {
+		IfIndex int32
+		Family  int32
+		Addr    []byte
+	}
+	v, err := mgr.GetProperty(ResolvedManagerIf + ".DNS")
+	if err != nil {
+		return nil, err
+	}
+	if err = v.Store(&rawServers); err != nil {
+		return nil, err
+	}
+	// a(isb): ifindex, domain, routing only
+	var rawDomains []struct {
+		IfIndex     int32
+		Domain      string
+		RoutingOnly bool
+	}
+	v, err = mgr.GetProperty(ResolvedManagerIf + ".Domains")
+	if err != nil {
+		return nil, err
+	}
+	if err = v.Store(&rawDomains); err != nil {
+		return nil, err
+	}
+
+	rs := &ResolvedSetting{
+		Servers: make([]ResolvedServer, 0, len(rawServers)),
+		Domains: make([]ResolvedDomain, 0, len(rawDomains)),
+		Links:   make([]ResolvedLink, 0),
+	}
+	links := make(map[int]*ResolvedLink)
+	getLink := func(idx int) *ResolvedLink {
+		if l, ok := links[idx]; ok {
+			return l
+		}
+		l := &ResolvedLink{Index: idx, Servers: make([]netip.Addr, 0), Domains: make([]ResolvedDomain, 0)}
+		if iface, err := net.InterfaceByIndex(idx); err == nil {
+			l.Name = iface.Name
+		}
+		links[idx] = l
+		return l
+	}
+	for _, s := range rawServers {
+		addr, ok := netip.AddrFromSlice(s.Addr)
+		if !ok {
+			continue
+		}
+		srv := ResolvedServer{IfIndex: int(s.IfIndex), Addr: addr.Unmap()}
+		rs.Servers = append(rs.Servers, srv)
+		if srv.IfIndex != 0 {
+			l := getLink(srv.IfIndex)
+			l.Servers = append(l.Servers, srv.Addr)
+		}
+	}
+	for _, d := range rawDomains {
+		dom := ResolvedDomain{IfIndex: int(d.IfIndex), Domain: d.Domain, RoutingOnly: d.RoutingOnly}
+		rs.Domains = append(rs.Domains, dom)
+		if dom.IfIndex != 0 {
+			l := getLink(dom.IfIndex)
+			l.Domains = append(l.Domains, dom)
+		}
+	}
+	for idx, l := range links {
+		var linkPath dbus.ObjectPath
+		if err := mgr.Call(ResolvedManagerIf+".GetLink", 0, int32(idx)).Store(&linkPath); err != nil {
+			continue
+		}
+		v, err := conn.Object(ResolvedBusName, linkPath).GetProperty(resolvedLinkIf + ".DefaultRoute")
+		if err != nil {
+			continue
+		}
+		_ = v.Store(&l.DefaultRoute)
+	}
+	for _, l := range links {
+		rs.Links = append(rs.Links, *l)
+	}
+	// map order is random, keep the result stable for comparison
+	sort.Slice(rs.Links, func(i, j int) bool { return rs.Links[i].Index < rs.Links[j].Index })
+	return rs, nil
+}
@@ -0,0 +1,291 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mac OS does not use /etc/resolv.conf for scoped queries, the resolvers
+// come from configd (`scutil --dns`) and the files in /etc/resolver.
+// The parsers here are pure Go so they can be used on any platform.
+
+const (
+	RESOLVER_DIR_PATH = "/etc/resolver"
+
+	ScopeDefault = "default"
+	ScopeScoped  = "scoped"
+	ScopeService = "service"
+	ScopeFile    = "file" // /etc/resolver/*
+)
+
+// ScopedResolver is one resolver entry of `scutil --dns` or /etc/resolver.
+type ScopedResolver struct {
+	Scope       string            `json:"scope"`
+	Number      int               `json:"number,omitempty"` // "resolver #N"
+	Domain      string            `json:"domain,omitempty"`
+	Search      []string          `json:"search,omitempty"`
+	Nameservers []netip.Addr      `json:"nameservers"`
+	Port        int               `json:"port,omitempty"`
+	IfIndex     int               `json:"if_index,omitempty"`
+	IfName      string            `json:"if_name,omitempty"`
+	Flags       []string          `json:"flags,omitempty"`
+	Reach       uint32            `json:"reach"`
+	ReachFlags  []string          `json:"reach_flags,omitempty"`
+	Order       int               `json:"order,omitempty"`
+	SearchOrder int               `json:"search_order,omitempty"`
+	Timeout     int               `json:"timeout,omitempty"`
+	Options     []string          `json:"options,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"` // keys not understood
+}
+
+// Reachable reports the Reachable bit of the SCNetworkReachability flags.
+func (sr ScopedResolver) Reachable() bool {
+	return sr.Reach&0x2 != 0
+}
+
+// ParseScutilDNS parses the output of `scutil --dns`.
+func ParseScutilDNS(r io.Reader) ([]ScopedResolver, error) {
+	resolvers := make([]ScopedResolver, 0)
+	scope := ScopeDefault
+	var cur *ScopedResolver
+	flush := func() {
+		if cur != nil {
+			resolvers = append(resolvers, *cur)
+			cur = nil
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "DNS configuration"):
+			flush()
+			switch {
+			case strings.Contains(line, "scoped"):
+				scope = ScopeScoped
+			case strings.Contains(line, "service"):
+				scope = ScopeService
+			default:
+				scope = ScopeDefault
+			}
+			continue
+		case strings.HasPrefix(line, "resolver #"):
+			flush()
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "resolver #"))
+			if err != nil {
+				return nil, fmt.Errorf("scutil line %d: bad resolver number", lineNo)
+			}
+			cur = &ScopedResolver{Scope: scope, Number: n, Nameservers: make([]netip.Addr, 0)}
+			continue
+		}
+		if cur == nil {
+			// header lines such as "mdns_timeout" belong to no resolver
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("scutil line %d: missing colon", lineNo)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		// indexed keys like "nameserver[0]" and "search domain[1]"
+		if idx := strings.IndexByte(key, '['); idx >= 0 {
+			key = key[:idx]
+		}
+		if err := cur.setScutil(key, value); err != nil {
+			return nil, fmt.Errorf("scutil line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return resolvers, nil
+}
+
+func (sr *ScopedResolver) setScutil(key, value string) error {
+	var err error
+	switch key {
+	case "nameserver":
+		addr, perr := netip.ParseAddr(value)
+		if perr != nil {
+			return perr
+		}
+		sr.Nameservers = append(sr.Nameservers, addr)
+	case "search domain":
+		sr.Search = append(sr.Search, value)
+	case "domain":
+		sr.Domain = value
+	case "port":
+		sr.Port, err = strconv.Atoi(value)
+	case "if_index":
+		// "6 (en0)"
+		num, name, _ := strings.Cut(value, " ")
+		sr.IfIndex, err = strconv.Atoi(num)
+		sr.IfName = strings.Trim(strings.TrimSpace(name), "()")
+	case "flags":
+		sr.Flags = splitList(value)
+	case "reach":
+		// "0x00020002 (Reachable,Directly Reachable Address)"
+		num, names, _ := strings.Cut(value, " ")
+		var reach uint64
+		reach, err = strconv.ParseUint(num, 0, 32)
+		sr.Reach = uint32(reach)
+		sr.ReachFlags = splitList(strings.Trim(strings.TrimSpace(names), "()"))
+	case "order":
+		sr.Order, err = strconv.Atoi(value)
+	case "timeout":
+		sr.Timeout, err = strconv.Atoi(value)
+	case "options":
+		sr.Options = strings.Fields(value)
+	default:
+		if sr.Extra == nil {
+			sr.Extra = make(map[string]string)
+		}
+		sr.Extra[key] = value
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// ParseResolverFile parses one /etc/resolver file, see resolver(5).
+// The file name is the domain unless a "domain" line says otherwise.
+func ParseResolverFile(name string, r io.Reader) (*ScopedResolver, error) {
+	sr := &ScopedResolver{Scope: ScopeFile, Domain: name, Nameservers: make([]netip.Addr, 0)}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if idx := strings.IndexAny(line, "#;"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "nameserver":
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(fields[1]); err == nil {
+				sr.Nameservers = append(sr.Nameservers, addr)
+			}
+		case "domain":
+			sr.Domain = fields[1]
+		case "search":
+			sr.Search = append([]string{}, fields[1:]...)
+		case "port":
+			sr.Port, err = strconv.Atoi(fields[1])
+		case "timeout":
+			sr.Timeout, err = strconv.Atoi(fields[1])
+		case "search_order":
+			sr.SearchOrder, err = strconv.Atoi(fields[1])
+		case "options":
+			sr.Options = append(sr.Options, fields[1:]...)
+		default:
+			if sr.Extra == nil {
+				sr.Extra = make(map[string]string)
+			}
+			sr.Extra[fields[0]] = strings.Join(fields[1:], " ")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("resolver file %s line %d: %w", name, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// ReadResolverDir parses every file of dir, usually RESOLVER_DIR_PATH.
+// A missing directory is not an error.
+func ReadResolverDir(dir string) ([]ScopedResolver, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make([]ScopedResolver, 0), nil
+		}
+		return nil, err
+	}
+	resolvers := make([]ScopedResolver, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		sr, err := func() (*ScopedResolver, error) {
+			fd, err := os.Open(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			defer fd.Close()
+			return ParseResolverFile(entry.Name(), fd)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, *sr)
+	}
+	return resolvers, nil
+}
+
+// MergeResolverFiles adds the /etc/resolver entries configd has not merged
+// into the `scutil --dns` output yet. configd lists each file as a resolver
+// with the same domain, nameservers and port.
+func MergeResolverFiles(resolvers, files []ScopedResolver) []ScopedResolver {
+	merged := append(make([]ScopedResolver, 0, len(resolvers)+len(files)), resolvers...)
+	for _, f := range files {
+		dup := false
+		for _, sr := range resolvers {
+			if sameResolver(sr, f) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
+
+func sameResolver(a, b ScopedResolver) bool {
+	port := func(p int) int {
+		if p == 0 {
+			return 53
+		}
+		return p
+	}
+	if !strings.EqualFold(strings.TrimSuffix(a.Domain, "."), strings.TrimSuffix(b.Domain, ".")) ||
+		port(a.Port) != port(b.Port) || len(a.Nameservers) != len(b.Nameservers) {
+		return false
+	}
+	for i := range a.Nameservers {
+		if a.Nameservers[i] != b.Nameservers[i] {
+			return false
+		}
+	}
+	return true
+}
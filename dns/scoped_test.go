@@ -0,0 +1,161 @@
+package dns
+
+import (
+	"net/netip"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func addrs(list ...string) []netip.Addr {
+	out := make([]netip.Addr, 0, len(list))
+	for _, s := range list {
+		out = append(out, netip.MustParseAddr(s))
+	}
+	return out
+}
+
+func TestParseScutilDNS(t *testing.T) {
+	fd, err := os.Open("testdata/scutil_dns.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	resolvers, err := ParseScutilDNS(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolvers) != 5 {
+		t.Fatalf("got %d resolvers, want 5", len(resolvers))
+	}
+
+	first := resolvers[0]
+	if first.Scope != ScopeDefault || first.Number != 1 {
+		t.Errorf("resolver 0 scope %q number %d", first.Scope, first.Number)
+	}
+	if !reflect.DeepEqual(first.Search, []string{"corp.example", "example.com"}) {
+		t.Errorf("search = %v", first.Search)
+	}
+	if !reflect.DeepEqual(first.Nameservers, addrs("192.168.1.1", "fd00::1")) {
+		t.Errorf("nameservers = %v", first.Nameservers)
+	}
+	if first.IfIndex != 6 || first.IfName != "en0" || !first.Reachable() {
+		t.Errorf("if %d %q reachable %v", first.IfIndex, first.IfName, first.Reachable())
+	}
+	if !reflect.DeepEqual(first.ReachFlags, []string{"Reachable", "Directly Reachable Address"}) {
+		t.Errorf("reach flags = %v", first.ReachFlags)
+	}
+
+	mdns := resolvers[1]
+	if mdns.Domain != "local" || mdns.Timeout != 5 || mdns.Order != 300000 || mdns.Reachable() {
+		t.Errorf("mdns resolver = %+v", mdns)
+	}
+	if !reflect.DeepEqual(mdns.Options, []string{"mdns"}) {
+		t.Errorf("options = %v", mdns.Options)
+	}
+
+	corp := resolvers[2]
+	if corp.Domain != "corp.example" || corp.Port != 5353 || corp.Order != 1 {
+		t.Errorf("corp resolver = %+v", corp)
+	}
+
+	for i, sr := range resolvers[3:] {
+		if sr.Scope != ScopeScoped || sr.Number != i+1 {
+			t.Errorf("scoped resolver %d scope %q number %d", i, sr.Scope, sr.Number)
+		}
+	}
+	vpn := resolvers[4]
+	if vpn.IfName != "utun3" || vpn.IfIndex != 17 || vpn.Flags[0] != "Scoped" {
+		t.Errorf("vpn resolver = %+v", vpn)
+	}
+	if vpn.Extra["config id"] != "com.wireguard.macos" {
+		t.Errorf("extra = %v", vpn.Extra)
+	}
+}
+
+func TestParseScutilDNSErrors(t *testing.T) {
+	for _, input := range []string{
+		"resolver #x\n",
+		"resolver #1\n  nameserver[0] : not-an-address\n",
+		"resolver #1\n  port : fifty\n",
+		"resolver #1\n  no colon here\n",
+	} {
+		if _, err := ParseScutilDNS(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: no error", input)
+		}
+	}
+}
+
+func TestReadResolverDir(t *testing.T) {
+	resolvers, err := ReadResolverDir("testdata/resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolvers) != 2 {
+		t.Fatalf("got %d resolvers, want 2", len(resolvers))
+	}
+	corp := resolvers[0]
+	want := ScopedResolver{
+		Scope:       ScopeFile,
+		Domain:      "corp.example",
+		Search:      []string{"corp.example", "eng.corp.example"},
+		Nameservers: addrs("10.8.0.1", "10.8.0.2"),
+		Port:        5353,
+		SearchOrder: 1,
+		Timeout:     3,
+		Options:     []string{"ndots:2", "edns0"},
+	}
+	if !reflect.DeepEqual(corp, want) {
+		t.Errorf("corp.example = %+v, want %+v", corp, want)
+	}
+	// a domain line overrides the file name
+	lab := resolvers[1]
+	if lab.Domain != "lab.internal" || lab.SearchOrder != 200 || !reflect.DeepEqual(lab.Nameservers, addrs("fd00:8::53")) {
+		t.Errorf("lab.test = %+v", lab)
+	}
+}
+
+func TestParseResolverFileErrors(t *testing.T) {
+	for _, input := range []string{"port x\n", "search_order first\n", "nameserver 10.0.0.300\n"} {
+		if _, err := ParseResolverFile("bad", strings.NewReader(input)); err == nil {
+			t.Errorf("%q: no error", input)
+		}
+	}
+	if resolvers, err := ReadResolverDir("testdata/missing"); err != nil || len(resolvers) != 0 {
+		t.Errorf("missing dir: %v %v", resolvers, err)
+	}
+}
+
+// configd already lists /etc/resolver/corp.example as resolver #3
+func TestMergeResolverFiles(t *testing.T) {
+	fd, err := os.Open("testdata/scutil_dns.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	resolvers, err := ParseScutilDNS(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := ReadResolverDir("testdata/resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := MergeResolverFiles(resolvers, files)
+	if len(merged) != len(resolvers)+1 {
+		t.Fatalf("got %d resolvers, want %d", len(merged), len(resolvers)+1)
+	}
+	if last := merged[len(merged)-1]; last.Scope != ScopeFile || last.Domain != "lab.internal" {
+		t.Errorf("added %+v, want only lab.internal", last)
+	}
+	// scutil failing leaves the files
+	if merged := MergeResolverFiles(nil, files); !reflect.DeepEqual(merged, files) {
+		t.Errorf("files alone = %+v", merged)
+	}
+	// another port is another resolver
+	files[0].Port = 53
+	if merged := MergeResolverFiles(resolvers, files); len(merged) != len(resolvers)+2 {
+		t.Errorf("port 53 merged away: %+v", merged)
+	}
+}
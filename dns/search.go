@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"strings"
+)
+
+// libc flavours of the search list handling
+const (
+	SearchModeGlibc = "glibc"
+	SearchModeMusl  = "musl"
+)
+
+// maxNameLen is the longest presentation name without the trailing dot
+const maxNameLen = 253
+
+// Candidates returns the fully qualified names, with trailing dot, that the
+// libc resolver tries for name, in order. Repeated search domains are queried
+// again, as libc does:
+//   - a trailing dot means the name is tried as-is only.
+//   - glibc: with at least ndots dots the name is tried as-is first, then
+//     with every search domain; otherwise the search domains come first and
+//     the name as-is last, unless it is a single label with no-tld-query
+//     after a non-empty search list. "." in the search list is the name
+//     as-is, it and the domains after it are skipped once that was tried.
+//   - musl: with at least ndots dots the name is tried as-is only,
+//     otherwise the search domains first and the name as-is last. "." in
+//     the search list makes an invalid name and is skipped.
+//
+// Unknown modes behave as glibc. Names longer than 253 octets are dropped.
+func (rc *ResolvConf) Candidates(name, mode string) []string {
+	list := make([]string, 0)
+	add := func(n string) {
+		if n == "" || len(n) > maxNameLen {
+			return
+		}
+		list = append(list, n+".")
+	}
+	if name == "" || name == "." {
+		return append(list, ".")
+	}
+	if strings.HasSuffix(name, ".") {
+		add(strings.TrimSuffix(name, "."))
+		return list
+	}
+
+	dots := strings.Count(name, ".")
+	search := rc.SearchList()
+	if mode == SearchModeMusl {
+		if dots < rc.Options.Ndots {
+			for _, domain := range search {
+				if domain = strings.TrimSuffix(domain, "."); domain != "" {
+					add(name + "." + domain)
+				}
+			}
+		}
+		add(name)
+		return list
+	}
+
+	// same steps as __res_context_search of glibc
+	triedAsIs, rootOnList := false, false
+	if dots >= rc.Options.Ndots {
+		add(name)
+		triedAsIs = true
+	}
+	for _, domain := range search {
+		domain = strings.TrimSuffix(strings.TrimPrefix(domain, "."), ".")
+		if domain == "" {
+			rootOnList = true
+		}
+		if rootOnList && triedAsIs {
+			continue
+		}
+		if domain == "" {
+			add(name)
+			continue
+		}
+		add(name + "." + domain)
+	}
+	searched := len(search) != 0
+	if (dots != 0 || !searched || !rc.Options.NoTLDQuery) && !triedAsIs && !rootOnList {
+		add(name)
+	}
+	return list
+}
@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		search     []string
+		ndots      int
+		noTLDQuery bool
+		query      string
+		glibc      []string
+		musl       []string
+	}{
+		{"below ndots", []string{"a.example", "b.example"}, 1, false, "host",
+			[]string{"host.a.example.", "host.b.example.", "host."},
+			[]string{"host.a.example.", "host.b.example.", "host."}},
+		{"at ndots", []string{"a.example"}, 1, false, "host.lan",
+			[]string{"host.lan.", "host.lan.a.example."},
+			[]string{"host.lan."}},
+		{"ndots 3", []string{"svc.example"}, 3, false, "db.ns",
+			[]string{"db.ns.svc.example.", "db.ns."},
+			[]string{"db.ns.svc.example.", "db.ns."}},
+		{"trailing dot", []string{"a.example"}, 1, false, "host.",
+			[]string{"host."},
+			[]string{"host."}},
+		{"root", []string{"a.example"}, 1, false, ".",
+			[]string{"."},
+			[]string{"."}},
+		{"single label no-tld-query", []string{"a.example"}, 1, true, "host",
+			[]string{"host.a.example."},
+			[]string{"host.a.example.", "host."}},
+		{"single label no-tld-query without search", nil, 1, true, "host",
+			[]string{"host."},
+			[]string{"host."}},
+		{"dotted name no-tld-query", []string{"a.example"}, 2, true, "host.lan",
+			[]string{"host.lan.a.example.", "host.lan."},
+			[]string{"host.lan.a.example.", "host.lan."}},
+		{"root in the search list", []string{"a.example", ".", "b.example"}, 1, false, "host",
+			[]string{"host.a.example.", "host.", "host.b.example."},
+			[]string{"host.a.example.", "host.b.example.", "host."}},
+		// the name was tried as-is, so the root and what follows are skipped
+		{"root in the search list after as-is", []string{"a.example", ".", "b.example"}, 1, false, "host.lan",
+			[]string{"host.lan.", "host.lan.a.example."},
+			[]string{"host.lan."}},
+		{"root with no-tld-query", []string{"."}, 1, true, "host",
+			[]string{"host."},
+			[]string{"host."}},
+		{"repeated search domain", []string{"a.example", "A.example."}, 1, false, "host",
+			[]string{"host.a.example.", "host.A.example.", "host."},
+			[]string{"host.a.example.", "host.A.example.", "host."}},
+	}
+	for _, tt := range tests {
+		rc := &ResolvConf{Search: tt.search, Options: ResolvOpts{Ndots: tt.ndots, NoTLDQuery: tt.noTLDQuery}}
+		if got := rc.Candidates(tt.query, SearchModeGlibc); !reflect.DeepEqual(got, tt.glibc) {
+			t.Errorf("%s: glibc %v, want %v", tt.name, got, tt.glibc)
+		}
+		if got := rc.Candidates(tt.query, SearchModeMusl); !reflect.DeepEqual(got, tt.musl) {
+			t.Errorf("%s: musl %v, want %v", tt.name, got, tt.musl)
+		}
+	}
+
+	// the domain line is the search list when there is no search line
+	rc := &ResolvConf{Domain: "lan.example", Options: ResolvOpts{Ndots: 1}}
+	if got := rc.Candidates("host", SearchModeGlibc); !reflect.DeepEqual(got, []string{"host.lan.example.", "host."}) {
+		t.Errorf("domain line: %v", got)
+	}
+}
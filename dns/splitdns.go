@@ -0,0 +1,263 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// rule sources
+const (
+	SplitSourceResolved   = "systemd-resolved"
+	SplitSourceResolvConf = "resolv.conf"
+	SplitSourceScutil     = "scutil"
+	SplitSourceResolver   = "resolver-file"
+	SplitSourceNRPT       = "nrpt"
+	SplitSourceSystem     = "system" // windows server list
+)
+
+// SplitRule means queries for Domain go to Servers via Interface.
+// Domain "." is a default route, other domains also cover their subdomains
+// unless Exact is set (NRPT FQDN rules).
+type SplitRule struct {
+	Domain    string           `json:"domain"`
+	Exact     bool             `json:"exact,omitempty"`
+	Servers   []netip.AddrPort `json:"servers"`
+	Interface string           `json:"interface,omitempty"`
+	IfIndex   int              `json:"ifindex,omitempty"`
+	Source    string           `json:"source"`
+}
+
+func (r SplitRule) covers(name string) bool {
+	if r.Exact {
+		return name == r.Domain
+	}
+	return r.Domain == "." || name == r.Domain || strings.HasSuffix(name, "."+r.Domain)
+}
+
+func (r SplitRule) ToTableString() string {
+	servers := make([]string, 0, len(r.Servers))
+	for _, s := range r.Servers {
+		servers = append(servers, s.String())
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\n", r.Domain, strings.Join(servers, " "), r.Interface, r.Source)
+}
+
+// SplitDNS is the set of routing rules of the system resolver.
+type SplitDNS struct {
+	Rules []SplitRule `json:"rules"`
+}
+
+func (s *SplitDNS) ToPortableJSON() string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (s *SplitDNS) ToTableString() string {
+	var sb strings.Builder
+	for _, r := range s.Rules {
+		sb.WriteString(r.ToTableString())
+	}
+	return sb.String()
+}
+
+// Match returns the rules of the longest domain covering name, several
+// rules when more than one interface claims that domain. Exact rules win
+// over suffix rules of the same name.
+func (s *SplitDNS) Match(name string) []SplitRule {
+	name = canonicalDomain(name)
+	best := -1
+	bestExact := false
+	matched := make([]SplitRule, 0)
+	for _, r := range s.Rules {
+		if !r.covers(name) {
+			continue
+		}
+		n := labelCount(r.Domain)
+		switch {
+		case n > best || (n == best && r.Exact && !bestExact):
+			best, bestExact = n, r.Exact
+			matched = append(matched[:0], r)
+		case n == best && r.Exact == bestExact:
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Servers returns the servers of the matching rules without duplicates.
+func (s *SplitDNS) Servers(name string) []netip.AddrPort {
+	seen := make(map[netip.AddrPort]bool)
+	servers := make([]netip.AddrPort, 0)
+	for _, r := range s.Match(name) {
+		for _, srv := range r.Servers {
+			if !seen[srv] {
+				seen[srv] = true
+				servers = append(servers, srv)
+			}
+		}
+	}
+	return servers
+}
+
+func (s *SplitDNS) add(r SplitRule) {
+	r.Domain = canonicalDomain(r.Domain)
+	if len(r.Servers) == 0 {
+		return
+	}
+	for _, old := range s.Rules {
+		if old.Domain == r.Domain && old.Exact == r.Exact && old.IfIndex == r.IfIndex && sameServers(old.Servers, r.Servers) {
+			return
+		}
+	}
+	s.Rules = append(s.Rules, r)
+}
+
+// SplitDNS builds the routing rules from every source of the config:
+//   - systemd-resolved: search and routing domains ("~corp.example") of a link
+//     go to its servers, links with DefaultRoute and the global servers get ".".
+//   - Mac OS: default scope resolvers of `scutil --dns` and /etc/resolver files,
+//     a resolver without domain is a default route. mDNS resolvers carry no
+//     servers and are left out.
+//   - Windows: the NRPT rules plus the system server list as default route.
+//
+// Without any of these the resolv.conf servers are the default route.
+func (c *Config) SplitDNS() *SplitDNS {
+	s := &SplitDNS{Rules: make([]SplitRule, 0)}
+	if c.Resolved != nil {
+		global := make([]netip.AddrPort, 0)
+		for _, srv := range c.Resolved.Servers {
+			if srv.IfIndex == 0 {
+				global = append(global, netip.AddrPortFrom(srv.Addr, 53))
+			}
+		}
+		for _, d := range c.Resolved.Domains {
+			if d.IfIndex == 0 {
+				s.add(SplitRule{Domain: d.Domain, Servers: global, Source: SplitSourceResolved})
+			}
+		}
+		s.add(SplitRule{Domain: ".", Servers: global, Source: SplitSourceResolved})
+		for _, link := range c.Resolved.Links {
+			servers := withPort(link.Servers, 53)
+			isDefault := link.DefaultRoute
+			for _, d := range link.Domains {
+				if d.Domain == "." || d.Domain == "" {
+					// "~." makes the link a default route
+					isDefault = true
+					continue
+				}
+				s.add(SplitRule{Domain: d.Domain, Servers: servers, Interface: link.Name, IfIndex: link.Index, Source: SplitSourceResolved})
+			}
+			if isDefault {
+				s.add(SplitRule{Domain: ".", Servers: servers, Interface: link.Name, IfIndex: link.Index, Source: SplitSourceResolved})
+			}
+		}
+	}
+	for _, sr := range c.Scoped {
+		if sr.Scope != ScopeDefault && sr.Scope != ScopeFile {
+			// scoped and service resolvers answer interface bound queries only
+			continue
+		}
+		port := sr.Port
+		if port == 0 {
+			port = 53
+		}
+		rule := SplitRule{Domain: sr.Domain, Servers: withPort(sr.Nameservers, uint16(port)), Interface: sr.IfName, IfIndex: sr.IfIndex, Source: SplitSourceScutil}
+		if sr.Scope == ScopeFile {
+			rule.Source = SplitSourceResolver
+		}
+		if rule.Domain == "" {
+			rule.Domain = "."
+		}
+		s.add(rule)
+	}
+	for _, nr := range c.NRPT {
+		if len(nr.Servers) == 0 {
+			// DirectAccess or DNSSEC only rules do not redirect
+			continue
+		}
+		for _, ns := range nr.Namespaces {
+			rule := SplitRule{Servers: withPort(nr.Servers, 53), Source: SplitSourceNRPT}
+			switch {
+			case ns == ".":
+				rule.Domain = "."
+			case strings.HasPrefix(ns, "."):
+				rule.Domain = ns[1:]
+			default:
+				rule.Domain, rule.Exact = ns, true
+			}
+			s.add(rule)
+		}
+	}
+	if !s.hasDefault() && c.ResolvConf != nil {
+		servers := make([]netip.Addr, 0, len(c.ResolvConf.Nameservers))
+		for _, addr := range c.ResolvConf.Nameservers {
+			// with systemd-resolved known, its stub adds nothing but a hop
+			if c.Resolved != nil && isResolvedStub(addr) {
+				continue
+			}
+			servers = append(servers, addr)
+		}
+		source := SplitSourceResolvConf
+		if runtime.GOOS == "windows" {
+			source = SplitSourceSystem
+		}
+		s.add(SplitRule{Domain: ".", Servers: withPort(servers, 53), Source: source})
+	}
+	// longest domain first, stable for equal lengths
+	sort.SliceStable(s.Rules, func(i, j int) bool {
+		return labelCount(s.Rules[i].Domain) > labelCount(s.Rules[j].Domain)
+	})
+	return s
+}
+
+func (s *SplitDNS) hasDefault() bool {
+	for _, r := range s.Rules {
+		if r.Domain == "." {
+			return true
+		}
+	}
+	return false
+}
+
+func withPort(addrs []netip.Addr, port uint16) []netip.AddrPort {
+	list := make([]netip.AddrPort, 0, len(addrs))
+	for _, a := range addrs {
+		list = append(list, netip.AddrPortFrom(a, port))
+	}
+	return list
+}
+
+func sameServers(a, b []netip.AddrPort) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalDomain lowercases and strips the trailing dot, the root stays ".".
+func canonicalDomain(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func labelCount(domain string) int {
+	if domain == "." {
+		return 0
+	}
+	return strings.Count(domain, ".") + 1
+}
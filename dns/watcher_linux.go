@@ -0,0 +1,288 @@
+//go:build linux
+
+package dns
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// editors and resolvconf write in several steps, coalesce them
+	watchDebounce = 200 * time.Millisecond
+	inotifyMask   = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB
+)
+
+// ConfigChange carries the effective config before and after a change.
+type ConfigChange struct {
+	Old *Config
+	New *Config
+}
+
+// Watcher reports effective DNS configuration changes.
+// /etc/resolv.conf is followed through symlink replacement with inotify,
+// systemd-resolved through its D-Bus PropertiesChanged signals.
+type Watcher struct {
+	Changes <-chan ConfigChange
+	Errors  <-chan error
+
+	changes chan ConfigChange
+	errors  chan error
+
+	inotify *os.File
+	inoFd   int // os.File.Fd would switch the file back to blocking mode
+	bus     *dbus.Conn
+	signals chan *dbus.Signal
+	trigger chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	watches map[string]int  // watched dir -> wd
+	chain   map[string]bool // resolv.conf and its link targets
+	current *Config
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewWatcher reads the current config and starts watching.
+// Lack of a system bus is not an error, only resolv.conf is watched then.
+func NewWatcher() (*Watcher, error) {
+	cfg, err := RetrieveConfig()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &Watcher{
+		changes: make(chan ConfigChange, 4),
+		errors:  make(chan error, 4),
+		// nonblocking fd goes to the runtime poller, Close unblocks Read
+		inotify: os.NewFile(uintptr(fd), "inotify"),
+		inoFd:   fd,
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		watches: make(map[string]int),
+		chain:   make(map[string]bool),
+		current: cfg,
+	}
+	w.Changes = w.changes
+	w.Errors = w.errors
+	if err = w.updateWatches(); err != nil {
+		w.inotify.Close()
+		return nil, err
+	}
+	w.subscribeResolved()
+
+	w.wg.Add(2)
+	go w.readInotify()
+	go w.loop()
+	return w, nil
+}
+
+// Current returns the last config seen by the watcher.
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Close stops watching and closes Changes and Errors.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.inotify.Close()
+		if w.bus != nil {
+			w.bus.Close()
+		}
+		w.wg.Wait()
+		close(w.changes)
+		close(w.errors)
+	})
+	return err
+}
+
+// updateWatches watches the directory of resolv.conf and of every hop of
+// its symlink chain, so replacing the link or its target is both seen.
+func (w *Watcher) updateWatches() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	chain := symlinkChain(RESOLV_CONF_PATH)
+	for _, path := range chain {
+		// keep previous hops, a deleted target still has to match
+		w.chain[path] = true
+		dir := filepath.Dir(path)
+		if _, ok := w.watches[dir]; ok {
+			continue
+		}
+		wd, err := unix.InotifyAddWatch(w.inoFd, dir, inotifyMask)
+		if err != nil {
+			if path == RESOLV_CONF_PATH {
+				return os.NewSyscallError("inotify_add_watch", err)
+			}
+			// target dir may not exist yet, e.g. /run/systemd/resolve
+			continue
+		}
+		w.watches[dir] = wd
+	}
+	return nil
+}
+
+// symlinkChain returns path followed by each link target it resolves through.
+func symlinkChain(path string) []string {
+	chain := []string{path}
+	for i := 0; i < 16; i++ {
+		target, err := os.Readlink(path)
+		if err != nil {
+			break
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = filepath.Clean(target)
+		chain = append(chain, path)
+	}
+	return chain
+}
+
+func (w *Watcher) subscribeResolved() {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return
+	}
+	err = conn.AddMatchSignal(
+		dbus.WithMatchSender(ResolvedBusName),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchPathNamespace(ResolvedObjPath),
+	)
+	if err == nil {
+		// resolved restarting changes its state as well
+		err = conn.AddMatchSignal(
+			dbus.WithMatchInterface("org.freedesktop.DBus"),
+			dbus.WithMatchMember("NameOwnerChanged"),
+			dbus.WithMatchArg(0, ResolvedBusName),
+		)
+	}
+	if err != nil {
+		conn.Close()
+		return
+	}
+	w.bus = conn
+	w.signals = make(chan *dbus.Signal, 16)
+	conn.Signal(w.signals)
+}
+
+func (w *Watcher) readInotify() {
+	defer w.wg.Done()
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.PathMax))
+	for {
+		n, err := w.inotify.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.sendErr(err)
+			}
+			return
+		}
+		interesting := false
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+			name = bytes.TrimRight(name, "\x00")
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 || w.isWatchedName(int(ev.Wd), string(name)) {
+				interesting = true
+			}
+		}
+		if interesting {
+			w.poke()
+		}
+	}
+}
+
+// isWatchedName reports if name in the watched dir wd is a hop of the resolv.conf chain.
+func (w *Watcher) isWatchedName(wd int, name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dir, v := range w.watches {
+		if v == wd && w.chain[filepath.Join(dir, name)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) poke() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) sendErr(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+func (w *Watcher) loop() {
+	defer w.wg.Done()
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case _, ok := <-w.signals:
+			if !ok {
+				w.signals = nil
+				continue
+			}
+			debounce = time.After(watchDebounce)
+		case <-w.trigger:
+			debounce = time.After(watchDebounce)
+		case <-debounce:
+			debounce = nil
+			if err := w.updateWatches(); err != nil {
+				w.sendErr(err)
+			}
+			w.refresh()
+		}
+	}
+}
+
+func (w *Watcher) refresh() {
+	cfg, err := RetrieveConfig()
+	if err != nil {
+		// resolv.conf is briefly missing while being replaced
+		if os.IsNotExist(err) {
+			return
+		}
+		w.sendErr(err)
+		return
+	}
+	w.mu.Lock()
+	old := w.current
+	if old.Equal(cfg) {
+		w.mu.Unlock()
+		return
+	}
+	w.current = cfg
+	w.mu.Unlock()
+	select {
+	case w.changes <- ConfigChange{Old: old, New: cfg}:
+	case <-w.done:
+	}
+}
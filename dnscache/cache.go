@@ -0,0 +1,183 @@
+package dnscache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+// local resolver caches
+const (
+	CacheResolved      = "systemd-resolved"
+	CacheNscd          = "nscd"
+	CacheDnsmasq       = "dnsmasq"
+	CacheMDNSResponder = "mDNSResponder" // mac os
+	CacheDNSClient     = "dnscache"      // windows DNS Client service
+)
+
+var (
+	ErrNoCache     = errors.New("no local dns cache detected")
+	ErrUnknown     = errors.New("unknown dns cache")
+	ErrUnsupported = errors.New("operation not supported by this dns cache")
+	ErrNotRunning  = errors.New("dns cache is not running")
+)
+
+// Stack is the chain of local caches a host name lookup passes.
+type Stack struct {
+	Caches []string   `json:"caches"`         // in lookup order
+	Stub   netip.Addr `json:"stub,omitempty"` // loopback nameserver of resolv.conf, its cache comes first after nscd
+}
+
+func (s *Stack) ToPortableJSON() string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Has reports whether cache was detected.
+func (s *Stack) Has(cache string) bool {
+	for _, c := range s.Caches {
+		if c == cache {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats are the counters of one cache, Extra keeps what does not fit.
+type Stats struct {
+	Cache  string            `json:"cache"`
+	Size   uint64            `json:"size"` // current entries, dnsmasq reports its capacity
+	Hits   uint64            `json:"hits"`
+	Misses uint64            `json:"misses"`
+	Extra  map[string]uint64 `json:"extra,omitempty"`
+}
+
+func (st *Stats) ToPortableJSON() string {
+	data, err := json.Marshal(st)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// FlushAll flushes every detected cache, trying all of them even if one
+// fails. It returns the flushed caches and the first error.
+func FlushAll() ([]string, error) {
+	stack, err := DetectStack()
+	if err != nil {
+		return nil, err
+	}
+	if len(stack.Caches) == 0 {
+		return nil, ErrNoCache
+	}
+	flushed := make([]string, 0, len(stack.Caches))
+	var firstErr error
+	for _, c := range stack.Caches {
+		if err := Flush(c); err != nil {
+			if firstErr == nil {
+				firstErr = errors.New(c + ": " + err.Error())
+			}
+			continue
+		}
+		flushed = append(flushed, c)
+	}
+	return flushed, firstErr
+}
+
+// ParseNscdStats reads the section of database db ("hosts") from the
+// output of `nscd -g`, lines are "<value>  <description>".
+func ParseNscdStats(r io.Reader, db string) (*Stats, error) {
+	st := &Stats{Cache: CacheNscd, Extra: make(map[string]uint64)}
+	scanner := bufio.NewScanner(r)
+	inSection := false
+	found := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(line, "cache:") {
+			inSection = line == db+" cache:"
+			found = found || inSection
+			continue
+		}
+		if !inSection || line == "" {
+			continue
+		}
+		value, desc, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		desc = strings.TrimSpace(desc)
+		n, err := strconv.ParseUint(strings.TrimSuffix(value, "%"), 10, 64)
+		if err != nil {
+			// "yes  cache is enabled" and the like
+			continue
+		}
+		switch desc {
+		case "current number of cached values":
+			st.Size = n
+		case "cache hits on positive entries", "cache hits on negative entries":
+			st.Hits += n
+		case "cache misses on positive entries", "cache misses on negative entries":
+			st.Misses += n
+		}
+		st.Extra[desc] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("nscd statistics have no " + db + " cache")
+	}
+	return st, nil
+}
+
+// DnsmasqStatistics asks a dnsmasq server for its counters with the
+// CHAOS class TXT queries it answers, "hits.bind" and friends.
+func DnsmasqStatistics(ctx context.Context, server netip.AddrPort) (*Stats, error) {
+	c := &dnsclient.Client{Upstreams: []dnsclient.Upstream{&dnsclient.Plain{Addr: server}}, Attempts: 1}
+	st := &Stats{Cache: CacheDnsmasq, Extra: make(map[string]uint64)}
+	for _, key := range []string{"cachesize", "insertions", "evictions", "misses", "hits", "auth"} {
+		q := dnsclient.NewQuery(key+".bind", dnsclient.TypeTXT)
+		q.Questions[0].Class = dnsclient.ClassCHAOS
+		resp, err := c.Exchange(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if resp.RCode != dnsclient.RCodeSuccess {
+			// "auth" only exists with authoritative zones
+			continue
+		}
+		for _, rr := range resp.Answers {
+			txt, ok := rr.Data.(*dnsclient.TXT)
+			if !ok || len(txt.Strings) == 0 {
+				continue
+			}
+			n, err := strconv.ParseUint(txt.Strings[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			st.Extra[key] = n
+			switch key {
+			case "cachesize":
+				st.Size = n
+			case "hits":
+				st.Hits = n
+			case "misses":
+				st.Misses = n
+			}
+		}
+	}
+	if len(st.Extra) == 0 {
+		return nil, ErrUnsupported
+	}
+	return st, nil
+}
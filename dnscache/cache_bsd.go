@@ -0,0 +1,21 @@
+//go:build dragonfly || freebsd || netbsd || openbsd
+
+package dnscache
+
+// DetectStack finds no cache, the BSD libc resolver does not cache and
+// local-unbound is not handled.
+func DetectStack() (*Stack, error) {
+	return &Stack{Caches: make([]string, 0)}, nil
+}
+
+func Flush(cache string) error {
+	return ErrUnknown
+}
+
+func ResetStatistics(cache string) error {
+	return ErrUnknown
+}
+
+func Statistics(cache string) (*Stats, error) {
+	return nil, ErrUnknown
+}
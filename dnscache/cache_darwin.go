@@ -0,0 +1,41 @@
+//go:build darwin
+
+package dnscache
+
+import (
+	"os/exec"
+)
+
+// DetectStack reports mDNSResponder, which caches every lookup on Mac OS.
+func DetectStack() (*Stack, error) {
+	stack := &Stack{Caches: make([]string, 0)}
+	if exec.Command("/usr/bin/pgrep", "-x", CacheMDNSResponder).Run() == nil {
+		stack.Caches = append(stack.Caches, CacheMDNSResponder)
+	}
+	return stack, nil
+}
+
+// Flush runs `dscacheutil -flushcache` and sends SIGHUP to mDNSResponder.
+func Flush(cache string) error {
+	if cache != CacheMDNSResponder {
+		return ErrUnknown
+	}
+	if err := exec.Command("/usr/bin/dscacheutil", "-flushcache").Run(); err != nil {
+		return err
+	}
+	return exec.Command("/usr/bin/killall", "-HUP", CacheMDNSResponder).Run()
+}
+
+func ResetStatistics(cache string) error {
+	if cache != CacheMDNSResponder {
+		return ErrUnknown
+	}
+	return ErrUnsupported
+}
+
+func Statistics(cache string) (*Stats, error) {
+	if cache != CacheMDNSResponder {
+		return nil, ErrUnknown
+	}
+	return nil, ErrUnsupported
+}
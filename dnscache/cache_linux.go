@@ -0,0 +1,348 @@
+//go:build linux
+
+package dnscache
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/kmahyyg/go-network-compo/dns"
+)
+
+// DetectStack finds the running caches in lookup order: nscd is asked by
+// glibc before any nameserver, then the cache listening on the loopback
+// nameserver of resolv.conf, then the one it forwards to. systemd-resolved
+// is detected by its bus name like package dns does, the others in /proc.
+func DetectStack() (*Stack, error) {
+	stack := &Stack{Caches: make([]string, 0)}
+	procs := processes(CacheNscd, CacheDnsmasq)
+	if _, ok := procs[CacheNscd]; ok {
+		stack.Caches = append(stack.Caches, CacheNscd)
+	}
+	if rc, err := dns.ReadResolvConf(dns.RESOLV_CONF_PATH); err == nil {
+		for _, addr := range rc.Nameservers {
+			if addr.IsLoopback() {
+				stack.Stub = addr
+				break
+			}
+		}
+	}
+	resolved := false
+	if conn, err := dbus.ConnectSystemBus(); err == nil {
+		resolved = dns.ResolvedRunning(conn)
+		conn.Close()
+	}
+	_, dnsmasq := procs[CacheDnsmasq]
+	// with dnsmasq on the loopback nameserver resolved only sees what it forwards
+	resolvedStub := stack.Stub == resolvedStubAddr || stack.Stub == resolvedProxyAddr
+	if resolved && (resolvedStub || !dnsmasq) {
+		stack.Caches = append(stack.Caches, CacheResolved)
+		resolved = false
+	}
+	if dnsmasq {
+		stack.Caches = append(stack.Caches, CacheDnsmasq)
+	}
+	if resolved {
+		stack.Caches = append(stack.Caches, CacheResolved)
+	}
+	return stack, nil
+}
+
+// listen addresses of systemd-resolved, the stub and the DNSSEC-less proxy
+var (
+	resolvedStubAddr  = netip.AddrFrom4([4]byte{127, 0, 0, 53})
+	resolvedProxyAddr = netip.AddrFrom4([4]byte{127, 0, 0, 54})
+)
+
+// processes scans /proc for the given command names, returning their pids.
+func processes(names ...string) map[string]int {
+	found := make(map[string]int)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return found
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		comm, err := os.ReadFile("/proc/" + entry.Name() + "/comm")
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSpace(string(comm))
+		for _, n := range names {
+			// comm is cut at 15 characters, "systemd-resolve"
+			if name == n || (len(n) > 15 && name == n[:15]) {
+				if _, ok := found[n]; !ok {
+					found[n] = pid
+				}
+			}
+		}
+	}
+	return found
+}
+
+// Flush empties one cache: FlushCaches over D-Bus for systemd-resolved,
+// `nscd -i hosts` for nscd and SIGHUP for dnsmasq.
+func Flush(cache string) error {
+	switch cache {
+	case CacheResolved:
+		return callResolved("FlushCaches")
+	case CacheNscd:
+		return runNscd("-i", "hosts")
+	case CacheDnsmasq:
+		// SIGHUP clears the cache and rereads the hosts files
+		return signalProcess(CacheDnsmasq, syscall.SIGHUP)
+	}
+	return ErrUnknown
+}
+
+// ResetStatistics zeroes the counters, only systemd-resolved supports it.
+func ResetStatistics(cache string) error {
+	switch cache {
+	case CacheResolved:
+		return callResolved("ResetStatistics")
+	case CacheNscd, CacheDnsmasq:
+		return ErrUnsupported
+	}
+	return ErrUnknown
+}
+
+// Statistics reads the counters of one cache. For dnsmasq SIGUSR1 is sent
+// too, which writes its full statistics to syslog.
+func Statistics(cache string) (*Stats, error) {
+	switch cache {
+	case CacheResolved:
+		return resolvedStatistics()
+	case CacheNscd:
+		out, err := exec.Command("nscd", "-g").Output()
+		if err != nil {
+			return nil, err
+		}
+		return ParseNscdStats(bytes.NewReader(out), "hosts")
+	case CacheDnsmasq:
+		if err := signalProcess(CacheDnsmasq, syscall.SIGUSR1); err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		return DnsmasqStatistics(ctx, dnsmasqServer())
+	}
+	return nil, ErrUnknown
+}
+
+// DNSMASQ_CONF_PATH is read for listen-address and port when dnsmasq was
+// started without them on its command line.
+const DNSMASQ_CONF_PATH = "/etc/dnsmasq.conf"
+
+// dnsmasqServer returns where dnsmasq answers queries, which is not the
+// resolv.conf stub when systemd-resolved sits there: a UDP socket of the
+// process (loopback preferred), else its listen-address and port options,
+// else 127.0.0.1:53.
+func dnsmasqServer() netip.AddrPort {
+	loopback := netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	pid, ok := processes(CacheDnsmasq)[CacheDnsmasq]
+	if !ok {
+		return netip.AddrPortFrom(loopback, 53)
+	}
+	if sockets := processUDPSockets(pid); len(sockets) > 0 {
+		best := sockets[0]
+		for _, ap := range sockets {
+			if ap.Addr().IsLoopback() {
+				best = ap
+				break
+			}
+		}
+		if best.Addr().IsUnspecified() {
+			// wildcard bind, loopback of the same family reaches it
+			if best.Addr().Is6() {
+				return netip.AddrPortFrom(netip.IPv6Loopback(), best.Port())
+			}
+			return netip.AddrPortFrom(loopback, best.Port())
+		}
+		return best
+	}
+	addr, port := loopback, uint16(53)
+	args := make([]string, 0)
+	if cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline"); err == nil {
+		args = strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	}
+	confPath := DNSMASQ_CONF_PATH
+	options := make([]string, 0)
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		// short options take the next argument
+		if (arg == "-a" || arg == "-p" || arg == "-C") && i+1 < len(args) {
+			i++
+			arg = map[string]string{"-a": "listen-address=", "-p": "port=", "-C": "conf-file="}[arg] + args[i]
+		}
+		arg = strings.TrimPrefix(arg, "--")
+		if strings.HasPrefix(arg, "conf-file=") {
+			confPath = strings.TrimPrefix(arg, "conf-file=")
+			continue
+		}
+		options = append(options, arg)
+	}
+	if conf, err := os.ReadFile(confPath); err == nil {
+		// command line options win, they come last
+		options = append(strings.Split(string(conf), "\n"), options...)
+	}
+	for _, opt := range options {
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "listen-address":
+			// the first address of a list
+			first, _, _ := strings.Cut(value, ",")
+			if a, err := netip.ParseAddr(strings.TrimSpace(first)); err == nil {
+				addr = a
+			}
+		case "port":
+			if p, err := strconv.ParseUint(strings.TrimSpace(value), 10, 16); err == nil && p != 0 {
+				port = uint16(p)
+			}
+		}
+	}
+	return netip.AddrPortFrom(addr, port)
+}
+
+// processUDPSockets returns the local addresses of the UDP sockets of pid,
+// from its fds and /proc/net/udp{,6}. Reading the fds of another user's
+// process needs root.
+func processUDPSockets(pid int) []netip.AddrPort {
+	inodes := make(map[string]bool)
+	fdDir := "/proc/" + strconv.Itoa(pid) + "/fd"
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if link, err := os.Readlink(fdDir + "/" + e.Name()); err == nil && strings.HasPrefix(link, "socket:[") {
+			inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = true
+		}
+	}
+	sockets := make([]netip.AddrPort, 0)
+	for _, path := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 10 || !inodes[fields[9]] {
+				continue
+			}
+			if ap, ok := parseProcNetAddr(fields[1]); ok {
+				sockets = append(sockets, ap)
+			}
+		}
+	}
+	return sockets
+}
+
+// parseProcNetAddr parses "0100007F:0035", the address in 32 bit words of
+// host byte order (little endian assumed, like the route table), the port big endian.
+func parseProcNetAddr(s string) (netip.AddrPort, bool) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	raw, err := hex.DecodeString(addrHex)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, false
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), true
+}
+
+func callResolved(method string) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	call := conn.Object(dns.ResolvedBusName, dns.ResolvedObjPath).Call(dns.ResolvedManagerIf+"."+method, 0)
+	if call.Err != nil {
+		if dbusErr, ok := call.Err.(dbus.Error); ok && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+			return ErrNotRunning
+		}
+		return call.Err
+	}
+	return nil
+}
+
+func resolvedStatistics() (*Stats, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	mgr := conn.Object(dns.ResolvedBusName, dns.ResolvedObjPath)
+	// (ttt): current cache size, hits, misses
+	var cache struct {
+		Size, Hits, Misses uint64
+	}
+	v, err := mgr.GetProperty(dns.ResolvedManagerIf + ".CacheStatistics")
+	if err != nil {
+		return nil, err
+	}
+	if err = v.Store(&cache); err != nil {
+		return nil, err
+	}
+	st := &Stats{Cache: CacheResolved, Size: cache.Size, Hits: cache.Hits, Misses: cache.Misses, Extra: make(map[string]uint64)}
+	// (tt): current and total transactions
+	var transactions struct {
+		Current, Total uint64
+	}
+	if v, err = mgr.GetProperty(dns.ResolvedManagerIf + ".TransactionStatistics"); err == nil && v.Store(&transactions) == nil {
+		st.Extra["transactions_current"] = transactions.Current
+		st.Extra["transactions_total"] = transactions.Total
+	}
+	// (tttt): secure, insecure, bogus, indeterminate
+	var dnssec struct {
+		Secure, Insecure, Bogus, Indeterminate uint64
+	}
+	if v, err = mgr.GetProperty(dns.ResolvedManagerIf + ".DNSSECStatistics"); err == nil && v.Store(&dnssec) == nil {
+		st.Extra["dnssec_secure"] = dnssec.Secure
+		st.Extra["dnssec_insecure"] = dnssec.Insecure
+		st.Extra["dnssec_bogus"] = dnssec.Bogus
+		st.Extra["dnssec_indeterminate"] = dnssec.Indeterminate
+	}
+	return st, nil
+}
+
+func runNscd(args ...string) error {
+	out, err := exec.Command("nscd", args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New("nscd: " + msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func signalProcess(name string, sig syscall.Signal) error {
+	pid, ok := processes(name)[name]
+	if !ok {
+		return ErrNotRunning
+	}
+	return syscall.Kill(pid, sig)
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package dnscache
+
+import (
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/kmahyyg/go-network-compo/wintypes"
+)
+
+// DetectStack reports the DNS Client service if it runs. The service
+// manager and the service are opened with query rights only, which
+// unprivileged users have.
+func DetectStack() (*Stack, error) {
+	stack := &Stack{Caches: make([]string, 0)}
+	h, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return nil, err
+	}
+	m := &mgr.Mgr{Handle: h}
+	defer m.Disconnect()
+	name, err := windows.UTF16PtrFromString(CacheDNSClient)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := windows.OpenService(h, name, windows.SERVICE_QUERY_STATUS)
+	if err != nil {
+		return stack, nil
+	}
+	s := &mgr.Service{Name: CacheDNSClient, Handle: sh}
+	defer s.Close()
+	if status, err := s.Query(); err == nil && status.State == svc.Running {
+		stack.Caches = append(stack.Caches, CacheDNSClient)
+	}
+	return stack, nil
+}
+
+// Flush is `ipconfig /flushdns`.
+func Flush(cache string) error {
+	if cache != CacheDNSClient {
+		return ErrUnknown
+	}
+	return wintypes.DnsFlushResolverCache()
+}
+
+func ResetStatistics(cache string) error {
+	if cache != CacheDNSClient {
+		return ErrUnknown
+	}
+	return ErrUnsupported
+}
+
+func Statistics(cache string) (*Stats, error) {
+	if cache != CacheDNSClient {
+		return nil, ErrUnknown
+	}
+	return nil, ErrUnsupported
+}
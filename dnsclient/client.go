@@ -0,0 +1,174 @@
+package dnsclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dns"
+)
+
+var ErrNoUpstreams = errors.New("no upstream nameserver configured")
+
+// Upstream sends a message to a single server and returns its answer.
+type Upstream interface {
+	Exchange(ctx context.Context, msg *Message) (*Message, error)
+	String() string
+}
+
+// UpstreamError tells which upstream a transport error came from.
+type UpstreamError struct {
+	Upstream string
+	Err      error
+}
+
+func (e *UpstreamError) Error() string {
+	return e.Upstream + ": " + e.Err.Error()
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Client queries a list of upstreams the way the libc stub resolver does:
+// every upstream is tried in order for each attempt, SERVFAIL, NOTIMP and
+// REFUSED move on to the next one.
+type Client struct {
+	Upstreams []Upstream
+	Timeout   time.Duration // per try
+	Attempts  int
+	Rotate    bool
+	// UDPSize is advertised with EDNS0 on queries without an OPT record, 0 disables it
+	UDPSize uint16
+
+	next uint32
+}
+
+// NewClient builds a client from a parsed resolv.conf.
+func NewClient(rc *dns.ResolvConf) *Client {
+	c := &Client{
+		Upstreams: make([]Upstream, 0, len(rc.Nameservers)),
+		Timeout:   time.Duration(rc.Options.Timeout) * time.Second,
+		Attempts:  rc.Options.Attempts,
+		Rotate:    rc.Options.Rotate,
+	}
+	if rc.Options.EDNS0 {
+		c.UDPSize = DefaultUDPSize
+	}
+	for _, addr := range rc.Nameservers {
+		c.Upstreams = append(c.Upstreams, &Plain{Addr: netip.AddrPortFrom(addr, 53), UseTCP: rc.Options.UseVC})
+	}
+	return c
+}
+
+// NewSystemClient builds a client from dns.RetrieveConfig, systemd-resolved
+// upstreams are used directly instead of its stub listener.
+func NewSystemClient() (*Client, error) {
+	cfg, err := dns.RetrieveConfig()
+	if err != nil {
+		return nil, err
+	}
+	rc := *cfg.ResolvConf
+	rc.Nameservers = cfg.Nameservers()
+	return NewClient(&rc), nil
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return c.Timeout
+}
+
+func (c *Client) attempts() int {
+	if c.Attempts <= 0 {
+		return 1
+	}
+	return c.Attempts
+}
+
+// Exchange sends msg and returns the first usable answer. When all
+// upstreams fail with a server error the last answer is returned.
+// msg gets an OPT record added if UDPSize is set and it has none.
+func (c *Client) Exchange(ctx context.Context, msg *Message) (*Message, error) {
+	n := len(c.Upstreams)
+	if n == 0 {
+		return nil, ErrNoUpstreams
+	}
+	if c.UDPSize != 0 && msg.OPT() == nil {
+		msg.SetEDNS0(c.UDPSize, false)
+	}
+	start := 0
+	if c.Rotate {
+		start = int((atomic.AddUint32(&c.next, 1) - 1) % uint32(n))
+	}
+	var lastResp *Message
+	var lastErr error
+	for attempt := 0; attempt < c.attempts(); attempt++ {
+		for i := 0; i < n; i++ {
+			up := c.Upstreams[(start+i)%n]
+			tryCtx, cancel := context.WithTimeout(ctx, c.timeout())
+			resp, err := up.Exchange(tryCtx, msg)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				lastErr = &UpstreamError{Upstream: up.String(), Err: err}
+				continue
+			}
+			switch resp.RCode {
+			case RCodeServerFailure, RCodeNotImplemented, RCodeRefused:
+				lastResp = resp
+				continue
+			}
+			return resp, nil
+		}
+	}
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	return nil, lastErr
+}
+
+// Query is Exchange for a single recursive question.
+func (c *Client) Query(ctx context.Context, name string, t Type) (*Message, error) {
+	return c.Exchange(ctx, NewQuery(name, t))
+}
+
+func newID() uint16 {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// checkReply makes sure resp answers req, ID and question must match.
+func checkReply(req, resp *Message) error {
+	if !resp.Response {
+		return errors.New("dns reply is not a response")
+	}
+	if resp.ID != req.ID {
+		return fmt.Errorf("dns reply id %d, want %d", resp.ID, req.ID)
+	}
+	// servers may drop the question on errors like FORMERR
+	if len(resp.Questions) == 0 {
+		return nil
+	}
+	if len(resp.Questions) != len(req.Questions) {
+		return errors.New("dns reply question count mismatch")
+	}
+	for i, q := range req.Questions {
+		rq := resp.Questions[i]
+		if rq.Type != q.Type || rq.Class != q.Class || CanonicalName(rq.Name) != CanonicalName(q.Name) {
+			return errors.New("dns reply question mismatch")
+		}
+	}
+	return nil
+}
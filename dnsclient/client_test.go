@@ -0,0 +1,179 @@
+package dnsclient
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/internal/dnstest"
+)
+
+// stub serves message handlers on the shared stand-in server, a nil
+// handler leaves that transport closed.
+func stub(udp, tcp func(*Message) *Message) *dnstest.Server {
+	return &dnstest.Server{UDP: handler(udp), TCP: handler(tcp)}
+}
+
+func handler(h func(*Message) *Message) dnstest.Handler {
+	if h == nil {
+		return nil
+	}
+	return func(b []byte) []byte { return respond(h, b) }
+}
+
+func respond(handler func(*Message) *Message, b []byte) []byte {
+	req := new(Message)
+	if err := req.Unpack(b); err != nil {
+		return nil
+	}
+	resp := handler(req)
+	if resp == nil {
+		return nil
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// reply answers req with the given rcode and A records.
+func reply(req *Message, rcode RCode, addrs ...string) *Message {
+	resp := &Message{
+		Header:    Header{ID: req.ID, Response: true, RecursionDesired: req.RecursionDesired, RecursionAvailable: true, RCode: rcode},
+		Questions: req.Questions,
+	}
+	for _, a := range addrs {
+		resp.Answers = append(resp.Answers, Resource{
+			Name: req.Questions[0].Name, Type: TypeA, Class: ClassINET, TTL: 60,
+			Data: &A{Addr: netip.MustParseAddr(a)},
+		})
+	}
+	return resp
+}
+
+func TestPlainTruncatedFallsBackToTCP(t *testing.T) {
+	srv := stub(
+		func(req *Message) *Message {
+			resp := reply(req, RCodeSuccess)
+			resp.Truncated = true
+			return resp
+		},
+		func(req *Message) *Message {
+			return reply(req, RCodeSuccess, "192.0.2.1", "192.0.2.2")
+		},
+	)
+	addr := srv.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := (&Plain{Addr: addr}).Exchange(ctx, NewQuery("big.example.", TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Truncated || len(resp.AnswerAddrs()) != 2 {
+		t.Errorf("got tc %v answers %v, want the full TCP answer", resp.Truncated, resp.AnswerAddrs())
+	}
+	if u, c := srv.UDPHits(), srv.TCPHits(); u != 1 || c != 1 {
+		t.Errorf("udp hits %d tcp hits %d, want 1 each", u, c)
+	}
+
+	// use-vc skips UDP entirely
+	if _, err = (&Plain{Addr: addr, UseTCP: true}).Exchange(ctx, NewQuery("big.example.", TypeA)); err != nil {
+		t.Fatal(err)
+	}
+	if u, c := srv.UDPHits(), srv.TCPHits(); u != 1 || c != 2 {
+		t.Errorf("use-vc: udp hits %d tcp hits %d", u, c)
+	}
+}
+
+func TestExchangeUDPDropsMismatchedReplies(t *testing.T) {
+	srv := stub(func(req *Message) *Message {
+		// a spoofed id is ignored, the caller keeps waiting
+		resp := reply(req, RCodeSuccess, "203.0.113.66")
+		resp.ID++
+		return resp
+	}, nil)
+	addr := srv.Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := ExchangeUDP(ctx, addr, NewQuery("example.", TypeA)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExchangeUDP = %v, want deadline exceeded", err)
+	}
+}
+
+func TestClientExchange(t *testing.T) {
+	refused := stub(func(req *Message) *Message { return reply(req, RCodeRefused) }, nil)
+	var sawEDNS int32
+	good := stub(func(req *Message) *Message {
+		if opt := req.OPT(); opt != nil && opt.UDPSize() == DefaultUDPSize {
+			atomic.StoreInt32(&sawEDNS, 1)
+		}
+		return reply(req, RCodeSuccess, "192.0.2.10")
+	}, nil)
+	nxdomain := stub(func(req *Message) *Message { return reply(req, RCodeNameError) }, nil)
+	servfail := stub(func(req *Message) *Message { return reply(req, RCodeServerFailure) }, nil)
+	// closed port, the UDP read fails with connection refused
+	dead := stub(nil, nil).Start(t)
+
+	plain := func(srv *dnstest.Server) Upstream { return &Plain{Addr: srv.Start(t)} }
+	tests := []struct {
+		name      string
+		upstreams []Upstream
+		want      RCode
+		wantErr   bool
+	}{
+		{"refused moves on", []Upstream{plain(refused), plain(good)}, RCodeSuccess, false},
+		{"nxdomain is final", []Upstream{plain(nxdomain), plain(good)}, RCodeNameError, false},
+		{"transport error moves on", []Upstream{&Plain{Addr: dead}, plain(good)}, RCodeSuccess, false},
+		{"all server errors return the last", []Upstream{plain(refused), plain(servfail)}, RCodeServerFailure, false},
+		{"all transport errors", []Upstream{&Plain{Addr: dead}}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Upstreams: tt.upstreams, Timeout: 500 * time.Millisecond, Attempts: 2, UDPSize: DefaultUDPSize}
+			resp, err := c.Query(context.Background(), "host.example.", TypeA)
+			if tt.wantErr {
+				var ue *UpstreamError
+				if !errors.As(err, &ue) || ue.Upstream != dead.String() {
+					t.Errorf("Query error = %v, want an UpstreamError of %s", err, dead)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.RCode != tt.want {
+				t.Errorf("rcode %s, want %s", resp.RCode, tt.want)
+			}
+		})
+	}
+	if atomic.LoadInt32(&sawEDNS) == 0 {
+		t.Error("client did not advertise its UDP size")
+	}
+
+	if _, err := (&Client{}).Query(context.Background(), "host.example.", TypeA); !errors.Is(err, ErrNoUpstreams) {
+		t.Errorf("no upstreams: %v", err)
+	}
+}
+
+func TestClientRotate(t *testing.T) {
+	first := stub(func(req *Message) *Message { return reply(req, RCodeSuccess, "192.0.2.1") }, nil)
+	second := stub(func(req *Message) *Message { return reply(req, RCodeSuccess, "192.0.2.2") }, nil)
+	c := &Client{
+		Upstreams: []Upstream{&Plain{Addr: first.Start(t)}, &Plain{Addr: second.Start(t)}},
+		Timeout:   time.Second,
+		Rotate:    true,
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := c.Query(context.Background(), "host.example.", TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, b := first.UDPHits(), second.UDPHits(); a != 2 || b != 2 {
+		t.Errorf("rotate spread %d/%d, want 2/2", a, b)
+	}
+}
@@ -0,0 +1,64 @@
+package dnsclient
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UpstreamResult is the outcome of one upstream in ExchangeAll.
+type UpstreamResult struct {
+	Upstream string
+	Response *Message
+	RTT      time.Duration
+	Err      error
+}
+
+// ExchangeAll asks every upstream the same question concurrently,
+// e.g. to compare encrypted resolvers with the system ones.
+func ExchangeAll(ctx context.Context, ups []Upstream, name string, t Type) []UpstreamResult {
+	results := make([]UpstreamResult, len(ups))
+	var wg sync.WaitGroup
+	for i := range ups {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			resp, err := ups[i].Exchange(ctx, NewQuery(name, t))
+			results[i] = UpstreamResult{Upstream: ups[i].String(), Response: resp, RTT: time.Since(start), Err: err}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// SameAnswers compares rcode and answer rdata ignoring order and TTLs.
+func SameAnswers(a, b *Message) bool {
+	if a.RCode != b.RCode {
+		return false
+	}
+	sa, sb := answerSet(a), answerSet(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func answerSet(m *Message) []string {
+	set := make([]string, 0, len(m.Answers))
+	for _, rr := range m.Answers {
+		data := ""
+		if rr.Data != nil {
+			data = rr.Data.String()
+		}
+		set = append(set, CanonicalName(rr.Name)+" "+rr.Type.String()+" "+data)
+	}
+	sort.Strings(set)
+	return set
+}
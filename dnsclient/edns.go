@@ -0,0 +1,66 @@
+package dnsclient
+
+import (
+	"net/netip"
+)
+
+const (
+	// DefaultUDPSize follows the DNS flag day 2020 recommendation
+	DefaultUDPSize = 1232
+
+	ednsDOBit = 1 << 15
+)
+
+// OPT returns the EDNS0 pseudo record of the message or nil.
+func (m *Message) OPT() *Resource {
+	for i := range m.Additionals {
+		if m.Additionals[i].Type == TypeOPT {
+			return &m.Additionals[i]
+		}
+	}
+	return nil
+}
+
+// SetEDNS0 adds or replaces the OPT record, do sets the DNSSEC OK bit.
+func (m *Message) SetEDNS0(udpSize uint16, do bool) {
+	var ttl uint32
+	if do {
+		ttl |= ednsDOBit
+	}
+	opt := Resource{Name: ".", Type: TypeOPT, Class: Class(udpSize), TTL: ttl, Data: &OPT{}}
+	if cur := m.OPT(); cur != nil {
+		opt.Data = cur.Data
+		*cur = opt
+		return
+	}
+	m.Additionals = append(m.Additionals, opt)
+}
+
+// UDPSize is the requestor's payload size advertised by an OPT record.
+func (r *Resource) UDPSize() uint16 {
+	return uint16(r.Class)
+}
+
+// DO reports the DNSSEC OK bit of an OPT record.
+func (r *Resource) DO() bool {
+	return r.TTL&ednsDOBit != 0
+}
+
+// EDNSVersion of an OPT record.
+func (r *Resource) EDNSVersion() uint8 {
+	return uint8(r.TTL >> 16)
+}
+
+// AnswerAddrs collects the A and AAAA records of the answer section.
+func (m *Message) AnswerAddrs() []netip.Addr {
+	addrs := make([]netip.Addr, 0)
+	for _, rr := range m.Answers {
+		switch d := rr.Data.(type) {
+		case *A:
+			addrs = append(addrs, d.Addr)
+		case *AAAA:
+			addrs = append(addrs, d.Addr)
+		}
+	}
+	return addrs
+}
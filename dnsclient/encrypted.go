@@ -0,0 +1,222 @@
+package dnsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	dohMediaType = "application/dns-message"
+	dotPort      = "853"
+)
+
+var ErrPinMismatch = errors.New("no certificate matches the pinned public keys")
+
+// TLSOptions configures DoH and DoT upstreams.
+type TLSOptions struct {
+	ServerName string // SNI, defaults to the upstream host name
+	// Pins are SHA-256 digests of the SubjectPublicKeyInfo of the leaf
+	// certificate. With pins set, chain validation is replaced by the pin
+	// check so self-signed servers work.
+	Pins    [][]byte
+	RootCAs *x509.CertPool
+}
+
+func (o TLSOptions) config(host string) *tls.Config {
+	cfg := &tls.Config{
+		ServerName: o.ServerName,
+		RootCAs:    o.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if len(o.Pins) != 0 {
+		pins := o.Pins
+		cfg.InsecureSkipVerify = true
+		// only the leaf, the handshake proves nothing about the other
+		// certificates the peer sends
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrPinMismatch
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if subtle.ConstantTimeCompare(sum[:], pin) == 1 {
+					return nil
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+	return cfg
+}
+
+// PinOf returns the pin of a certificate for TLSOptions.Pins.
+func PinOf(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// DoT is DNS over TLS, RFC 7858.
+type DoT struct {
+	Addr string // host:port, port 853 if omitted
+	TLS  TLSOptions
+}
+
+func (d *DoT) String() string {
+	return "tls://" + d.Addr
+}
+
+func (d *DoT) Exchange(ctx context.Context, msg *Message) (*Message, error) {
+	addr := d.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), dotPort)
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	dialer := &tls.Dialer{Config: d.TLS.config(host)}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return exchangeStream(ctx, conn, msg)
+}
+
+// DoH is DNS over HTTPS, RFC 8484.
+type DoH struct {
+	URL string // https://host/dns-query
+	// GET puts the query in the URL, cache friendly, POST is the default.
+	GET bool
+	TLS TLSOptions
+	// Bootstrap is dialed instead of resolving the URL host, no system DNS involved.
+	Bootstrap netip.AddrPort
+
+	once   sync.Once
+	client *http.Client
+}
+
+func (d *DoH) String() string {
+	return d.URL
+}
+
+func (d *DoH) httpClient() *http.Client {
+	d.once.Do(func() {
+		host := ""
+		if u, err := url.Parse(d.URL); err == nil {
+			host = u.Hostname()
+		}
+		transport := &http.Transport{
+			TLSClientConfig:   d.TLS.config(host),
+			ForceAttemptHTTP2: true,
+		}
+		if d.Bootstrap.IsValid() {
+			bootstrap := d.Bootstrap.String()
+			transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, bootstrap)
+			}
+		}
+		d.client = &http.Client{Transport: transport}
+	})
+	return d.client
+}
+
+func (d *DoH) Exchange(ctx context.Context, msg *Message) (*Message, error) {
+	// id 0 keeps GET responses cacheable, section 4.1
+	req := *msg
+	req.ID = 0
+	b, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+	var hreq *http.Request
+	if d.GET {
+		u, err := url.Parse(d.URL)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("dns", base64.RawURLEncoding.EncodeToString(b))
+		u.RawQuery = q.Encode()
+		hreq, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		hreq, err = http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		hreq.Header.Set("Content-Type", dohMediaType)
+	}
+	hreq.Header.Set("Accept", dohMediaType)
+	hresp, err := d.httpClient().Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh server returned %s", hresp.Status)
+	}
+	if ct := hresp.Header.Get("Content-Type"); !strings.HasPrefix(ct, dohMediaType) {
+		return nil, fmt.Errorf("doh server returned content type %q", ct)
+	}
+	data, err := io.ReadAll(io.LimitReader(hresp.Body, maxMsgLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMsgLen {
+		return nil, errors.New("doh response too long")
+	}
+	resp := new(Message)
+	if err = resp.Unpack(data); err != nil {
+		return nil, err
+	}
+	if err = checkReply(&req, resp); err != nil {
+		return nil, err
+	}
+	resp.ID = msg.ID
+	return resp, nil
+}
+
+// ParseUpstream accepts "https://host/path" for DoH, "tls://host[:port]"
+// for DoT and "udp://", "tcp://" or a bare address for plain DNS.
+// opts is only used by the encrypted transports.
+func ParseUpstream(s string, opts TLSOptions) (Upstream, error) {
+	scheme, rest, hasScheme := strings.Cut(s, "://")
+	if !hasScheme {
+		scheme, rest = "udp", s
+	}
+	switch scheme {
+	case "https":
+		return &DoH{URL: s, TLS: opts}, nil
+	case "tls":
+		return &DoT{Addr: rest, TLS: opts}, nil
+	case "udp", "tcp":
+		ap, err := netip.ParseAddrPort(rest)
+		if err != nil {
+			addr, err2 := netip.ParseAddr(strings.Trim(rest, "[]"))
+			if err2 != nil {
+				return nil, err
+			}
+			ap = netip.AddrPortFrom(addr, 53)
+		}
+		return &Plain{Addr: ap, UseTCP: scheme == "tcp"}, nil
+	}
+	return nil, fmt.Errorf("unsupported upstream scheme %q", scheme)
+}
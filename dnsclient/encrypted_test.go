@@ -0,0 +1,247 @@
+package dnsclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/internal/dnstest"
+)
+
+// selfSigned makes a certificate for dot.test and 127.0.0.1.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dot.test"},
+		DNSNames:              []string{"dot.test"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// startDoT serves length prefixed messages over TLS on loopback.
+func startDoT(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go dnstest.ServeStream(l, handler(func(req *Message) *Message { return reply(req, RCodeSuccess, "192.0.2.53") }))
+	return l.Addr().String()
+}
+
+func TestDoTPins(t *testing.T) {
+	cert, leaf := selfSigned(t)
+	_, other := selfSigned(t)
+	addr := startDoT(t, cert)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	tests := []struct {
+		name    string
+		opts    TLSOptions
+		wantErr error // nil means success, errAny any failure
+	}{
+		{"pin match", TLSOptions{Pins: [][]byte{PinOf(other), PinOf(leaf)}}, nil},
+		{"pin mismatch", TLSOptions{Pins: [][]byte{PinOf(other)}}, ErrPinMismatch},
+		{"trusted root", TLSOptions{ServerName: "dot.test", RootCAs: roots}, nil},
+		{"wrong server name", TLSOptions{ServerName: "other.test", RootCAs: roots}, errAny},
+		{"untrusted", TLSOptions{}, errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			up := &DoT{Addr: addr, TLS: tt.opts}
+			resp, err := up.Exchange(ctx, NewQuery("example.", TypeA))
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatal(err)
+			case tt.wantErr == nil:
+				if got := resp.AnswerAddrs(); len(got) != 1 || got[0] != netip.MustParseAddr("192.0.2.53") {
+					t.Errorf("answer = %v", got)
+				}
+			case err == nil:
+				t.Error("exchange succeeded")
+			case tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var errAny = errors.New("any error")
+
+// withExtra sends the pinned certificate as an extra chain entry behind cert.
+func withExtra(cert tls.Certificate, pinned *x509.Certificate) tls.Certificate {
+	cert.Certificate = append(cert.Certificate[:1:1], pinned.Raw)
+	return cert
+}
+
+func TestDoTPinBehindLeaf(t *testing.T) {
+	cert, _ := selfSigned(t)
+	_, pinned := selfSigned(t)
+	addr := startDoT(t, withExtra(cert, pinned))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	up := &DoT{Addr: addr, TLS: TLSOptions{Pins: [][]byte{PinOf(pinned)}}}
+	if _, err := up.Exchange(ctx, NewQuery("example.", TypeA)); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("pin on an extra chain entry: %v, want ErrPinMismatch", err)
+	}
+}
+
+// dohRecorder remembers how the last query arrived.
+type dohRecorder struct {
+	mu          sync.Mutex
+	method      string
+	contentType string
+	accept      string
+	id          uint16
+	respType    string // Content-Type of the reply
+}
+
+func (rec *dohRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		b, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		b, err = io.ReadAll(r.Body)
+	}
+	req := new(Message)
+	if err != nil || req.Unpack(b) != nil {
+		http.Error(w, "bad query", http.StatusBadRequest)
+		return
+	}
+	rec.mu.Lock()
+	rec.method, rec.contentType, rec.accept, rec.id = r.Method, r.Header.Get("Content-Type"), r.Header.Get("Accept"), req.ID
+	respType := rec.respType
+	rec.mu.Unlock()
+	out, _ := reply(req, RCodeSuccess, "192.0.2.80").Pack()
+	w.Header().Set("Content-Type", respType)
+	w.Write(out)
+}
+
+func TestDoHExchange(t *testing.T) {
+	rec := &dohRecorder{respType: dohMediaType}
+	srv := httptest.NewTLSServer(rec)
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	for _, get := range []bool{false, true} {
+		up := &DoH{URL: srv.URL + "/dns-query", GET: get, TLS: TLSOptions{RootCAs: roots}}
+		msg := NewQuery("example.", TypeA)
+		msg.ID = 0x1234
+		resp, err := up.Exchange(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("get %v: %v", get, err)
+		}
+		// the caller's id is restored after the id 0 round trip
+		if resp.ID != 0x1234 || len(resp.AnswerAddrs()) != 1 {
+			t.Errorf("get %v: id %#x answers %v", get, resp.ID, resp.AnswerAddrs())
+		}
+		rec.mu.Lock()
+		wantMethod, wantType := http.MethodPost, dohMediaType
+		if get {
+			wantMethod, wantType = http.MethodGet, ""
+		}
+		if rec.method != wantMethod || rec.contentType != wantType || rec.accept != dohMediaType || rec.id != 0 {
+			t.Errorf("get %v: server saw %s content type %q accept %q id %d",
+				get, rec.method, rec.contentType, rec.accept, rec.id)
+		}
+		rec.mu.Unlock()
+	}
+
+	rec.mu.Lock()
+	rec.respType = "text/plain"
+	rec.mu.Unlock()
+	up := &DoH{URL: srv.URL + "/dns-query", TLS: TLSOptions{RootCAs: roots}}
+	if _, err := up.Exchange(context.Background(), NewQuery("example.", TypeA)); err == nil {
+		t.Error("reply with a wrong content type accepted")
+	}
+}
+
+func TestDoHStatus(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	up := &DoH{URL: srv.URL, TLS: TLSOptions{Pins: [][]byte{PinOf(srv.Certificate())}}}
+	if _, err := up.Exchange(context.Background(), NewQuery("example.", TypeA)); err == nil {
+		t.Error("403 accepted")
+	}
+}
+
+func TestDoHPins(t *testing.T) {
+	srv := httptest.NewTLSServer(&dohRecorder{respType: dohMediaType})
+	defer srv.Close()
+	_, other := selfSigned(t)
+
+	// pinned, no CA pool needed for the self-signed test certificate
+	up := &DoH{URL: srv.URL, TLS: TLSOptions{Pins: [][]byte{PinOf(srv.Certificate())}}}
+	if _, err := up.Exchange(context.Background(), NewQuery("example.", TypeA)); err != nil {
+		t.Fatalf("pin match: %v", err)
+	}
+
+	up = &DoH{URL: srv.URL, TLS: TLSOptions{Pins: [][]byte{PinOf(other)}}}
+	if _, err := up.Exchange(context.Background(), NewQuery("example.", TypeA)); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("pin mismatch: %v, want ErrPinMismatch", err)
+	}
+
+	extra := httptest.NewUnstartedServer(&dohRecorder{respType: dohMediaType})
+	cert, _ := selfSigned(t)
+	extra.TLS = &tls.Config{Certificates: []tls.Certificate{withExtra(cert, other)}}
+	extra.StartTLS()
+	defer extra.Close()
+	up = &DoH{URL: extra.URL, TLS: TLSOptions{Pins: [][]byte{PinOf(other)}}}
+	if _, err := up.Exchange(context.Background(), NewQuery("example.", TypeA)); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("pin on an extra chain entry: %v, want ErrPinMismatch", err)
+	}
+
+	// the bootstrap address is dialed whatever the URL host resolves to
+	up = &DoH{
+		URL:       "https://doh.invalid/dns-query",
+		TLS:       TLSOptions{Pins: [][]byte{PinOf(srv.Certificate())}},
+		Bootstrap: srv.Listener.Addr().(*net.TCPAddr).AddrPort(),
+	}
+	if _, err := up.Exchange(context.Background(), NewQuery("example.", TypeA)); err != nil {
+		t.Errorf("bootstrap: %v", err)
+	}
+}
@@ -0,0 +1,540 @@
+package dnsclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Wire format, RFC 1035 section 4.
+
+type Type uint16
+
+const (
+	TypeA     Type = 1
+	TypeNS    Type = 2
+	TypeCNAME Type = 5
+	TypeSOA   Type = 6
+	TypePTR   Type = 12
+	TypeMX    Type = 15
+	TypeTXT   Type = 16
+	TypeAAAA  Type = 28
+	TypeSRV   Type = 33
+	TypeOPT   Type = 41
+	TypeTSIG  Type = 250
+	TypeANY   Type = 255
+)
+
+var typeNames = map[Type]string{
+	TypeA: "A", TypeNS: "NS", TypeCNAME: "CNAME", TypeSOA: "SOA", TypePTR: "PTR", TypeMX: "MX",
+	TypeTXT: "TXT", TypeAAAA: "AAAA", TypeSRV: "SRV", TypeOPT: "OPT", TypeTSIG: "TSIG",
+	TypeANY: "ANY",
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+type Class uint16
+
+const (
+	ClassINET  Class = 1
+	ClassCHAOS Class = 3
+	ClassNONE  Class = 254
+	ClassANY   Class = 255
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassINET:
+		return "IN"
+	case ClassCHAOS:
+		return "CH"
+	case ClassNONE:
+		return "NONE"
+	case ClassANY:
+		return "ANY"
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+type RCode uint16
+
+const (
+	RCodeSuccess        RCode = 0
+	RCodeFormatError    RCode = 1
+	RCodeServerFailure  RCode = 2
+	RCodeNameError      RCode = 3 // NXDOMAIN
+	RCodeNotImplemented RCode = 4
+	RCodeRefused        RCode = 5
+	// RFC 2136 dynamic update
+	RCodeYXDomain RCode = 6
+	RCodeYXRRSet  RCode = 7
+	RCodeNXRRSet  RCode = 8
+	RCodeNotAuth  RCode = 9
+	RCodeNotZone  RCode = 10
+	// TSIG error field, RFC 8945
+	RCodeBadSig  RCode = 16
+	RCodeBadKey  RCode = 17
+	RCodeBadTime RCode = 18
+)
+
+var rcodeNames = map[RCode]string{
+	RCodeSuccess: "NOERROR", RCodeFormatError: "FORMERR", RCodeServerFailure: "SERVFAIL",
+	RCodeNameError: "NXDOMAIN", RCodeNotImplemented: "NOTIMP", RCodeRefused: "REFUSED",
+	RCodeYXDomain: "YXDOMAIN", RCodeYXRRSet: "YXRRSET", RCodeNXRRSet: "NXRRSET", RCodeNotAuth: "NOTAUTH",
+	RCodeNotZone: "NOTZONE", RCodeBadSig: "BADSIG", RCodeBadKey: "BADKEY", RCodeBadTime: "BADTIME",
+}
+
+func (rc RCode) String() string {
+	if s, ok := rcodeNames[rc]; ok {
+		return s
+	}
+	return "RCODE" + strconv.Itoa(int(rc))
+}
+
+const (
+	OpcodeQuery  uint8 = 0
+	OpcodeStatus uint8 = 2
+	OpcodeNotify uint8 = 4
+	OpcodeUpdate uint8 = 5
+
+	headerLen    = 12
+	maxLabelLen  = 63
+	maxNameLen   = 255
+	maxPtrFollow = 32
+)
+
+var (
+	ErrShortBuffer  = errors.New("dns message too short")
+	ErrLabelTooLong = errors.New("dns label longer than 63 octets")
+	ErrNameTooLong  = errors.New("dns name longer than 255 octets")
+	ErrBadPointer   = errors.New("dns name compression pointer invalid")
+)
+
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	// lower 4 bits go into the header, the rest into the OPT record
+	RCode RCode
+}
+
+func (h Header) flags() uint16 {
+	f := uint16(h.Opcode&0xf)<<11 | uint16(h.RCode&0xf)
+	if h.Response {
+		f |= 1 << 15
+	}
+	if h.Authoritative {
+		f |= 1 << 10
+	}
+	if h.Truncated {
+		f |= 1 << 9
+	}
+	if h.RecursionDesired {
+		f |= 1 << 8
+	}
+	if h.RecursionAvailable {
+		f |= 1 << 7
+	}
+	if h.AuthenticData {
+		f |= 1 << 5
+	}
+	if h.CheckingDisabled {
+		f |= 1 << 4
+	}
+	return f
+}
+
+func (h *Header) setFlags(f uint16) {
+	h.Response = f&(1<<15) != 0
+	h.Opcode = uint8(f>>11) & 0xf
+	h.Authoritative = f&(1<<10) != 0
+	h.Truncated = f&(1<<9) != 0
+	h.RecursionDesired = f&(1<<8) != 0
+	h.RecursionAvailable = f&(1<<7) != 0
+	h.AuthenticData = f&(1<<5) != 0
+	h.CheckingDisabled = f&(1<<4) != 0
+	h.RCode = RCode(f & 0xf)
+}
+
+type Question struct {
+	Name  string
+	Type  Type
+	Class Class
+}
+
+func (q Question) String() string {
+	return fmt.Sprintf("%s\t%s\t%s", q.Name, q.Class, q.Type)
+}
+
+// Resource is a resource record. Data is nil for an empty RDATA,
+// as used by dynamic update deletions.
+type Resource struct {
+	Name  string
+	Type  Type
+	Class Class
+	TTL   uint32
+	Data  RData
+}
+
+func (r Resource) String() string {
+	data := ""
+	if r.Data != nil {
+		data = r.Data.String()
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", r.Name, r.TTL, r.Class, r.Type, data)
+}
+
+// Message is a complete DNS message. For UPDATE messages the sections are
+// zone, prerequisite, update and additional in that order (RFC 2136).
+type Message struct {
+	Header
+	Questions   []Question
+	Answers     []Resource
+	Authorities []Resource
+	Additionals []Resource
+}
+
+// NewQuery builds a recursive query for a single question.
+func NewQuery(name string, t Type) *Message {
+	return &Message{
+		Header:    Header{ID: newID(), RecursionDesired: true},
+		Questions: []Question{{Name: Fqdn(name), Type: t, Class: ClassINET}},
+	}
+}
+
+// Pack encodes the message with name compression.
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.flags())
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authorities)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additionals)))
+	comp := make(map[string]int)
+	var err error
+	for _, q := range m.Questions {
+		if b, err = packName(b, q.Name, comp); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, uint16(q.Type))
+		b = appendUint16(b, uint16(q.Class))
+	}
+	for _, section := range [][]Resource{m.Answers, m.Authorities, m.Additionals} {
+		for _, rr := range section {
+			if rr.Type == TypeOPT {
+				// upper 8 bits of the extended rcode
+				rr.TTL = rr.TTL&0x00ffffff | uint32(m.RCode>>4)<<24
+			}
+			if b, err = rr.pack(b, comp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+func (r *Resource) pack(b []byte, comp map[string]int) ([]byte, error) {
+	var err error
+	if b, err = packName(b, r.Name, comp); err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, uint16(r.Type))
+	b = appendUint16(b, uint16(r.Class))
+	b = appendUint32(b, r.TTL)
+	lenOff := len(b)
+	b = appendUint16(b, 0)
+	if r.Data != nil {
+		if b, err = r.Data.pack(b, comp); err != nil {
+			return nil, err
+		}
+	}
+	rdlen := len(b) - lenOff - 2
+	if rdlen > 0xffff {
+		return nil, errors.New("dns rdata too long")
+	}
+	binary.BigEndian.PutUint16(b[lenOff:], uint16(rdlen))
+	return b, nil
+}
+
+// capacity bounds a count from the header by what the rest of the message
+// can hold at least min bytes each, counts are not to be trusted.
+func capacity(count, left, min int) int {
+	if left/min < count {
+		return left / min
+	}
+	return count
+}
+
+// Unpack decodes msg into m.
+func (m *Message) Unpack(msg []byte) error {
+	if len(msg) < headerLen {
+		return ErrShortBuffer
+	}
+	m.ID = binary.BigEndian.Uint16(msg[0:])
+	m.setFlags(binary.BigEndian.Uint16(msg[2:]))
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+	off := headerLen
+	m.Questions = make([]Question, 0, capacity(counts[0], len(msg)-off, 5))
+	for i := 0; i < counts[0]; i++ {
+		name, n, err := unpackName(msg, off)
+		if err != nil {
+			return err
+		}
+		off = n
+		if off+4 > len(msg) {
+			return ErrShortBuffer
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  Type(binary.BigEndian.Uint16(msg[off:])),
+			Class: Class(binary.BigEndian.Uint16(msg[off+2:])),
+		})
+		off += 4
+	}
+	sections := []*[]Resource{&m.Answers, &m.Authorities, &m.Additionals}
+	for i, section := range sections {
+		*section = make([]Resource, 0, capacity(counts[i+1], len(msg)-off, 11))
+		for j := 0; j < counts[i+1]; j++ {
+			var rr Resource
+			var err error
+			if off, err = rr.unpack(msg, off); err != nil {
+				return err
+			}
+			*section = append(*section, rr)
+		}
+	}
+	// extended rcode lives in the OPT record
+	if opt := m.OPT(); opt != nil {
+		m.RCode |= RCode(opt.TTL>>24) << 4
+	}
+	return nil
+}
+
+func (r *Resource) unpack(msg []byte, off int) (int, error) {
+	name, off, err := unpackName(msg, off)
+	if err != nil {
+		return 0, err
+	}
+	if off+10 > len(msg) {
+		return 0, ErrShortBuffer
+	}
+	r.Name = name
+	r.Type = Type(binary.BigEndian.Uint16(msg[off:]))
+	r.Class = Class(binary.BigEndian.Uint16(msg[off+2:]))
+	r.TTL = binary.BigEndian.Uint32(msg[off+4:])
+	rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	if off+rdlen > len(msg) {
+		return 0, ErrShortBuffer
+	}
+	if rdlen == 0 {
+		r.Data = nil
+		return off, nil
+	}
+	r.Data, err = unpackRData(r.Type, msg, off, rdlen)
+	if err != nil {
+		return 0, fmt.Errorf("%s record %s: %w", r.Type, r.Name, err)
+	}
+	return off + rdlen, nil
+}
+
+// Fqdn appends the root label if missing.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") && !strings.HasSuffix(name, `\.`) {
+		return name
+	}
+	return name + "."
+}
+
+// CanonicalName lower-cases a name and makes it fully qualified,
+// for comparison and as a map key.
+func CanonicalName(name string) string {
+	return strings.ToLower(Fqdn(name))
+}
+
+// splitLabels turns presentation format into raw labels, handling \. and \DDD escapes.
+func splitLabels(name string) ([][]byte, error) {
+	if name == "." || name == "" {
+		return nil, nil
+	}
+	labels := make([][]byte, 0, 4)
+	cur := make([]byte, 0, 16)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '\\':
+			if i+3 < len(name) && isDigits(name[i+1:i+4]) {
+				v, _ := strconv.Atoi(name[i+1 : i+4])
+				if v > 255 {
+					return nil, fmt.Errorf("dns name %q: bad escape", name)
+				}
+				cur = append(cur, byte(v))
+				i += 3
+			} else if i+1 < len(name) {
+				cur = append(cur, name[i+1])
+				i++
+			} else {
+				return nil, fmt.Errorf("dns name %q: trailing backslash", name)
+			}
+		case c == '.':
+			if len(cur) == 0 {
+				return nil, fmt.Errorf("dns name %q: empty label", name)
+			}
+			labels = append(labels, cur)
+			cur = make([]byte, 0, 16)
+		default:
+			cur = append(cur, c)
+		}
+	}
+	if len(cur) != 0 {
+		labels = append(labels, cur)
+	}
+	return labels, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// packName appends name in wire format, reusing suffixes already written when comp is not nil.
+func packName(b []byte, name string, comp map[string]int) ([]byte, error) {
+	labels, err := splitLabels(name)
+	if err != nil {
+		return nil, err
+	}
+	total := 1
+	for _, l := range labels {
+		if len(l) > maxLabelLen {
+			return nil, ErrLabelTooLong
+		}
+		total += len(l) + 1
+	}
+	if total > maxNameLen {
+		return nil, ErrNameTooLong
+	}
+	for i := range labels {
+		key := ""
+		if comp != nil {
+			key = string(joinLabels(labels[i:]))
+			if ptr, ok := comp[key]; ok {
+				return appendUint16(b, 0xc000|uint16(ptr)), nil
+			}
+			// pointers are 14 bits
+			if len(b) < 0x3fff {
+				comp[key] = len(b)
+			}
+		}
+		b = append(b, byte(len(labels[i])))
+		b = append(b, labels[i]...)
+	}
+	return append(b, 0), nil
+}
+
+func joinLabels(labels [][]byte) []byte {
+	out := make([]byte, 0, 32)
+	for _, l := range labels {
+		out = append(out, byte(len(l)))
+		out = append(out, l...)
+	}
+	return out
+}
+
+// unpackName reads a possibly compressed name at off, returns it in
+// presentation format and the offset after it.
+func unpackName(msg []byte, off int) (string, int, error) {
+	var sb strings.Builder
+	end := -1
+	follows := 0
+	total := 0
+	for {
+		if off >= len(msg) {
+			return "", 0, ErrShortBuffer
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				if sb.Len() == 0 {
+					return ".", end, nil
+				}
+				return sb.String(), end, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, ErrShortBuffer
+			}
+			total += c + 1
+			if total > maxNameLen {
+				return "", 0, ErrNameTooLong
+			}
+			writeLabel(&sb, msg[off+1:off+1+c])
+			sb.WriteByte('.')
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, ErrShortBuffer
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			follows++
+			if follows > maxPtrFollow {
+				return "", 0, ErrBadPointer
+			}
+			ptr := int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			if ptr >= off {
+				// only backward pointers, avoids loops
+				return "", 0, ErrBadPointer
+			}
+			off = ptr
+		default:
+			return "", 0, fmt.Errorf("dns label type %#x not supported", c&0xc0)
+		}
+	}
+}
+
+func writeLabel(sb *strings.Builder, label []byte) {
+	for _, c := range label {
+		switch {
+		case c == '.' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < '!' || c > '~':
+			fmt.Fprintf(sb, "\\%03d", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
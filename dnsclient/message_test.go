@@ -0,0 +1,239 @@
+package dnsclient
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newMessage keeps every section non-nil, the way Unpack returns them.
+func newMessage(h Header, qs []Question, an, ns, ar []Resource) *Message {
+	m := &Message{Header: h, Questions: qs, Answers: an, Authorities: ns, Additionals: ar}
+	for _, s := range []*[]Resource{&m.Answers, &m.Authorities, &m.Additionals} {
+		if *s == nil {
+			*s = make([]Resource, 0)
+		}
+	}
+	if m.Questions == nil {
+		m.Questions = make([]Question, 0)
+	}
+	return m
+}
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	q := []Question{{Name: "www.example.com.", Type: TypeA, Class: ClassINET}}
+	tests := []struct {
+		name string
+		msg  *Message
+	}{
+		{"query", newMessage(Header{ID: 0xbeef, RecursionDesired: true}, q, nil, nil, nil)},
+		{"no question", newMessage(Header{ID: 1, Response: true, RCode: RCodeFormatError}, nil, nil, nil, nil)},
+		{"flags", newMessage(Header{
+			ID: 2, Response: true, Opcode: OpcodeNotify, Authoritative: true, Truncated: true,
+			RecursionDesired: true, RecursionAvailable: true, AuthenticData: true, CheckingDisabled: true,
+			RCode: RCodeRefused,
+		}, q, nil, nil, nil)},
+		{"answers", newMessage(Header{ID: 3, Response: true, RecursionAvailable: true}, q, []Resource{
+			{Name: "www.example.com.", Type: TypeCNAME, Class: ClassINET, TTL: 300, Data: &NameData{Target: "web.example.com."}},
+			{Name: "web.example.com.", Type: TypeA, Class: ClassINET, TTL: 60, Data: &A{Addr: netip.MustParseAddr("192.0.2.1")}},
+			{Name: "web.example.com.", Type: TypeAAAA, Class: ClassINET, TTL: 60, Data: &AAAA{Addr: netip.MustParseAddr("2001:db8::1")}},
+			{Name: "example.com.", Type: TypeMX, Class: ClassINET, TTL: 3600, Data: &MX{Preference: 10, Exchange: "mail.example.com."}},
+			{Name: "example.com.", Type: TypeTXT, Class: ClassINET, TTL: 3600, Data: &TXT{Strings: []string{"v=spf1 -all", ""}}},
+			{Name: "_sip._udp.example.com.", Type: TypeSRV, Class: ClassINET, TTL: 3600, Data: &SRV{Priority: 1, Weight: 5, Port: 5060, Target: "sip.example.com."}},
+			{Name: "example.com.", Type: Type(99), Class: ClassINET, TTL: 1, Data: &RawData{Bytes: []byte{0xde, 0xad}}},
+		}, []Resource{
+			{Name: "example.com.", Type: TypeSOA, Class: ClassINET, TTL: 900, Data: &SOA{
+				MName: "ns1.example.com.", RName: "hostmaster.example.com.",
+				Serial: 2024010101, Refresh: 7200, Retry: 900, Expire: 1209600, MinTTL: 300,
+			}},
+			{Name: "example.com.", Type: TypeNS, Class: ClassINET, TTL: 900, Data: &NameData{Target: "ns1.example.com."}},
+		}, nil)},
+		{"edns with extended rcode", newMessage(Header{ID: 4, Response: true, RCode: RCodeBadSig}, q, nil, nil, []Resource{
+			{Name: ".", Type: TypeOPT, Class: Class(1232), TTL: 1<<24 | ednsDOBit, Data: &OPT{Options: []EDNSOption{
+				{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+				{Code: 12, Data: []byte{}},
+			}}},
+		})},
+		{"empty rdata", newMessage(Header{ID: 5, Opcode: OpcodeUpdate}, nil, nil, []Resource{
+			{Name: "host.example.com.", Type: TypeANY, Class: ClassANY},
+		}, nil)},
+		{"escaped labels", newMessage(Header{ID: 6}, []Question{
+			{Name: `a\.b.example.`, Type: TypeTXT, Class: ClassINET},
+			{Name: `\000\255x.example.`, Type: TypeTXT, Class: ClassCHAOS},
+			{Name: ".", Type: TypeNS, Class: ClassINET},
+		}, nil, nil, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.msg.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := new(Message)
+			if err = got.Unpack(b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("round trip\n got %+v\nwant %+v", got, tt.msg)
+			}
+			again, err := got.Pack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, b) {
+				t.Errorf("repack differs\n got %x\nwant %x", again, b)
+			}
+		})
+	}
+}
+
+func TestPackCompression(t *testing.T) {
+	msg := newMessage(Header{ID: 7, Response: true},
+		[]Question{{Name: "www.example.com.", Type: TypeNS, Class: ClassINET}},
+		[]Resource{
+			{Name: "www.example.com.", Type: TypeNS, Class: ClassINET, TTL: 60, Data: &NameData{Target: "ns1.EXAMPLE.com."}},
+			{Name: "www.example.com.", Type: TypeSRV, Class: ClassINET, TTL: 60, Data: &SRV{Target: "www.example.com."}},
+		}, nil, nil)
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the question name starts right after the header
+	qEnd := headerLen + len("\x03www\x07example\x03com\x00") + 4
+	if !bytes.Equal(b[qEnd:qEnd+2], []byte{0xc0, headerLen}) {
+		t.Errorf("answer owner %x, want a pointer to the question", b[qEnd:qEnd+2])
+	}
+	// compression is case sensitive on the raw labels, so "ns1.EXAMPLE" only shares "com"
+	if !bytes.Contains(b, []byte("\x03ns1\x07EXAMPLE\xc0")) {
+		t.Errorf("ns target not compressed against com.: %x", b)
+	}
+	// SRV targets must never be compressed
+	if !bytes.HasSuffix(b, []byte("\x03www\x07example\x03com\x00")) {
+		t.Errorf("srv target compressed: %x", b)
+	}
+	got := new(Message)
+	if err = got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("round trip\n got %+v\nwant %+v", got, msg)
+	}
+}
+
+func TestUnpackTruncated(t *testing.T) {
+	msg := newMessage(Header{ID: 8, Response: true},
+		[]Question{{Name: "example.com.", Type: TypeMX, Class: ClassINET}},
+		[]Resource{
+			{Name: "example.com.", Type: TypeMX, Class: ClassINET, TTL: 60, Data: &MX{Preference: 5, Exchange: "mx.example.com."}},
+			{Name: "example.com.", Type: TypeTXT, Class: ClassINET, TTL: 60, Data: &TXT{Strings: []string{"hello"}}},
+		}, nil, []Resource{
+			{Name: ".", Type: TypeOPT, Class: Class(DefaultUDPSize), Data: &OPT{Options: []EDNSOption{{Code: 10, Data: []byte{1, 2}}}}},
+		})
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every byte is accounted for by the header counts, any prefix must fail
+	for n := 0; n < len(b); n++ {
+		err := new(Message).Unpack(b[:n])
+		if !errors.Is(err, ErrShortBuffer) {
+			t.Errorf("unpack of %d/%d bytes: %v, want ErrShortBuffer", n, len(b), err)
+		}
+	}
+}
+
+func TestUnpackMalformed(t *testing.T) {
+	header := func(qd, an uint16) []byte {
+		return []byte{0, 9, 0x81, 0x80, byte(qd >> 8), byte(qd), byte(an >> 8), byte(an), 0, 0, 0, 0}
+	}
+	question := func(name string) []byte {
+		return append([]byte(name), 0, 1, 0, 1)
+	}
+	long := strings.Repeat("\x3f"+strings.Repeat("a", 63), 4) + "\x00"
+	tests := []struct {
+		name string
+		msg  []byte
+		want error
+	}{
+		{"forward pointer", append(header(1, 0), question("\xc0\x20")...), ErrBadPointer},
+		{"self pointer", append(header(1, 0), question("\xc0\x0c")...), ErrBadPointer},
+		{"pointer past end", append(header(1, 0), 0xc0), ErrShortBuffer},
+		{"label past end", append(header(1, 0), question("\x10abc")...), ErrShortBuffer},
+		{"name too long", append(header(1, 0), question(long)...), ErrNameTooLong},
+		{"name too long through pointers", func() []byte {
+			b := append(header(2, 0), question("\x3f"+strings.Repeat("b", 63)+"\x3f"+strings.Repeat("c", 63)+"\x00")...)
+			// two more labels in front of the first question's name
+			return append(b, question("\x3f"+strings.Repeat("d", 63)+"\x3f"+strings.Repeat("e", 63)+"\xc0\x0c")...)
+		}(), ErrNameTooLong},
+		{"short A rdata", append(append(header(1, 1), question("\x00")...),
+			0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 3, 1, 2, 3), ErrShortBuffer},
+		{"rdata past end", append(append(header(1, 1), question("\x00")...),
+			0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 1, 2), ErrShortBuffer},
+		{"mx name past rdata", append(append(header(1, 1), question("\x00")...),
+			0, 0, 15, 0, 1, 0, 0, 0, 60, 0, 4, 0, 5, 3, 'm'), ErrShortBuffer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := new(Message).Unpack(tt.msg)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Unpack = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// reserved label types are rejected, not misread
+	if err := new(Message).Unpack(append(header(1, 0), question("\x40")...)); err == nil {
+		t.Error("label type 0x40 accepted")
+	}
+}
+
+// header counts are not trusted for preallocation
+func TestUnpackHugeCounts(t *testing.T) {
+	msg := []byte{0, 1, 0x81, 0x80, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	err := new(Message).Unpack(msg)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("Unpack = %v, want ErrShortBuffer", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 4096 {
+		t.Errorf("unpacking 12 bytes allocated %d bytes", n)
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		want error
+	}{
+		{strings.Repeat("a", 64) + ".example.", ErrLabelTooLong},
+		{strings.Repeat(strings.Repeat("a", 63)+".", 4), ErrNameTooLong},
+	}
+	for _, tt := range tests {
+		_, err := NewQuery(tt.name, TypeA).Pack()
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Pack(%.20s...) = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	for _, name := range []string{"a..example.", `\300.example.`} {
+		if _, err := NewQuery(name, TypeA).Pack(); err == nil {
+			t.Errorf("Pack(%q) succeeded", name)
+		}
+	}
+	// longest legal name, 255 octets on the wire
+	name := strings.Repeat(strings.Repeat("a", 63)+".", 3) + strings.Repeat("b", 61) + "."
+	b, err := NewQuery(name, TypeA).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Message)
+	if err = got.Unpack(b); err != nil || got.Questions[0].Name != name {
+		t.Errorf("longest name round trip: %v %v", got.Questions, err)
+	}
+}
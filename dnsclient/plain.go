@@ -0,0 +1,178 @@
+package dnsclient
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const maxMsgLen = 65535
+
+// Plain is classic DNS over port 53, UDP first with TCP fallback on truncation.
+type Plain struct {
+	Addr   netip.AddrPort
+	UseTCP bool // always TCP, like "options use-vc"
+}
+
+func (p *Plain) String() string {
+	return p.Addr.String()
+}
+
+func (p *Plain) Exchange(ctx context.Context, msg *Message) (*Message, error) {
+	if !p.UseTCP {
+		resp, err := ExchangeUDP(ctx, p.Addr, msg)
+		if err != nil || !resp.Truncated {
+			return resp, err
+		}
+	}
+	return ExchangeTCP(ctx, p.Addr, msg)
+}
+
+// ExchangeUDP sends msg in one datagram, replies not matching msg are dropped
+// until ctx expires.
+func ExchangeUDP(ctx context.Context, server netip.AddrPort, msg *Message) (*Message, error) {
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := roundTripUDP(ctx, server, b, msg)
+	return resp, err
+}
+
+// roundTripUDP sends the packed b of msg, returning the reply and its wire form.
+func roundTripUDP(ctx context.Context, server netip.AddrPort, b []byte, msg *Message) (*Message, []byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+	if _, err = conn.Write(b); err != nil {
+		return nil, nil, ctxErr(ctx, err)
+	}
+	buf := make([]byte, maxMsgLen)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, nil, ctxErr(ctx, err)
+		}
+		resp := new(Message)
+		if err = resp.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		if checkReply(msg, resp) != nil {
+			continue
+		}
+		return resp, buf[:n], nil
+	}
+}
+
+// ExchangeTCP sends msg over a fresh TCP connection.
+func ExchangeTCP(ctx context.Context, server netip.AddrPort, msg *Message) (*Message, error) {
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := roundTripTCP(ctx, server, b, msg)
+	return resp, err
+}
+
+func roundTripTCP(ctx context.Context, server netip.AddrPort, b []byte, msg *Message) (*Message, []byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	return roundTripStream(ctx, conn, b, msg)
+}
+
+// exchangeStream does one length prefixed exchange, RFC 1035 section 4.2.2.
+// Shared by TCP and TLS.
+func exchangeStream(ctx context.Context, conn net.Conn, msg *Message) (*Message, error) {
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := roundTripStream(ctx, conn, b, msg)
+	return resp, err
+}
+
+func roundTripStream(ctx context.Context, conn net.Conn, b []byte, msg *Message) (*Message, []byte, error) {
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+	if err := WriteStreamMsg(conn, b); err != nil {
+		return nil, nil, ctxErr(ctx, err)
+	}
+	data, err := ReadStreamMsg(conn)
+	if err != nil {
+		return nil, nil, ctxErr(ctx, err)
+	}
+	resp := new(Message)
+	if err = resp.Unpack(data); err != nil {
+		return nil, nil, err
+	}
+	if err = checkReply(msg, resp); err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// WriteStreamMsg writes b with its two byte length prefix.
+func WriteStreamMsg(w io.Writer, b []byte) error {
+	if len(b) > maxMsgLen {
+		return errors.New("dns message too long for stream transport")
+	}
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadStreamMsg reads one length prefixed message.
+func ReadStreamMsg(r io.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// closeOnDone applies the ctx deadline to conn and unblocks it on cancellation.
+func closeOnDone(ctx context.Context, conn net.Conn) func() {
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ctxErr prefers the context error over the i/o timeout it caused.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// the conn deadline may fire just before the context timer does
+	if dl, ok := ctx.Deadline(); ok && !time.Now().Before(dl) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
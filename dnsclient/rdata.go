@@ -0,0 +1,340 @@
+package dnsclient
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// RData is the type specific part of a resource record.
+type RData interface {
+	pack(b []byte, comp map[string]int) ([]byte, error)
+	String() string
+}
+
+type A struct {
+	Addr netip.Addr
+}
+
+type AAAA struct {
+	Addr netip.Addr
+}
+
+// NameData is the rdata of CNAME, NS and PTR records, a single domain name.
+type NameData struct {
+	Target string
+}
+
+type MX struct {
+	Preference uint16
+	Exchange   string
+}
+
+type TXT struct {
+	Strings []string
+}
+
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	MinTTL  uint32
+}
+
+// OPT is the EDNS0 pseudo record data (RFC 6891), the UDP size, extended
+// rcode, version and DO bit live in the class and TTL of its Resource.
+type OPT struct {
+	Options []EDNSOption
+}
+
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+// TSIG is the transaction signature record data (RFC 8945), see tsig.go.
+type TSIG struct {
+	Algorithm  string
+	TimeSigned uint64 // 48 bits, seconds since epoch
+	Fudge      uint16
+	MAC        []byte
+	OriginalID uint16
+	Error      RCode
+	OtherData  []byte
+}
+
+// RawData keeps records of types this package does not decode.
+type RawData struct {
+	Bytes []byte
+}
+
+func (d *A) pack(b []byte, _ map[string]int) ([]byte, error) {
+	if !d.Addr.Is4() {
+		return nil, errors.New("A record needs an IPv4 address")
+	}
+	a4 := d.Addr.As4()
+	return append(b, a4[:]...), nil
+}
+
+func (d *A) String() string { return d.Addr.String() }
+
+func (d *AAAA) pack(b []byte, _ map[string]int) ([]byte, error) {
+	if !d.Addr.Is6() {
+		return nil, errors.New("AAAA record needs an IPv6 address")
+	}
+	a16 := d.Addr.As16()
+	return append(b, a16[:]...), nil
+}
+
+func (d *AAAA) String() string { return d.Addr.String() }
+
+func (d *NameData) pack(b []byte, comp map[string]int) ([]byte, error) {
+	return packName(b, d.Target, comp)
+}
+
+func (d *NameData) String() string { return d.Target }
+
+func (d *MX) pack(b []byte, comp map[string]int) ([]byte, error) {
+	b = appendUint16(b, d.Preference)
+	return packName(b, d.Exchange, comp)
+}
+
+func (d *MX) String() string { return strconv.Itoa(int(d.Preference)) + " " + d.Exchange }
+
+func (d *TXT) pack(b []byte, _ map[string]int) ([]byte, error) {
+	if len(d.Strings) == 0 {
+		// a TXT record holds at least one, possibly empty, string
+		return append(b, 0), nil
+	}
+	for _, s := range d.Strings {
+		if len(s) > 255 {
+			return nil, errors.New("TXT character-string longer than 255 octets")
+		}
+		b = append(b, byte(len(s)))
+		b = append(b, s...)
+	}
+	return b, nil
+}
+
+func (d *TXT) String() string {
+	quoted := make([]string, len(d.Strings))
+	for i, s := range d.Strings {
+		quoted[i] = strconv.Quote(s)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SRV targets are never compressed, RFC 2782.
+func (d *SRV) pack(b []byte, _ map[string]int) ([]byte, error) {
+	b = appendUint16(b, d.Priority)
+	b = appendUint16(b, d.Weight)
+	b = appendUint16(b, d.Port)
+	return packName(b, d.Target, nil)
+}
+
+func (d *SRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", d.Priority, d.Weight, d.Port, d.Target)
+}
+
+func (d *SOA) pack(b []byte, comp map[string]int) ([]byte, error) {
+	var err error
+	if b, err = packName(b, d.MName, comp); err != nil {
+		return nil, err
+	}
+	if b, err = packName(b, d.RName, comp); err != nil {
+		return nil, err
+	}
+	for _, v := range []uint32{d.Serial, d.Refresh, d.Retry, d.Expire, d.MinTTL} {
+		b = appendUint32(b, v)
+	}
+	return b, nil
+}
+
+func (d *SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", d.MName, d.RName, d.Serial, d.Refresh, d.Retry, d.Expire, d.MinTTL)
+}
+
+func (d *OPT) pack(b []byte, _ map[string]int) ([]byte, error) {
+	for _, o := range d.Options {
+		b = appendUint16(b, o.Code)
+		b = appendUint16(b, uint16(len(o.Data)))
+		b = append(b, o.Data...)
+	}
+	return b, nil
+}
+
+func (d *OPT) String() string {
+	parts := make([]string, len(d.Options))
+	for i, o := range d.Options {
+		parts[i] = fmt.Sprintf("%d:%s", o.Code, hex.EncodeToString(o.Data))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (d *TSIG) pack(b []byte, _ map[string]int) ([]byte, error) {
+	// the algorithm name is never compressed
+	b, err := packName(b, d.Algorithm, nil)
+	if err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, uint16(d.TimeSigned>>32))
+	b = appendUint32(b, uint32(d.TimeSigned))
+	b = appendUint16(b, d.Fudge)
+	b = appendUint16(b, uint16(len(d.MAC)))
+	b = append(b, d.MAC...)
+	b = appendUint16(b, d.OriginalID)
+	b = appendUint16(b, uint16(d.Error))
+	b = appendUint16(b, uint16(len(d.OtherData)))
+	return append(b, d.OtherData...), nil
+}
+
+func (d *TSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %s %d %s", d.Algorithm, d.TimeSigned, d.Fudge, len(d.MAC),
+		hex.EncodeToString(d.MAC), d.OriginalID, d.Error)
+}
+
+func (d *RawData) pack(b []byte, _ map[string]int) ([]byte, error) {
+	return append(b, d.Bytes...), nil
+}
+
+// RFC 3597 unknown record format
+func (d *RawData) String() string {
+	return fmt.Sprintf(`\# %d %s`, len(d.Bytes), hex.EncodeToString(d.Bytes))
+}
+
+func unpackRData(t Type, msg []byte, off, rdlen int) (RData, error) {
+	end := off + rdlen
+	rd := msg[off:end]
+	switch t {
+	case TypeA:
+		if rdlen != 4 {
+			return nil, ErrShortBuffer
+		}
+		return &A{Addr: netip.AddrFrom4([4]byte{rd[0], rd[1], rd[2], rd[3]})}, nil
+	case TypeAAAA:
+		if rdlen != 16 {
+			return nil, ErrShortBuffer
+		}
+		var a16 [16]byte
+		copy(a16[:], rd)
+		return &AAAA{Addr: netip.AddrFrom16(a16)}, nil
+	case TypeCNAME, TypeNS, TypePTR:
+		name, _, err := unpackName(msg[:end], off)
+		if err != nil {
+			return nil, err
+		}
+		return &NameData{Target: name}, nil
+	case TypeMX:
+		if rdlen < 3 {
+			return nil, ErrShortBuffer
+		}
+		name, _, err := unpackName(msg[:end], off+2)
+		if err != nil {
+			return nil, err
+		}
+		return &MX{Preference: binary.BigEndian.Uint16(rd), Exchange: name}, nil
+	case TypeTXT:
+		txt := &TXT{Strings: make([]string, 0, 1)}
+		for i := 0; i < len(rd); {
+			l := int(rd[i])
+			if i+1+l > len(rd) {
+				return nil, ErrShortBuffer
+			}
+			txt.Strings = append(txt.Strings, string(rd[i+1:i+1+l]))
+			i += 1 + l
+		}
+		return txt, nil
+	case TypeSRV:
+		if rdlen < 7 {
+			return nil, ErrShortBuffer
+		}
+		name, _, err := unpackName(msg[:end], off+6)
+		if err != nil {
+			return nil, err
+		}
+		return &SRV{
+			Priority: binary.BigEndian.Uint16(rd[0:]),
+			Weight:   binary.BigEndian.Uint16(rd[2:]),
+			Port:     binary.BigEndian.Uint16(rd[4:]),
+			Target:   name,
+		}, nil
+	case TypeSOA:
+		mname, n, err := unpackName(msg[:end], off)
+		if err != nil {
+			return nil, err
+		}
+		rname, n, err := unpackName(msg[:end], n)
+		if err != nil {
+			return nil, err
+		}
+		if n+20 > end {
+			return nil, ErrShortBuffer
+		}
+		return &SOA{
+			MName:   mname,
+			RName:   rname,
+			Serial:  binary.BigEndian.Uint32(msg[n:]),
+			Refresh: binary.BigEndian.Uint32(msg[n+4:]),
+			Retry:   binary.BigEndian.Uint32(msg[n+8:]),
+			Expire:  binary.BigEndian.Uint32(msg[n+12:]),
+			MinTTL:  binary.BigEndian.Uint32(msg[n+16:]),
+		}, nil
+	case TypeTSIG:
+		alg, n, err := unpackName(msg[:end], off)
+		if err != nil {
+			return nil, err
+		}
+		if n+10 > end {
+			return nil, ErrShortBuffer
+		}
+		d := &TSIG{Algorithm: alg}
+		d.TimeSigned = uint64(binary.BigEndian.Uint16(msg[n:]))<<32 | uint64(binary.BigEndian.Uint32(msg[n+2:]))
+		d.Fudge = binary.BigEndian.Uint16(msg[n+6:])
+		macLen := int(binary.BigEndian.Uint16(msg[n+8:]))
+		n += 10
+		if n+macLen+6 > end {
+			return nil, ErrShortBuffer
+		}
+		d.MAC = append([]byte{}, msg[n:n+macLen]...)
+		n += macLen
+		d.OriginalID = binary.BigEndian.Uint16(msg[n:])
+		d.Error = RCode(binary.BigEndian.Uint16(msg[n+2:]))
+		otherLen := int(binary.BigEndian.Uint16(msg[n+4:]))
+		n += 6
+		if n+otherLen > end {
+			return nil, ErrShortBuffer
+		}
+		d.OtherData = append([]byte{}, msg[n:n+otherLen]...)
+		return d, nil
+	case TypeOPT:
+		opt := &OPT{Options: make([]EDNSOption, 0)}
+		for i := 0; i < len(rd); {
+			if i+4 > len(rd) {
+				return nil, ErrShortBuffer
+			}
+			code := binary.BigEndian.Uint16(rd[i:])
+			l := int(binary.BigEndian.Uint16(rd[i+2:]))
+			if i+4+l > len(rd) {
+				return nil, ErrShortBuffer
+			}
+			opt.Options = append(opt.Options, EDNSOption{Code: code, Data: append([]byte{}, rd[i+4:i+4+l]...)})
+			i += 4 + l
+		}
+		return opt, nil
+	}
+	return &RawData{Bytes: append([]byte{}, rd...)}, nil
+}
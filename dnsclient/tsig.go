@@ -0,0 +1,235 @@
+package dnsclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// TSIG algorithm names, RFC 8945 section 6
+const (
+	HmacSHA1   = "hmac-sha1."
+	HmacSHA256 = "hmac-sha256."
+	HmacSHA512 = "hmac-sha512."
+
+	defaultFudge = 300
+)
+
+var (
+	ErrTSIGAlgorithm = errors.New("unsupported tsig algorithm")
+	ErrTSIGMissing   = errors.New("dns reply is not signed")
+	ErrTSIGBadMAC    = errors.New("dns reply tsig mac mismatch")
+	ErrTSIGBadTime   = errors.New("dns reply tsig time outside fudge")
+)
+
+var tsigHashes = map[string]func() hash.Hash{
+	HmacSHA1:   sha1.New,
+	HmacSHA256: sha256.New,
+	HmacSHA512: sha512.New,
+}
+
+// TSIGError is the error field of a TSIG record sent back by the server.
+type TSIGError struct {
+	RCode RCode
+}
+
+func (e *TSIGError) Error() string {
+	return "dns tsig error " + e.RCode.String()
+}
+
+// TSIGKey is a shared secret for transaction signatures.
+type TSIGKey struct {
+	Name      string // key name, "ddns-key."
+	Algorithm string // HmacSHA256 when empty
+	Secret    []byte
+	Fudge     uint16 // allowed clock skew in seconds, 300 when 0
+}
+
+// ParseTSIGKey reads "[algorithm:]name:base64secret", the nsupdate -y format.
+func ParseTSIGKey(s string) (*TSIGKey, error) {
+	parts := strings.Split(s, ":")
+	key := &TSIGKey{Algorithm: HmacSHA256}
+	switch len(parts) {
+	case 2:
+	case 3:
+		key.Algorithm = Fqdn(strings.ToLower(parts[0]))
+		parts = parts[1:]
+	default:
+		return nil, errors.New("tsig key must be [algorithm:]name:secret")
+	}
+	secret, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	key.Name, key.Secret = Fqdn(parts[0]), secret
+	if _, ok := tsigHashes[key.Algorithm]; !ok {
+		return nil, ErrTSIGAlgorithm
+	}
+	return key, nil
+}
+
+func (k *TSIGKey) algorithm() string {
+	if k.Algorithm == "" {
+		return HmacSHA256
+	}
+	return CanonicalName(k.Algorithm)
+}
+
+func (k *TSIGKey) fudge() uint16 {
+	if k.Fudge == 0 {
+		return defaultFudge
+	}
+	return k.Fudge
+}
+
+// Sign packs msg with a TSIG record appended, requestMAC is set when
+// signing a response. It returns the wire form and the MAC.
+func (k *TSIGKey) Sign(msg *Message, requestMAC []byte, now time.Time) ([]byte, []byte, error) {
+	newHash, ok := tsigHashes[k.algorithm()]
+	if !ok {
+		return nil, nil, ErrTSIGAlgorithm
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &TSIG{
+		Algorithm:  k.algorithm(),
+		TimeSigned: uint64(now.Unix()),
+		Fudge:      k.fudge(),
+		OriginalID: msg.ID,
+	}
+	mac := hmac.New(newHash, k.Secret)
+	mac.Write(tsigDigestInput(b, requestMAC, k.Name, t))
+	t.MAC = mac.Sum(nil)
+
+	rr := Resource{Name: k.Name, Type: TypeTSIG, Class: ClassANY, Data: t}
+	// the TSIG owner name is never compressed
+	if b, err = rr.pack(b, nil); err != nil {
+		return nil, nil, err
+	}
+	binary.BigEndian.PutUint16(b[10:], binary.BigEndian.Uint16(b[10:])+1)
+	return b, t.MAC, nil
+}
+
+// Verify checks the TSIG record closing wire, the reply to a request
+// signed with requestMAC.
+func (k *TSIGKey) Verify(wire []byte, requestMAC []byte, now time.Time) error {
+	start, err := lastRecordOffset(wire)
+	if err != nil {
+		return err
+	}
+	var rr Resource
+	if _, err = rr.unpack(wire, start); err != nil {
+		return err
+	}
+	t, ok := rr.Data.(*TSIG)
+	if !ok || rr.Type != TypeTSIG {
+		return ErrTSIGMissing
+	}
+	if t.Error != RCodeSuccess {
+		return &TSIGError{RCode: t.Error}
+	}
+	if CanonicalName(rr.Name) != CanonicalName(k.Name) || CanonicalName(t.Algorithm) != k.algorithm() {
+		return &TSIGError{RCode: RCodeBadKey}
+	}
+	newHash, ok := tsigHashes[k.algorithm()]
+	if !ok {
+		return ErrTSIGAlgorithm
+	}
+	// the digest covers the message as it was before signing
+	stripped := append([]byte{}, wire[:start]...)
+	binary.BigEndian.PutUint16(stripped[0:], t.OriginalID)
+	binary.BigEndian.PutUint16(stripped[10:], binary.BigEndian.Uint16(stripped[10:])-1)
+	mac := hmac.New(newHash, k.Secret)
+	mac.Write(tsigDigestInput(stripped, requestMAC, rr.Name, t))
+	if !hmac.Equal(mac.Sum(nil), t.MAC) {
+		return ErrTSIGBadMAC
+	}
+	signed := int64(t.TimeSigned)
+	if d := now.Unix() - signed; d > int64(t.Fudge) || -d > int64(t.Fudge) {
+		return ErrTSIGBadTime
+	}
+	return nil
+}
+
+// tsigDigestInput builds the data covered by the MAC, RFC 8945 section 4.3.
+func tsigDigestInput(msg, requestMAC []byte, keyName string, t *TSIG) []byte {
+	b := make([]byte, 0, len(msg)+len(requestMAC)+64)
+	if requestMAC != nil {
+		b = appendUint16(b, uint16(len(requestMAC)))
+		b = append(b, requestMAC...)
+	}
+	b = append(b, msg...)
+	// names in canonical form, lowercase and uncompressed
+	b, _ = packName(b, CanonicalName(keyName), nil)
+	b = appendUint16(b, uint16(ClassANY))
+	b = appendUint32(b, 0)
+	b, _ = packName(b, CanonicalName(t.Algorithm), nil)
+	b = appendUint16(b, uint16(t.TimeSigned>>32))
+	b = appendUint32(b, uint32(t.TimeSigned))
+	b = appendUint16(b, t.Fudge)
+	b = appendUint16(b, uint16(t.Error))
+	b = appendUint16(b, uint16(len(t.OtherData)))
+	return append(b, t.OtherData...)
+}
+
+// lastRecordOffset finds where the last resource record of msg starts.
+func lastRecordOffset(msg []byte) (int, error) {
+	if len(msg) < headerLen {
+		return 0, ErrShortBuffer
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rrs := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	if rrs == 0 {
+		return 0, ErrTSIGMissing
+	}
+	off := headerLen
+	for i := 0; i < qd; i++ {
+		_, n, err := unpackName(msg, off)
+		if err != nil {
+			return 0, err
+		}
+		off = n + 4
+	}
+	last := off
+	for i := 0; i < rrs; i++ {
+		last = off
+		var rr Resource
+		n, err := rr.unpack(msg, off)
+		if err != nil {
+			return 0, err
+		}
+		off = n
+	}
+	return last, nil
+}
+
+// ExchangeSigned sends msg signed with key to server, over UDP with TCP
+// fallback on truncation, and verifies the signature of the reply.
+func ExchangeSigned(ctx context.Context, server netip.AddrPort, msg *Message, key *TSIGKey) (*Message, error) {
+	b, mac, err := key.Sign(msg, nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp, wire, err := roundTripUDP(ctx, server, b, msg)
+	if err == nil && resp.Truncated {
+		resp, wire, err = roundTripTCP(ctx, server, b, msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = key.Verify(wire, mac, time.Now()); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
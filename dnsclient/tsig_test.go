@@ -0,0 +1,230 @@
+package dnsclient
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testKey = &TSIGKey{Name: "ddns-key.example.", Secret: []byte("0123456789abcdef0123456789abcdef")}
+
+// updateMsg adds a CNAME in zone example.
+func updateMsg() *Message {
+	return newMessage(Header{ID: 0x4242, Opcode: OpcodeUpdate},
+		[]Question{{Name: "example.", Type: TypeSOA, Class: ClassINET}}, nil, []Resource{
+			{Name: "host.example.", Type: TypeCNAME, Class: ClassINET, TTL: 60, Data: &NameData{Target: "target.example."}},
+		}, nil)
+}
+
+func TestTSIGRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, alg := range []string{HmacSHA1, HmacSHA256, HmacSHA512, ""} {
+		key := &TSIGKey{Name: testKey.Name, Algorithm: alg, Secret: testKey.Secret}
+		wire, mac, err := key.Sign(updateMsg(), nil, now)
+		if err != nil {
+			t.Fatalf("%q: %v", alg, err)
+		}
+		if err = key.Verify(wire, nil, now); err != nil {
+			t.Errorf("%q: verify: %v", alg, err)
+		}
+
+		got := new(Message)
+		if err = got.Unpack(wire); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Additionals) != 1 {
+			t.Fatalf("%q: %d additionals, want the TSIG record", alg, len(got.Additionals))
+		}
+		rr := got.Additionals[0]
+		tsig, ok := rr.Data.(*TSIG)
+		if !ok || rr.Class != ClassANY || rr.TTL != 0 || rr.Name != key.Name {
+			t.Fatalf("%q: tsig record %v", alg, rr)
+		}
+		if tsig.Algorithm != key.algorithm() || tsig.TimeSigned != uint64(now.Unix()) ||
+			tsig.Fudge != defaultFudge || tsig.OriginalID != 0x4242 || !bytes.Equal(tsig.MAC, mac) {
+			t.Errorf("%q: tsig rdata %v", alg, tsig)
+		}
+	}
+}
+
+// TestTSIGDigest recomputes the MAC from the RFC 8945 section 4.3.3 layout.
+func TestTSIGDigest(t *testing.T) {
+	now := time.Unix(0x0102_0304_0506, 0)
+	msg := updateMsg()
+	wire, mac, err := testKey.Sign(msg, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars []byte
+	vars = append(vars, "\x08ddns-key\x07example\x00"...)
+	vars = append(vars, 0x00, 0xff) // class ANY
+	vars = append(vars, 0, 0, 0, 0) // TTL
+	vars = append(vars, "\x0bhmac-sha256\x00"...)
+	vars = append(vars, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06) // time signed, 48 bits
+	vars = append(vars, 0x01, 0x2c)                         // fudge 300
+	vars = append(vars, 0, 0, 0, 0)                         // error, other len
+	h := hmac.New(sha256.New, testKey.Secret)
+	h.Write(unsigned)
+	h.Write(vars)
+	if want := h.Sum(nil); !bytes.Equal(mac, want) {
+		t.Errorf("mac %x, want %x", mac, want)
+	}
+	// the signed message is the unsigned one plus a record, ARCOUNT bumped
+	if !bytes.Equal(wire[12:len(unsigned)], unsigned[12:]) || binary.BigEndian.Uint16(wire[10:]) != 1 {
+		t.Error("signing changed the message body")
+	}
+}
+
+func TestTSIGBadMAC(t *testing.T) {
+	now := time.Now()
+	wire, _, err := testKey.Sign(updateMsg(), nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongSecret := &TSIGKey{Name: testKey.Name, Secret: []byte("another secret")}
+	if err := wrongSecret.Verify(wire, nil, now); !errors.Is(err, ErrTSIGBadMAC) {
+		t.Errorf("wrong secret: %v, want ErrTSIGBadMAC", err)
+	}
+
+	tampered := append([]byte{}, wire...)
+	tampered[2] ^= 0x04 // authoritative flag
+	if err := testKey.Verify(tampered, nil, now); !errors.Is(err, ErrTSIGBadMAC) {
+		t.Errorf("tampered header: %v, want ErrTSIGBadMAC", err)
+	}
+
+	var tsigErr *TSIGError
+	otherName := &TSIGKey{Name: "other-key.", Secret: testKey.Secret}
+	if err := otherName.Verify(wire, nil, now); !errors.As(err, &tsigErr) || tsigErr.RCode != RCodeBadKey {
+		t.Errorf("other key name: %v, want BADKEY", err)
+	}
+	otherAlg := &TSIGKey{Name: testKey.Name, Algorithm: HmacSHA512, Secret: testKey.Secret}
+	if err := otherAlg.Verify(wire, nil, now); !errors.As(err, &tsigErr) || tsigErr.RCode != RCodeBadKey {
+		t.Errorf("other algorithm: %v, want BADKEY", err)
+	}
+
+	unsigned, _ := updateMsg().Pack()
+	if err := testKey.Verify(unsigned, nil, now); !errors.Is(err, ErrTSIGMissing) {
+		t.Errorf("unsigned: %v, want ErrTSIGMissing", err)
+	}
+}
+
+// a forwarder may rewrite the id, the original one is in the TSIG record
+func TestTSIGRewrittenID(t *testing.T) {
+	now := time.Now()
+	wire, _, err := testKey.Sign(updateMsg(), nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(wire, 0x9999)
+	if err := testKey.Verify(wire, nil, now); err != nil {
+		t.Errorf("rewritten id: %v", err)
+	}
+}
+
+func TestTSIGTime(t *testing.T) {
+	signed := time.Unix(1700000000, 0)
+	key := &TSIGKey{Name: testKey.Name, Secret: testKey.Secret, Fudge: 60}
+	wire, _, err := key.Sign(updateMsg(), nil, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		skew time.Duration
+		want error
+	}{
+		{0, nil},
+		{60 * time.Second, nil},
+		{-60 * time.Second, nil},
+		{61 * time.Second, ErrTSIGBadTime},
+		{-61 * time.Second, ErrTSIGBadTime},
+		{time.Hour, ErrTSIGBadTime},
+	}
+	for _, tt := range tests {
+		if err := key.Verify(wire, nil, signed.Add(tt.skew)); !errors.Is(err, tt.want) {
+			t.Errorf("skew %s: %v, want %v", tt.skew, err, tt.want)
+		}
+	}
+}
+
+// the response MAC covers the request MAC, RFC 8945 section 4.3.1
+func TestTSIGRequestMACChaining(t *testing.T) {
+	now := time.Now()
+	req := updateMsg()
+	_, reqMAC, err := testKey.Sign(req, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := newMessage(Header{ID: req.ID, Response: true, Opcode: OpcodeUpdate}, req.Questions, nil, nil, nil)
+	respWire, _, err := testKey.Sign(resp, reqMAC, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testKey.Verify(respWire, reqMAC, now); err != nil {
+		t.Errorf("chained verify: %v", err)
+	}
+	if err := testKey.Verify(respWire, nil, now); !errors.Is(err, ErrTSIGBadMAC) {
+		t.Errorf("without request mac: %v, want ErrTSIGBadMAC", err)
+	}
+	_, otherMAC, _ := testKey.Sign(updateMsg(), nil, now.Add(time.Second))
+	if err := testKey.Verify(respWire, otherMAC, now); !errors.Is(err, ErrTSIGBadMAC) {
+		t.Errorf("other request mac: %v, want ErrTSIGBadMAC", err)
+	}
+}
+
+func TestTSIGErrorReply(t *testing.T) {
+	// servers answer BADTIME and friends unsigned, with the error in the record
+	resp := newMessage(Header{ID: 1, Response: true, Opcode: OpcodeUpdate, RCode: RCodeNotAuth}, nil, nil, nil, []Resource{
+		{Name: testKey.Name, Type: TypeTSIG, Class: ClassANY, Data: &TSIG{
+			Algorithm: HmacSHA256, TimeSigned: 1700000000, Fudge: 300, OriginalID: 1, Error: RCodeBadTime,
+		}},
+	})
+	wire, err := resp.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tsigErr *TSIGError
+	if err := testKey.Verify(wire, nil, time.Now()); !errors.As(err, &tsigErr) || tsigErr.RCode != RCodeBadTime {
+		t.Errorf("error reply: %v, want BADTIME", err)
+	}
+}
+
+func TestParseTSIGKey(t *testing.T) {
+	tests := []struct {
+		in      string
+		name    string
+		alg     string
+		wantErr bool
+	}{
+		{"ddns-key:c2VjcmV0", "ddns-key.", HmacSHA256, false},
+		{"hmac-sha512:ddns-key.example.:c2VjcmV0", "ddns-key.example.", HmacSHA512, false},
+		{"HMAC-SHA1:k:c2VjcmV0", "k.", HmacSHA1, false},
+		{"hmac-md5:k:c2VjcmV0", "", "", true},
+		{"k:not base64!", "", "", true},
+		{"c2VjcmV0", "", "", true},
+	}
+	for _, tt := range tests {
+		key, err := ParseTSIGKey(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTSIGKey(%q) succeeded", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTSIGKey(%q): %v", tt.in, err)
+			continue
+		}
+		if key.Name != tt.name || key.Algorithm != tt.alg || string(key.Secret) != "secret" {
+			t.Errorf("ParseTSIGKey(%q) = %+v", tt.in, key)
+		}
+	}
+}
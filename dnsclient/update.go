@@ -0,0 +1,45 @@
+package dnsclient
+
+// Dynamic updates, RFC 2136. The sections of an UPDATE message are
+// renamed: Questions hold the zone, Answers the prerequisites and
+// Authorities the updates.
+
+// NewUpdate starts an UPDATE message for zone.
+func NewUpdate(zone string) *Message {
+	return &Message{
+		Header:    Header{ID: newID(), Opcode: OpcodeUpdate},
+		Questions: []Question{{Name: Fqdn(zone), Type: TypeSOA, Class: ClassINET}},
+	}
+}
+
+// Add adds rr to its RRset.
+func (m *Message) Add(rr Resource) {
+	rr.Name, rr.Class = Fqdn(rr.Name), ClassINET
+	m.Authorities = append(m.Authorities, rr)
+}
+
+// DeleteRRset removes every record of type t at name.
+func (m *Message) DeleteRRset(name string, t Type) {
+	m.Authorities = append(m.Authorities, Resource{Name: Fqdn(name), Type: t, Class: ClassANY})
+}
+
+// DeleteName removes every RRset at name.
+func (m *Message) DeleteName(name string) {
+	m.DeleteRRset(name, TypeANY)
+}
+
+// DeleteRR removes the single record rr.
+func (m *Message) DeleteRR(rr Resource) {
+	rr.Name, rr.Class, rr.TTL = Fqdn(rr.Name), ClassNONE, 0
+	m.Authorities = append(m.Authorities, rr)
+}
+
+// NameInUse requires name to own at least one record.
+func (m *Message) NameInUse(name string) {
+	m.Answers = append(m.Answers, Resource{Name: Fqdn(name), Type: TypeANY, Class: ClassANY})
+}
+
+// NameNotInUse requires name to own no record.
+func (m *Message) NameNotInUse(name string) {
+	m.Answers = append(m.Answers, Resource{Name: Fqdn(name), Type: TypeANY, Class: ClassNONE})
+}
@@ -0,0 +1,188 @@
+package dnsforward
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+const (
+	// without an SOA in the authority section, RFC 2308 section 5
+	defaultNegativeTTL = 60
+	maxNegativeTTL     = 3 * 3600
+	maxPositiveTTL     = 24 * 3600
+)
+
+type cacheKey struct {
+	name  string
+	qtype dnsclient.Type
+	class dnsclient.Class
+	do    bool // DNSSEC records wanted
+	cd    bool // unvalidated answers wanted
+}
+
+type cacheEntry struct {
+	resp    *dnsclient.Message
+	stored  time.Time
+	expires time.Time
+}
+
+// cache is a TTL respecting answer cache, NXDOMAIN and NODATA are cached
+// by the SOA minimum of the authority section.
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]*cacheEntry
+	now     func() time.Time
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, entries: make(map[cacheKey]*cacheEntry), now: time.Now}
+}
+
+func keyOf(req *dnsclient.Message) (cacheKey, bool) {
+	if len(req.Questions) != 1 {
+		return cacheKey{}, false
+	}
+	q := req.Questions[0]
+	k := cacheKey{name: dnsclient.CanonicalName(q.Name), qtype: q.Type, class: q.Class, cd: req.CheckingDisabled}
+	if opt := req.OPT(); opt != nil {
+		k.do = opt.DO()
+	}
+	return k, true
+}
+
+// get returns a copy of the cached answer with TTLs counted down.
+func (c *cache) get(req *dnsclient.Message) (*dnsclient.Message, bool) {
+	if c.size <= 0 {
+		return nil, false
+	}
+	k, ok := keyOf(req)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	e, ok := c.entries[k]
+	now := c.now()
+	if ok && !now.Before(e.expires) {
+		delete(c.entries, k)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	elapsed := uint32(now.Sub(e.stored) / time.Second)
+	resp := *e.resp
+	resp.Answers = ageRecords(e.resp.Answers, elapsed)
+	resp.Authorities = ageRecords(e.resp.Authorities, elapsed)
+	resp.Additionals = ageRecords(e.resp.Additionals, elapsed)
+	return &resp, true
+}
+
+func ageRecords(rrs []dnsclient.Resource, elapsed uint32) []dnsclient.Resource {
+	out := make([]dnsclient.Resource, len(rrs))
+	copy(out, rrs)
+	for i := range out {
+		if out[i].Type == dnsclient.TypeOPT {
+			continue
+		}
+		if out[i].TTL > elapsed {
+			out[i].TTL -= elapsed
+		} else {
+			out[i].TTL = 0
+		}
+	}
+	return out
+}
+
+// put stores resp if it is cacheable, returns the TTL used.
+func (c *cache) put(req, resp *dnsclient.Message) uint32 {
+	if c.size <= 0 || resp.Truncated {
+		return 0
+	}
+	k, ok := keyOf(req)
+	if !ok {
+		return 0
+	}
+	ttl, ok := cacheTTL(resp)
+	if !ok || ttl == 0 {
+		return 0
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[k] = &cacheEntry{
+		resp:    resp,
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+	return ttl
+}
+
+// evict drops expired entries, or the one expiring first if none is.
+func (c *cache) evict(now time.Time) {
+	var firstKey cacheKey
+	var first *cacheEntry
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if first == nil || e.expires.Before(first.expires) {
+			firstKey, first = k, e
+		}
+	}
+	if len(c.entries) >= c.size && first != nil {
+		delete(c.entries, firstKey)
+	}
+}
+
+func (c *cache) flush() {
+	c.mu.Lock()
+	c.entries = make(map[cacheKey]*cacheEntry)
+	c.mu.Unlock()
+}
+
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// cacheTTL is the lowest answer TTL for positive answers and the SOA
+// derived TTL for NXDOMAIN and NODATA.
+func cacheTTL(resp *dnsclient.Message) (uint32, bool) {
+	switch resp.RCode {
+	case dnsclient.RCodeSuccess, dnsclient.RCodeNameError:
+	default:
+		return 0, false
+	}
+	if resp.RCode == dnsclient.RCodeSuccess && len(resp.Answers) != 0 {
+		ttl := uint32(maxPositiveTTL)
+		for _, rr := range resp.Answers {
+			if rr.TTL < ttl {
+				ttl = rr.TTL
+			}
+		}
+		return ttl, true
+	}
+	ttl := uint32(defaultNegativeTTL)
+	for _, rr := range resp.Authorities {
+		if soa, isSOA := rr.Data.(*dnsclient.SOA); isSOA {
+			ttl = rr.TTL
+			if soa.MinTTL < ttl {
+				ttl = soa.MinTTL
+			}
+			break
+		}
+	}
+	if ttl > maxNegativeTTL {
+		ttl = maxNegativeTTL
+	}
+	return ttl, true
+}
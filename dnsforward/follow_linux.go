@@ -0,0 +1,28 @@
+//go:build linux
+
+package dnsforward
+
+import (
+	"github.com/kmahyyg/go-network-compo/dns"
+)
+
+// FollowSystem keeps the routes in sync with the system DNS configuration,
+// e.g. a VPN adding per-link servers. Call the returned func to stop.
+func (f *Forwarder) FollowSystem() (func() error, error) {
+	w, err := dns.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	f.SetConfig(w.Current())
+	go func() {
+		for change := range w.Changes {
+			f.SetConfig(change.New)
+		}
+	}()
+	go func() {
+		// drain, the watcher keeps running on refresh errors
+		for range w.Errors {
+		}
+	}()
+	return w.Close, nil
+}
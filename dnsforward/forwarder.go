@@ -0,0 +1,450 @@
+package dnsforward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dns"
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+const (
+	DefaultCacheSize = 4096
+	DefaultLogSize   = 1024
+
+	minUDPSize   = 512
+	serveTimeout = 10 * time.Second
+)
+
+var ErrNotLoopback = errors.New("forwarder must listen on a loopback address")
+
+// QueryLogEntry records one handled query.
+type QueryLogEntry struct {
+	Time     time.Time       `json:"time"`
+	Client   string          `json:"client"`
+	Name     string          `json:"name"`
+	Type     dnsclient.Type  `json:"type"`
+	RCode    dnsclient.RCode `json:"rcode"`
+	Link     string          `json:"link,omitempty"` // interfaces of the route, comma separated
+	Cached   bool            `json:"cached"`
+	Duration time.Duration   `json:"duration"`
+	Err      string          `json:"error,omitempty"`
+}
+
+func (e QueryLogEntry) ToTableString() string {
+	src := "upstream"
+	if e.Cached {
+		src = "cache"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\tlink %s\t%s\t%s\n",
+		e.Time.Format(time.RFC3339), e.Client, e.Name, e.Type, e.RCode, e.Link, src, e.Duration)
+}
+
+func (e QueryLogEntry) ToPortableJSON() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Forwarder is an embeddable caching DNS forwarder listening on loopback.
+type Forwarder struct {
+	// OnQuery is called for every query after it is answered, optional.
+	OnQuery func(QueryLogEntry)
+
+	addr string
+	self netip.AddrPort
+
+	mu     sync.RWMutex
+	routes []route
+	rules  *dns.SplitDNS
+
+	cache *cache
+
+	logMu   sync.Mutex
+	log     []QueryLogEntry
+	logNext int
+	logSize int
+
+	udp    net.PacketConn
+	tcp    net.Listener
+	wg     sync.WaitGroup
+	closed chan struct{}
+}
+
+// New creates a forwarder for addr, e.g. "127.0.0.1:53" or "[::1]:5353",
+// with routes taken from cfg. Sizes of 0 pick the defaults, negative ones disable.
+func New(addr string, cfg *dns.Config, cacheSize, logSize int) (*Forwarder, error) {
+	ap, err := netip.ParseAddrPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !ap.Addr().IsLoopback() {
+		return nil, ErrNotLoopback
+	}
+	if cacheSize == 0 {
+		cacheSize = DefaultCacheSize
+	}
+	if logSize == 0 {
+		logSize = DefaultLogSize
+	}
+	if logSize < 0 {
+		logSize = 0
+	}
+	f := &Forwarder{
+		addr:    addr,
+		self:    ap,
+		cache:   newCache(cacheSize),
+		log:     make([]QueryLogEntry, 0, logSize),
+		logSize: logSize,
+		closed:  make(chan struct{}),
+	}
+	f.SetConfig(cfg)
+	return f, nil
+}
+
+// NewSystem creates a forwarder following dns.RetrieveConfig.
+func NewSystem(addr string) (*Forwarder, error) {
+	cfg, err := dns.RetrieveConfig()
+	if err != nil {
+		return nil, err
+	}
+	return New(addr, cfg, 0, 0)
+}
+
+// SetConfig replaces the upstream routes and flushes the cache.
+func (f *Forwarder) SetConfig(cfg *dns.Config) {
+	routes := buildRoutes(cfg, f.self)
+	rules := routeRules(routes)
+	f.mu.Lock()
+	f.routes, f.rules = routes, rules
+	f.mu.Unlock()
+	f.cache.flush()
+}
+
+// Start binds UDP and TCP and serves in the background until Close.
+func (f *Forwarder) Start() error {
+	udp, err := net.ListenPacket("udp", f.addr)
+	if err != nil {
+		return err
+	}
+	// port 0 picks the same port for TCP
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	f.udp, f.tcp = udp, tcp
+	f.wg.Add(2)
+	go f.serveUDP()
+	go f.serveTCP()
+	return nil
+}
+
+// Addr is the bound address after Start.
+func (f *Forwarder) Addr() netip.AddrPort {
+	if f.udp == nil {
+		return f.self
+	}
+	return netip.MustParseAddrPort(f.udp.LocalAddr().String())
+}
+
+func (f *Forwarder) Close() error {
+	select {
+	case <-f.closed:
+		return nil
+	default:
+	}
+	close(f.closed)
+	var err error
+	if f.udp != nil {
+		err = f.udp.Close()
+	}
+	if f.tcp != nil {
+		if e := f.tcp.Close(); err == nil {
+			err = e
+		}
+	}
+	f.wg.Wait()
+	return err
+}
+
+// FlushCache drops every cached answer.
+func (f *Forwarder) FlushCache() {
+	f.cache.flush()
+}
+
+// CacheLen is the number of cached answers, expired ones included.
+func (f *Forwarder) CacheLen() int {
+	return f.cache.len()
+}
+
+// QueryLog returns the remembered queries, oldest first.
+func (f *Forwarder) QueryLog() []QueryLogEntry {
+	f.logMu.Lock()
+	defer f.logMu.Unlock()
+	out := make([]QueryLogEntry, 0, len(f.log))
+	if len(f.log) < f.logSize {
+		return append(out, f.log...)
+	}
+	out = append(out, f.log[f.logNext:]...)
+	return append(out, f.log[:f.logNext]...)
+}
+
+func (f *Forwarder) record(e QueryLogEntry) {
+	if f.logSize > 0 {
+		f.logMu.Lock()
+		if len(f.log) < f.logSize {
+			f.log = append(f.log, e)
+		} else {
+			f.log[f.logNext] = e
+			f.logNext = (f.logNext + 1) % f.logSize
+		}
+		f.logMu.Unlock()
+	}
+	if f.OnQuery != nil {
+		f.OnQuery(e)
+	}
+}
+
+// Handle answers req from cache or the matching upstream, client is only
+// used for the query log. It never returns nil.
+func (f *Forwarder) Handle(ctx context.Context, client string, req *dnsclient.Message) *dnsclient.Message {
+	start := time.Now()
+	entry := QueryLogEntry{Time: start, Client: client}
+	if len(req.Questions) != 1 || req.Opcode != dnsclient.OpcodeQuery {
+		entry.RCode = dnsclient.RCodeNotImplemented
+		if len(req.Questions) != 1 {
+			entry.RCode = dnsclient.RCodeFormatError
+		}
+		resp := errorReply(req, entry.RCode)
+		entry.Duration = time.Since(start)
+		f.record(entry)
+		return resp
+	}
+	q := req.Questions[0]
+	entry.Name, entry.Type = q.Name, q.Type
+
+	f.mu.RLock()
+	rt := match(f.routes, f.rules, q.Name)
+	f.mu.RUnlock()
+	if rt != nil {
+		entry.Link = rt.link
+	}
+
+	resp, cached := f.cache.get(req)
+	if !cached {
+		var err error
+		if rt == nil {
+			err = dnsclient.ErrNoUpstreams
+		} else {
+			// upstream gets its own id, the client's one is restored below
+			upMsg := dnsclient.NewQuery(q.Name, q.Type)
+			upMsg.Questions[0].Class = q.Class
+			upMsg.RecursionDesired = req.RecursionDesired
+			upMsg.CheckingDisabled = req.CheckingDisabled
+			if opt := req.OPT(); opt != nil {
+				upMsg.SetEDNS0(dnsclient.DefaultUDPSize, opt.DO())
+			}
+			resp, err = rt.client.Exchange(ctx, upMsg)
+		}
+		if err != nil {
+			entry.Err = err.Error()
+			resp = errorReply(req, dnsclient.RCodeServerFailure)
+			entry.RCode = resp.RCode
+			entry.Duration = time.Since(start)
+			f.record(entry)
+			return resp
+		}
+		f.cache.put(req, resp)
+	}
+	entry.Cached = cached
+
+	out := *resp
+	out.ID = req.ID
+	out.Questions = req.Questions
+	out.RecursionDesired = req.RecursionDesired
+	// answer with our own OPT, only if the client sent one
+	out.Additionals = make([]dnsclient.Resource, 0, len(resp.Additionals))
+	for _, rr := range resp.Additionals {
+		if rr.Type != dnsclient.TypeOPT {
+			out.Additionals = append(out.Additionals, rr)
+		}
+	}
+	if opt := req.OPT(); opt != nil {
+		do := false
+		if ropt := resp.OPT(); ropt != nil {
+			do = ropt.DO()
+		}
+		out.SetEDNS0(dnsclient.DefaultUDPSize, do)
+	}
+	entry.RCode = out.RCode
+	entry.Duration = time.Since(start)
+	f.record(entry)
+	return &out
+}
+
+func errorReply(req *dnsclient.Message, rcode dnsclient.RCode) *dnsclient.Message {
+	return &dnsclient.Message{
+		Header: dnsclient.Header{
+			ID:                 req.ID,
+			Response:           true,
+			Opcode:             req.Opcode,
+			RecursionDesired:   req.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              rcode,
+		},
+		Questions: req.Questions,
+	}
+}
+
+func (f *Forwarder) serveUDP() {
+	defer f.wg.Done()
+	buf := make([]byte, 65535)
+	var delay time.Duration
+	for {
+		n, peer, err := f.udp.ReadFrom(buf)
+		if err != nil {
+			if !f.retryAfter(err, &delay) {
+				return
+			}
+			continue
+		}
+		delay = 0
+		req := new(dnsclient.Message)
+		if err = req.Unpack(buf[:n]); err != nil || req.Response {
+			continue
+		}
+		f.wg.Add(1)
+		go func(peer net.Addr) {
+			defer f.wg.Done()
+			ctx, cancel := f.serveContext()
+			defer cancel()
+			resp := f.Handle(ctx, peer.String(), req)
+			b, err := packForUDP(req, resp)
+			if err != nil {
+				return
+			}
+			f.udp.WriteTo(b, peer)
+		}(peer)
+	}
+}
+
+// retryAfter waits after a temporary listener error, doubling delay up to
+// a second like net/http does. Closing and permanent errors end serving.
+func (f *Forwarder) retryAfter(err error, delay *time.Duration) bool {
+	select {
+	case <-f.closed:
+		return false
+	default:
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Temporary() {
+		return false
+	}
+	if *delay == 0 {
+		*delay = 5 * time.Millisecond
+	} else if *delay *= 2; *delay > time.Second {
+		*delay = time.Second
+	}
+	select {
+	case <-time.After(*delay):
+		return true
+	case <-f.closed:
+		return false
+	}
+}
+
+// packForUDP truncates answers not fitting the client's buffer.
+func packForUDP(req, resp *dnsclient.Message) ([]byte, error) {
+	limit := minUDPSize
+	if opt := req.OPT(); opt != nil && int(opt.UDPSize()) > limit {
+		limit = int(opt.UDPSize())
+	}
+	b, err := resp.Pack()
+	if err != nil || len(b) <= limit {
+		return b, err
+	}
+	tc := *resp
+	tc.Truncated = true
+	tc.Answers, tc.Authorities = nil, nil
+	tc.Additionals = nil
+	if opt := resp.OPT(); opt != nil {
+		tc.Additionals = []dnsclient.Resource{*opt}
+	}
+	return tc.Pack()
+}
+
+func (f *Forwarder) serveTCP() {
+	defer f.wg.Done()
+	var delay time.Duration
+	for {
+		conn, err := f.tcp.Accept()
+		if err != nil {
+			if !f.retryAfter(err, &delay) {
+				return
+			}
+			continue
+		}
+		delay = 0
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.serveConn(conn)
+		}()
+	}
+}
+
+func (f *Forwarder) serveConn(conn net.Conn) {
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-f.closed:
+			conn.Close()
+		case <-done:
+		}
+	}()
+	for {
+		// idle clients are dropped, RFC 7766 section 6.2.3
+		conn.SetReadDeadline(time.Now().Add(serveTimeout))
+		data, err := dnsclient.ReadStreamMsg(conn)
+		if err != nil {
+			return
+		}
+		req := new(dnsclient.Message)
+		if err = req.Unpack(data); err != nil {
+			return
+		}
+		ctx, cancel := f.serveContext()
+		resp := f.Handle(ctx, conn.RemoteAddr().String(), req)
+		cancel()
+		b, err := resp.Pack()
+		if err != nil {
+			return
+		}
+		if err = dnsclient.WriteStreamMsg(conn, b); err != nil {
+			return
+		}
+	}
+}
+
+func (f *Forwarder) serveContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), serveTimeout)
+	go func() {
+		select {
+		case <-f.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
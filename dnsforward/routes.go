@@ -0,0 +1,96 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/dns"
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+// route sends queries below domain to the servers of one or more links.
+// Domain "." is the default route.
+type route struct {
+	domain string
+	exact  bool
+	link   string
+	client *dnsclient.Client
+}
+
+// buildRoutes turns the split DNS rules of the system config into routes,
+// rules claiming the same domain on several links share one route. Options
+// come from resolv.conf. self is skipped to avoid forwarding to ourselves.
+func buildRoutes(cfg *dns.Config, self netip.AddrPort) []route {
+	rc := dns.NewResolvConf()
+	if cfg.ResolvConf != nil {
+		rc = cfg.ResolvConf
+	}
+	routes := make([]route, 0)
+	servers := make([][]netip.AddrPort, 0)
+	// rules come longest domain first, so do the routes
+	for _, rule := range cfg.SplitDNS().Rules {
+		i := 0
+		for ; i < len(routes); i++ {
+			if routes[i].domain == rule.Domain && routes[i].exact == rule.Exact {
+				break
+			}
+		}
+		if i == len(routes) {
+			routes = append(routes, route{domain: rule.Domain, exact: rule.Exact})
+			servers = append(servers, make([]netip.AddrPort, 0))
+		}
+		if rule.Interface != "" && !strings.Contains(","+routes[i].link+",", ","+rule.Interface+",") {
+			if routes[i].link != "" {
+				routes[i].link += ","
+			}
+			routes[i].link += rule.Interface
+		}
+		for _, srv := range rule.Servers {
+			if srv != self {
+				servers[i] = append(servers[i], srv)
+			}
+		}
+	}
+	hasDefault := false
+	for i := range routes {
+		routes[i].client = newClient(rc, servers[i])
+		hasDefault = hasDefault || routes[i].domain == "."
+	}
+	if !hasDefault {
+		routes = append(routes, route{domain: ".", client: newClient(rc, nil)})
+	}
+	return routes
+}
+
+func newClient(rc *dns.ResolvConf, servers []netip.AddrPort) *dnsclient.Client {
+	cp := *rc
+	cp.Nameservers = nil
+	c := dnsclient.NewClient(&cp)
+	for _, srv := range servers {
+		c.Upstreams = append(c.Upstreams, &dnsclient.Plain{Addr: srv, UseTCP: rc.Options.UseVC})
+	}
+	return c
+}
+
+// routeRules has one rule per route, so that matching follows
+// dns.SplitDNS.Match like the system resolver does.
+func routeRules(routes []route) *dns.SplitDNS {
+	rules := &dns.SplitDNS{Rules: make([]dns.SplitRule, 0, len(routes))}
+	for _, rt := range routes {
+		rules.Rules = append(rules.Rules, dns.SplitRule{Domain: rt.domain, Exact: rt.exact, Interface: rt.link})
+	}
+	return rules
+}
+
+// match returns the route of the longest domain covering name, an exact
+// route beats a suffix route of the same domain.
+func match(routes []route, rules *dns.SplitDNS, name string) *route {
+	for _, rule := range rules.Match(name) {
+		for i := range routes {
+			if routes[i].domain == rule.Domain && routes[i].exact == rule.Exact {
+				return &routes[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+func TestMatch(t *testing.T) {
+	routes := []route{
+		{domain: "corp.example", link: "tun0"},
+		{domain: "host.corp.example", exact: true, link: "tun1"},
+		{domain: "example", link: "eth1"},
+		{domain: ".", link: "eth0"},
+	}
+	rules := routeRules(routes)
+	tests := []struct {
+		name string
+		link string
+	}{
+		{"www.corp.example.", "tun0"},
+		{"CORP.example", "tun0"},
+		{"host.corp.example.", "tun1"},
+		{"a.host.corp.example.", "tun0"},
+		{"other.example.", "eth1"},
+		{"notcorp.example.", "eth1"},
+		{"example.org.", "eth0"},
+		{".", "eth0"},
+	}
+	for _, tt := range tests {
+		rt := match(routes, rules, tt.name)
+		if rt == nil || rt.link != tt.link {
+			t.Errorf("match(%q) = %+v, want link %s", tt.name, rt, tt.link)
+		}
+	}
+	if rt := match(routes[:1], routeRules(routes[:1]), "example.org."); rt != nil {
+		t.Errorf("no default route but matched %+v", rt)
+	}
+}
+
+func TestCacheKeyBits(t *testing.T) {
+	keys := make(map[cacheKey]bool)
+	for _, cd := range []bool{false, true} {
+		for _, do := range []bool{false, true} {
+			req := dnsclient.NewQuery("Example.", dnsclient.TypeA)
+			req.CheckingDisabled = cd
+			req.SetEDNS0(1232, do)
+			k, ok := keyOf(req)
+			if !ok {
+				t.Fatal("no key for a single question")
+			}
+			if k.name != "example." {
+				t.Errorf("key name %q", k.name)
+			}
+			keys[k] = true
+		}
+	}
+	if len(keys) != 4 {
+		t.Errorf("%d distinct keys for the CD and DO combinations, want 4", len(keys))
+	}
+}
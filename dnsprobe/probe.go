@@ -0,0 +1,208 @@
+package dnsprobe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dns"
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+const (
+	defaultDeadline   = 5 * time.Second
+	defaultTimeout    = time.Second
+	defaultSamples    = 5
+	defaultProbeName  = "."
+	defaultHijackZone = "com."
+	probeUDPSize      = 4096
+)
+
+// Options tunes a probe run, zero values pick the defaults.
+type Options struct {
+	Deadline   time.Duration // whole run
+	Timeout    time.Duration // single query
+	Samples    int           // latency samples over UDP
+	ProbeName  string        // queried for NS, the root by default
+	HijackZone string        // a random label below it must be NXDOMAIN
+}
+
+func (o Options) withDefaults() Options {
+	if o.Deadline <= 0 {
+		o.Deadline = defaultDeadline
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.Samples <= 0 {
+		o.Samples = defaultSamples
+	}
+	if o.ProbeName == "" {
+		o.ProbeName = defaultProbeName
+	}
+	if o.HijackZone == "" {
+		o.HijackZone = defaultHijackZone
+	}
+	return o
+}
+
+// Report is the probe result of one nameserver.
+type Report struct {
+	Server             netip.AddrPort `json:"server"`
+	UDPReachable       bool           `json:"udp_reachable"`
+	TCPReachable       bool           `json:"tcp_reachable"`
+	LatencyMedian      time.Duration  `json:"latency_median"`
+	LatencyP95         time.Duration  `json:"latency_p95"`
+	Samples            int            `json:"samples"`
+	EDNS0              bool           `json:"edns0"`
+	EDNSBufferSize     uint16         `json:"edns_buffer_size"`
+	DNSSECOK           bool           `json:"dnssec_ok"` // DO bit echoed
+	RecursionAvailable bool           `json:"recursion_available"`
+	NXDomainHijack     bool           `json:"nxdomain_hijack"`
+	HijackAddrs        []netip.Addr   `json:"hijack_addrs,omitempty"`
+	Errors             []string       `json:"errors,omitempty"`
+}
+
+func (r Report) ToPortableJSON() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (r Report) ToTableString() string {
+	return fmt.Sprintf("%s\tudp %v\ttcp %v\tmedian %s\tp95 %s\tedns %d\tdo %v\tra %v\thijack %v\n",
+		r.Server, r.UDPReachable, r.TCPReachable, r.LatencyMedian, r.LatencyP95,
+		r.EDNSBufferSize, r.DNSSECOK, r.RecursionAvailable, r.NXDomainHijack)
+}
+
+// ProbeSystem probes every nameserver of dns.RetrieveConfig on port 53.
+func ProbeSystem(ctx context.Context, opts Options) ([]Report, error) {
+	cfg, err := dns.RetrieveConfig()
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]netip.AddrPort, 0)
+	for _, addr := range cfg.Nameservers() {
+		servers = append(servers, netip.AddrPortFrom(addr, 53))
+	}
+	return Probe(ctx, servers, opts), nil
+}
+
+// Probe checks all servers concurrently, everything unfinished at the
+// deadline is reported as far as it got.
+func Probe(ctx context.Context, servers []netip.AddrPort, opts Options) []Report {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Deadline)
+	defer cancel()
+	reports := make([]Report, len(servers))
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = probeOne(ctx, servers[i], opts)
+		}(i)
+	}
+	wg.Wait()
+	return reports
+}
+
+func probeOne(ctx context.Context, server netip.AddrPort, opts Options) Report {
+	rep := Report{Server: server}
+	exchange := func(tcp bool, msg *dnsclient.Message) (*dnsclient.Message, time.Duration, error) {
+		qctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		start := time.Now()
+		var resp *dnsclient.Message
+		var err error
+		if tcp {
+			resp, err = dnsclient.ExchangeTCP(qctx, server, msg)
+		} else {
+			resp, err = dnsclient.ExchangeUDP(qctx, server, msg)
+		}
+		return resp, time.Since(start), err
+	}
+	fail := func(step string, err error) {
+		rep.Errors = append(rep.Errors, step+": "+err.Error())
+	}
+
+	// latency and reachability, plain queries without EDNS
+	latencies := make([]time.Duration, 0, opts.Samples)
+	for i := 0; i < opts.Samples && ctx.Err() == nil; i++ {
+		resp, rtt, err := exchange(false, dnsclient.NewQuery(opts.ProbeName, dnsclient.TypeNS))
+		if err != nil {
+			fail("udp", err)
+			continue
+		}
+		rep.UDPReachable = true
+		rep.RecursionAvailable = rep.RecursionAvailable || resp.RecursionAvailable
+		latencies = append(latencies, rtt)
+	}
+	rep.Samples = len(latencies)
+	rep.LatencyMedian, rep.LatencyP95 = percentile(latencies, 50), percentile(latencies, 95)
+
+	if resp, _, err := exchange(true, dnsclient.NewQuery(opts.ProbeName, dnsclient.TypeNS)); err != nil {
+		fail("tcp", err)
+	} else {
+		rep.TCPReachable = true
+		rep.RecursionAvailable = rep.RecursionAvailable || resp.RecursionAvailable
+	}
+	if !rep.UDPReachable && !rep.TCPReachable {
+		return rep
+	}
+	// stick to what works for the capability checks
+	useTCP := !rep.UDPReachable
+
+	q := dnsclient.NewQuery(opts.ProbeName, dnsclient.TypeNS)
+	q.SetEDNS0(probeUDPSize, true)
+	if resp, _, err := exchange(useTCP, q); err != nil {
+		fail("edns0", err)
+	} else if opt := resp.OPT(); opt != nil {
+		rep.EDNS0 = true
+		rep.EDNSBufferSize = opt.UDPSize()
+		rep.DNSSECOK = opt.DO()
+	}
+
+	// a random name nobody registered must not resolve
+	name := randomLabel() + "."
+	if zone := dnsclient.Fqdn(opts.HijackZone); zone != "." {
+		name += zone
+	}
+	if resp, _, err := exchange(useTCP, dnsclient.NewQuery(name, dnsclient.TypeA)); err != nil {
+		fail("nxdomain", err)
+	} else if resp.RCode == dnsclient.RCodeSuccess {
+		rep.HijackAddrs = resp.AnswerAddrs()
+		rep.NXDomainHijack = len(rep.HijackAddrs) != 0
+	}
+	return rep
+}
+
+// percentile uses the nearest-rank method.
+func percentile(samples []time.Duration, p int) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func randomLabel() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return "nx-" + hex.EncodeToString(b[:])
+}
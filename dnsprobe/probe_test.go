@@ -0,0 +1,205 @@
+package dnsprobe
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+	"github.com/kmahyyg/go-network-compo/internal/dnstest"
+)
+
+// stubServer is a local stand-in nameserver answering probes.
+type stubServer struct {
+	ra       bool
+	ednsSize uint16 // 0 answers without OPT
+	echoDO   bool
+	hijack   netip.Addr // answer for names below com. instead of NXDOMAIN
+	delay    time.Duration
+}
+
+func (s *stubServer) reply(req *dnsclient.Message) *dnsclient.Message {
+	resp := &dnsclient.Message{
+		Header: dnsclient.Header{
+			ID:                 req.ID,
+			Response:           true,
+			RecursionDesired:   req.RecursionDesired,
+			RecursionAvailable: s.ra,
+		},
+		Questions: req.Questions,
+	}
+	q := req.Questions[0]
+	switch {
+	case q.Type == dnsclient.TypeNS:
+		resp.Answers = []dnsclient.Resource{{
+			Name: q.Name, Type: dnsclient.TypeNS, Class: dnsclient.ClassINET, TTL: 60,
+			Data: &dnsclient.NameData{Target: "a.root-servers.net."},
+		}}
+	case strings.HasSuffix(q.Name, ".com.") && s.hijack.IsValid():
+		resp.Answers = []dnsclient.Resource{{
+			Name: q.Name, Type: dnsclient.TypeA, Class: dnsclient.ClassINET, TTL: 60,
+			Data: &dnsclient.A{Addr: s.hijack},
+		}}
+	default:
+		resp.RCode = dnsclient.RCodeNameError
+	}
+	if opt := req.OPT(); opt != nil && s.ednsSize != 0 {
+		resp.SetEDNS0(s.ednsSize, s.echoDO && opt.DO())
+	}
+	return resp
+}
+
+func (s *stubServer) handle(b []byte) []byte {
+	req := new(dnsclient.Message)
+	if err := req.Unpack(b); err != nil || len(req.Questions) == 0 {
+		return nil
+	}
+	time.Sleep(s.delay)
+	out, err := s.reply(req).Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// start listens on loopback, udp or tcp may be left out to make that
+// transport unreachable.
+func (s *stubServer) start(t *testing.T, udp, tcp bool) netip.AddrPort {
+	t.Helper()
+	srv := &dnstest.Server{}
+	if udp {
+		srv.UDP = s.handle
+	}
+	if tcp {
+		srv.TCP = s.handle
+	}
+	return srv.Start(t)
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	srv := &stubServer{ra: true, ednsSize: 1232, echoDO: true, delay: 20 * time.Millisecond}
+	addr := srv.start(t, true, true)
+	reports := Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 3})
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports", len(reports))
+	}
+	rep := reports[0]
+	if len(rep.Errors) != 0 {
+		t.Fatalf("errors: %v", rep.Errors)
+	}
+	if rep.Server != addr || !rep.UDPReachable || !rep.TCPReachable {
+		t.Errorf("server %s udp %v tcp %v", rep.Server, rep.UDPReachable, rep.TCPReachable)
+	}
+	if rep.Samples != 3 {
+		t.Errorf("samples = %d, want 3", rep.Samples)
+	}
+	if rep.LatencyMedian < srv.delay || rep.LatencyP95 < rep.LatencyMedian {
+		t.Errorf("latency median %s p95 %s, server delay %s", rep.LatencyMedian, rep.LatencyP95, srv.delay)
+	}
+	if !rep.EDNS0 || rep.EDNSBufferSize != 1232 || !rep.DNSSECOK {
+		t.Errorf("edns0 %v size %d do %v", rep.EDNS0, rep.EDNSBufferSize, rep.DNSSECOK)
+	}
+	if !rep.RecursionAvailable {
+		t.Error("recursion available not detected")
+	}
+	if rep.NXDomainHijack || len(rep.HijackAddrs) != 0 {
+		t.Errorf("hijack %v %v on an honest server", rep.NXDomainHijack, rep.HijackAddrs)
+	}
+}
+
+func TestProbeWithoutEDNS(t *testing.T) {
+	srv := &stubServer{}
+	addr := srv.start(t, true, true)
+	rep := Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 1})[0]
+	if len(rep.Errors) != 0 {
+		t.Fatalf("errors: %v", rep.Errors)
+	}
+	if rep.EDNS0 || rep.EDNSBufferSize != 0 || rep.DNSSECOK || rep.RecursionAvailable {
+		t.Errorf("edns0 %v size %d do %v ra %v", rep.EDNS0, rep.EDNSBufferSize, rep.DNSSECOK, rep.RecursionAvailable)
+	}
+}
+
+func TestProbeDOBitNotEchoed(t *testing.T) {
+	srv := &stubServer{ra: true, ednsSize: 4096}
+	addr := srv.start(t, true, true)
+	rep := Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 1})[0]
+	if !rep.EDNS0 || rep.EDNSBufferSize != 4096 || rep.DNSSECOK {
+		t.Errorf("edns0 %v size %d do %v", rep.EDNS0, rep.EDNSBufferSize, rep.DNSSECOK)
+	}
+}
+
+func TestProbeNXDomainHijack(t *testing.T) {
+	srv := &stubServer{ra: true, hijack: netip.MustParseAddr("192.0.2.53")}
+	addr := srv.start(t, true, true)
+	rep := Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 1})[0]
+	if !rep.NXDomainHijack {
+		t.Fatal("hijack not detected")
+	}
+	if !reflect.DeepEqual(rep.HijackAddrs, []netip.Addr{srv.hijack}) {
+		t.Errorf("hijack addrs = %v", rep.HijackAddrs)
+	}
+
+	// outside the hijacked zone the same server is honest
+	rep = Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 1, HijackZone: "net."})[0]
+	if rep.NXDomainHijack {
+		t.Errorf("hijack reported for zone net.: %v", rep.HijackAddrs)
+	}
+}
+
+func TestProbeTCPOnly(t *testing.T) {
+	srv := &stubServer{ra: true, ednsSize: 1232, echoDO: true}
+	addr := srv.start(t, false, true)
+	rep := Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 2, Timeout: 200 * time.Millisecond})[0]
+	if rep.UDPReachable || !rep.TCPReachable || rep.Samples != 0 {
+		t.Fatalf("udp %v tcp %v samples %d", rep.UDPReachable, rep.TCPReachable, rep.Samples)
+	}
+	// capability checks fall back to TCP
+	if !rep.EDNS0 || rep.EDNSBufferSize != 1232 || !rep.DNSSECOK {
+		t.Errorf("edns0 %v size %d do %v", rep.EDNS0, rep.EDNSBufferSize, rep.DNSSECOK)
+	}
+	if len(rep.Errors) != 2 || !strings.HasPrefix(rep.Errors[0], "udp: ") {
+		t.Errorf("errors = %v, want two udp failures", rep.Errors)
+	}
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	srv := &stubServer{}
+	addr := srv.start(t, false, false)
+	rep := Probe(context.Background(), []netip.AddrPort{addr}, Options{Samples: 1, Timeout: 200 * time.Millisecond})[0]
+	if rep.UDPReachable || rep.TCPReachable || rep.EDNS0 || rep.NXDomainHijack {
+		t.Errorf("report of a dead server = %+v", rep)
+	}
+	if len(rep.Errors) != 2 {
+		t.Errorf("errors = %v, want udp and tcp", rep.Errors)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ms := func(list ...int) []time.Duration {
+		out := make([]time.Duration, 0, len(list))
+		for _, v := range list {
+			out = append(out, time.Duration(v)*time.Millisecond)
+		}
+		return out
+	}
+	tests := []struct {
+		samples []time.Duration
+		p       int
+		want    time.Duration
+	}{
+		{nil, 50, 0},
+		{ms(7), 95, 7 * time.Millisecond},
+		{ms(5, 1, 3), 50, 3 * time.Millisecond},
+		{ms(4, 1, 3, 2), 50, 2 * time.Millisecond},
+		{ms(10, 20, 30, 40, 50, 60, 70, 80, 90, 100), 95, 100 * time.Millisecond},
+		{ms(10, 20, 30, 40, 50, 60, 70, 80, 90, 100), 0, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.samples, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %d) = %s, want %s", tt.samples, tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package egress works out the primary outbound interface and source
+// address of each family without sending anything: from the kernel route
+// lookup where there is one, else from the default route and the addresses.
+package egress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/routes"
+)
+
+// address families
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// states of a family
+const (
+	StateOK        = "ok"         // interface and source address found
+	StateNoRoute   = "no_route"   // no default route
+	StateNoAddress = "no_address" // default route, but no usable source address on its interface
+)
+
+// how the result was found
+const (
+	MethodRouteGet   = "route_get"   // kernel route lookup, policy routing included
+	MethodRouteTable = "route_table" // default route of routes.Retrieve and the address list
+)
+
+var ErrBadFamily = errors.New("family is neither ipv4 nor ipv6")
+
+// errNoKernelLookup makes Detect fall back to the route table.
+var errNoKernelLookup = errors.New("no kernel route lookup")
+
+// probe destinations for the kernel lookup. Well known, globally routed
+// addresses, only looked up in the route table and never contacted.
+// On split tunnel or policy routed hosts the route to this one address may
+// be more specific than the default route.
+var probes = map[string]netip.Addr{
+	FamilyIPv4: netip.MustParseAddr("8.8.8.8"),
+	FamilyIPv6: netip.MustParseAddr("2001:4860:4860::8888"),
+}
+
+// Egress is the outbound path of one family. Only State and Family are set
+// unless State is StateOK, Iface and Gateway also with StateNoAddress.
+type Egress struct {
+	Family  string     `json:"family"`
+	State   string     `json:"state"`
+	Iface   string     `json:"iface"`
+	Index   int        `json:"index"`
+	Source  netip.Addr `json:"source"`
+	Gateway netip.Addr `json:"gateway"` // invalid for on link default routes, e.g. point-to-point
+	Method  string     `json:"method"`
+}
+
+func (e Egress) ToPortableJSON() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (e Egress) ToTableString() string {
+	if e.State == StateNoRoute {
+		return fmt.Sprintf("%s\t%s\n", e.Family, e.State)
+	}
+	return fmt.Sprintf("%s\t%s\tdev %s\tsrc %s\tvia %s\t%s\n", e.Family, e.State, e.Iface, addrString(e.Source), addrString(e.Gateway), e.Method)
+}
+
+func addrString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return "-"
+	}
+	return addr.String()
+}
+
+// Detect returns the egress of IPv4 and IPv6, in this order. A family
+// without default route or address is reported in its State, not as error.
+func Detect() ([]Egress, error) {
+	result := make([]Egress, 0, 2)
+	for _, family := range []string{FamilyIPv4, FamilyIPv6} {
+		e, err := DetectFamily(family)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// DetectFamily returns the egress of FamilyIPv4 or FamilyIPv6.
+func DetectFamily(family string) (Egress, error) {
+	probe, ok := probes[family]
+	if !ok {
+		return Egress{}, ErrBadFamily
+	}
+	e, err := routeGet(family, probe)
+	if err != nil && err != errNoKernelLookup {
+		return Egress{}, err
+	}
+	if err == nil && e.State != StateNoAddress {
+		return e, nil
+	}
+	addrs, err := ifaces.Addresses()
+	if err != nil {
+		return Egress{}, err
+	}
+	if e.State == StateNoAddress {
+		// the kernel found a route but no preferred source
+		if a, ok := pickSource(addrs, e.Iface, family, e.Gateway); ok {
+			e.State, e.Source = StateOK, a.Prefix.Addr()
+		}
+		return e, nil
+	}
+	table, err := routes.Retrieve()
+	if err != nil {
+		return Egress{}, err
+	}
+	return fromTable(family, table, addrs), nil
+}
+
+// fromTable picks the default route of family with the lowest metric and
+// a source address of its interface.
+func fromTable(family string, table []routes.NetRoute, addrs []ifaces.Address) Egress {
+	e := Egress{Family: family, State: StateNoRoute, Method: MethodRouteTable}
+	var best *routes.NetRoute
+	for i := range table {
+		nr := &table[i]
+		if !nr.HasFlag("U") || nr.HasFlag("Rejected") || nr.NetIf == "" {
+			continue
+		}
+		prefix, err := routes.ParseDestination(nr.Destination)
+		if err != nil || prefix.Bits() != 0 || familyOf(prefix.Addr()) != family {
+			continue
+		}
+		if best == nil || nr.Metric < best.Metric {
+			best = nr
+		}
+	}
+	if best == nil {
+		return e
+	}
+	e.State, e.Iface = StateNoAddress, best.NetIf
+	if gw, err := netip.ParseAddr(best.Gateway); err == nil && !gw.IsUnspecified() {
+		e.Gateway = gw.Unmap()
+	}
+	if a, ok := pickSource(addrs, e.Iface, family, e.Gateway); ok {
+		e.State, e.Index, e.Source = StateOK, a.Index, a.Prefix.Addr()
+	}
+	return e
+}
+
+// pickSource returns a usable address of iface: global scope, not tentative,
+// failed or deprecated, on the subnet of the gateway when there is one.
+func pickSource(addrs []ifaces.Address, iface, family string, gateway netip.Addr) (ifaces.Address, bool) {
+	var found ifaces.Address
+	ok := false
+	for _, a := range addrs {
+		if a.Iface != iface || familyOf(a.Prefix.Addr()) != family || a.Scope != ifaces.ScopeGlobal ||
+			a.HasFlag("tentative") || a.HasFlag("dadfailed") || a.HasFlag("deprecated") {
+			continue
+		}
+		if gateway.IsValid() && a.Prefix.Masked().Contains(gateway) {
+			return a, true
+		}
+		if !ok {
+			found, ok = a, true
+		}
+	}
+	return found, ok
+}
+
+func familyOf(addr netip.Addr) string {
+	if addr.Unmap().Is4() {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package egress
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// routeGet asks the kernel which route it would take to dst, like
+// `ip route get`. Without route the family is StateNoRoute.
+func routeGet(family string, dst netip.Addr) (Egress, error) {
+	e := Egress{Family: family, State: StateNoRoute, Method: MethodRouteGet}
+	h := &unix.RtMsg{Family: unix.AF_INET, Dst_len: 32}
+	if family == FamilyIPv6 {
+		h.Family, h.Dst_len = unix.AF_INET6, 128
+	}
+	body := rtnl.AppendAttr(rtnl.RtMsgBytes(h), unix.RTA_DST, dst.AsSlice())
+	c, err := rtnl.Dial(0)
+	if err != nil {
+		return e, errNoKernelLookup
+	}
+	defer c.Close()
+	msgs, err := c.Execute(unix.RTM_GETROUTE, 0, body)
+	switch {
+	case errors.Is(err, unix.ENETUNREACH), errors.Is(err, unix.EHOSTUNREACH), errors.Is(err, unix.EAFNOSUPPORT):
+		return e, nil
+	case err != nil:
+		return e, errNoKernelLookup
+	}
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWROUTE {
+			continue
+		}
+		rt, attrs, err := rtnl.RtMsg(m.Data)
+		if err != nil {
+			return e, err
+		}
+		if rt.Type != unix.RTN_UNICAST {
+			return e, nil
+		}
+		for _, a := range attrs {
+			switch a.Type {
+			case unix.RTA_OIF:
+				e.Index = int(a.Uint32())
+			case unix.RTA_PREFSRC:
+				e.Source, _ = netip.AddrFromSlice(a.Data)
+			case unix.RTA_GATEWAY:
+				e.Gateway, _ = netip.AddrFromSlice(a.Data)
+			}
+		}
+		if iface, err := net.InterfaceByIndex(e.Index); err == nil {
+			e.Iface = iface.Name
+		}
+		e.State = StateNoAddress
+		if e.Source.IsValid() {
+			e.State = StateOK
+		}
+		return e, nil
+	}
+	return e, nil
+}
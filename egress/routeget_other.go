@@ -0,0 +1,12 @@
+//go:build !linux
+
+package egress
+
+import (
+	"net/netip"
+)
+
+// routeGet has no kernel lookup to ask here, Detect uses the route table.
+func routeGet(family string, dst netip.Addr) (Egress, error) {
+	return Egress{}, errNoKernelLookup
+}
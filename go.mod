@@ -3,6 +3,8 @@ module github.com/kmahyyg/go-network-compo
 go 1.18
 
 require (
-	golang.org/x/net v0.0.0-20220617184016-355a448f1bc9
-	golang.org/x/sys v0.0.0-20220615213510-4f61da869c0c
+	golang.org/x/net v0.10.0
+	golang.org/x/sys v0.8.0
 )
+
+require github.com/godbus/dbus/v5 v5.1.0
@@ -0,0 +1,338 @@
+package hosts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	UNIX_HOSTS_PATH    = "/etc/hosts"
+	WINDOWS_HOSTS_PATH = `C:\Windows\System32\drivers\etc\hosts`
+
+	beginMarker = "# BEGIN "
+	endMarker   = "# END "
+)
+
+var (
+	ErrBadTag      = errors.New("managed block tag must be a single word")
+	ErrBrokenBlock = errors.New("managed block markers are unbalanced")
+)
+
+// DefaultPath is the hosts file of the running system.
+func DefaultPath() string {
+	if runtime.GOOS == "windows" {
+		return WINDOWS_HOSTS_PATH
+	}
+	return UNIX_HOSTS_PATH
+}
+
+// Entry is one address line of a hosts file.
+type Entry struct {
+	Addr    netip.Addr `json:"addr"`
+	Names   []string   `json:"names"` // canonical name first, then aliases
+	Comment string     `json:"comment,omitempty"`
+	Line    int        `json:"line"` // 1 based, 0 for entries not read from a file
+}
+
+func (e Entry) String() string {
+	s := e.Addr.String() + "\t" + strings.Join(e.Names, " ")
+	if e.Comment != "" {
+		s += "\t# " + e.Comment
+	}
+	return s
+}
+
+// File is a parsed hosts file, Raw keeps the original bytes so that
+// edits can leave everything outside the managed block untouched.
+type File struct {
+	Path    string
+	Raw     []byte
+	Entries []Entry
+}
+
+// Load reads and parses path.
+func Load(path string) (*File, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := Parse(raw)
+	f.Path = path
+	return f, nil
+}
+
+// Parse never fails, lines it cannot understand are skipped like libc does.
+func Parse(raw []byte) *File {
+	f := &File{Raw: raw, Entries: make([]Entry, 0)}
+	// split by hand, bufio.Scanner stops at its line length limit
+	for i, line := range bytes.Split(raw, []byte("\n")) {
+		if e, ok := parseLine(string(bytes.TrimSuffix(line, []byte("\r")))); ok {
+			e.Line = i + 1
+			f.Entries = append(f.Entries, e)
+		}
+	}
+	return f
+}
+
+func parseLine(line string) (Entry, bool) {
+	comment := ""
+	if idx := strings.IndexByte(line, '#'); idx >= 0 {
+		comment = strings.TrimSpace(line[idx+1:])
+		line = line[:idx]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return Entry{}, false
+	}
+	addr, err := netip.ParseAddr(fields[0])
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Addr: addr, Names: fields[1:], Comment: comment}, true
+}
+
+// LookupName returns the addresses of name, matched case-insensitively
+// against canonical names and aliases, in file order.
+func (f *File) LookupName(name string) []netip.Addr {
+	name = normalize(name)
+	addrs := make([]netip.Addr, 0)
+	for _, e := range f.Entries {
+		for _, n := range e.Names {
+			if normalize(n) == name {
+				addrs = append(addrs, e.Addr)
+				break
+			}
+		}
+	}
+	return addrs
+}
+
+// LookupAddr returns the names of addr, canonical names first.
+func (f *File) LookupAddr(addr netip.Addr) []string {
+	names := make([]string, 0)
+	for _, e := range f.Entries {
+		if e.Addr.Unmap() == addr.Unmap() {
+			names = append(names, e.Names...)
+		}
+	}
+	return names
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Managed returns the entries inside the block tagged tag.
+func (f *File) Managed(tag string) ([]Entry, error) {
+	start, end, err := f.findBlock(tag)
+	if err != nil || start < 0 {
+		return nil, err
+	}
+	return Parse(f.Raw[start:end]).Entries, nil
+}
+
+// SetManaged replaces the content of the block tagged tag with entries.
+// The block is appended if missing and removed if entries is empty, bytes
+// outside of it are kept exactly.
+func (f *File) SetManaged(tag string, entries []Entry) error {
+	if tag == "" || strings.ContainsAny(tag, " \t\r\n#") {
+		return ErrBadTag
+	}
+	start, end, err := f.findBlock(tag)
+	if err != nil {
+		return err
+	}
+	// follow the line ending of the file, CRLF on most windows systems
+	nl := "\n"
+	if bytes.Contains(f.Raw, []byte("\r\n")) {
+		nl = "\r\n"
+	}
+	var block []byte
+	if len(entries) != 0 {
+		var sb strings.Builder
+		sb.WriteString(beginMarker + tag + nl)
+		for _, e := range entries {
+			if !e.Addr.IsValid() || len(e.Names) == 0 {
+				return fmt.Errorf("invalid hosts entry %q", e.String())
+			}
+			for _, n := range e.Names {
+				if n == "" || strings.ContainsAny(n, " \t\r\n#") {
+					return fmt.Errorf("invalid host name %q", n)
+				}
+			}
+			sb.WriteString(e.String() + nl)
+		}
+		sb.WriteString(endMarker + tag + nl)
+		block = []byte(sb.String())
+	}
+	var out []byte
+	if start < 0 {
+		if block == nil {
+			return nil
+		}
+		out = append(out, f.Raw...)
+		if len(out) != 0 && out[len(out)-1] != '\n' {
+			out = append(out, nl...)
+		}
+		out = append(out, block...)
+	} else {
+		// start and end enclose the markers including the end marker's newline
+		out = append(out, f.Raw[:start]...)
+		out = append(out, block...)
+		out = append(out, f.Raw[end:]...)
+	}
+	*f = File{Path: f.Path, Raw: out, Entries: Parse(out).Entries}
+	return nil
+}
+
+// Add puts entries into the managed block. Names of an entry with an
+// address already there are merged into that entry, skipping duplicates.
+func (f *File) Add(tag string, entries ...Entry) error {
+	cur, err := f.Managed(tag)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		merged := false
+		for i := range cur {
+			if cur[i].Addr != e.Addr {
+				continue
+			}
+			cur[i].Names = mergeNames(cur[i].Names, e.Names)
+			if e.Comment != "" {
+				cur[i].Comment = e.Comment
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			e.Names = mergeNames(nil, e.Names)
+			cur = append(cur, e)
+		}
+	}
+	return f.SetManaged(tag, cur)
+}
+
+// mergeNames appends the names missing from names, compared like lookups do.
+func mergeNames(names, add []string) []string {
+	seen := make(map[string]bool)
+	out := make([]string, 0, len(names)+len(add))
+	for _, n := range append(append([]string{}, names...), add...) {
+		if !seen[normalize(n)] {
+			seen[normalize(n)] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Remove drops names from the managed block, entries left without names go away.
+func (f *File) Remove(tag string, names ...string) error {
+	cur, err := f.Managed(tag)
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool)
+	for _, n := range names {
+		drop[normalize(n)] = true
+	}
+	kept := make([]Entry, 0, len(cur))
+	for _, e := range cur {
+		left := make([]string, 0, len(e.Names))
+		for _, n := range e.Names {
+			if !drop[normalize(n)] {
+				left = append(left, n)
+			}
+		}
+		if len(left) != 0 {
+			e.Names = left
+			kept = append(kept, e)
+		}
+	}
+	return f.SetManaged(tag, kept)
+}
+
+// findBlock returns the byte range of the block tagged tag, -1 if absent.
+func (f *File) findBlock(tag string) (int, int, error) {
+	begin, end := beginMarker+tag, endMarker+tag
+	start := -1
+	off := 0
+	for off < len(f.Raw) {
+		lineEnd := bytes.IndexByte(f.Raw[off:], '\n')
+		next := len(f.Raw)
+		if lineEnd >= 0 {
+			next = off + lineEnd + 1
+		}
+		line := strings.TrimRight(string(f.Raw[off:next]), "\r\n")
+		switch {
+		case line == begin:
+			if start >= 0 {
+				return 0, 0, ErrBrokenBlock
+			}
+			start = off
+		case line == end:
+			if start < 0 {
+				return 0, 0, ErrBrokenBlock
+			}
+			return start, next, nil
+		}
+		off = next
+	}
+	if start >= 0 {
+		return 0, 0, ErrBrokenBlock
+	}
+	return -1, -1, nil
+}
+
+// Save writes the file atomically: a temporary file in the same directory
+// is synced and renamed over the original, keeping its owner and permissions.
+func (f *File) Save() error {
+	if f.Path == "" {
+		return errors.New("hosts file has no path")
+	}
+	// replace the target of a symlinked hosts file, not the link
+	path, err := filepath.EvalSymlinks(f.Path)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	st, err := os.Stat(path)
+	if err == nil {
+		mode = st.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".hosts-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err = tmp.Write(f.Raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	// the temporary file belongs to us, give it back to the original owner
+	if st != nil {
+		if err = keepOwner(tmp, st); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
@@ -0,0 +1,114 @@
+package hosts
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddMergesNames(t *testing.T) {
+	f := Parse([]byte("127.0.0.1\tlocalhost\n"))
+	addr := netip.MustParseAddr("10.0.0.5")
+	if err := f.Add("test", Entry{Addr: addr, Names: []string{"db", "db.lan"}}); err != nil {
+		t.Fatal(err)
+	}
+	err := f.Add("test",
+		Entry{Addr: addr, Names: []string{"DB.lan.", "cache"}},
+		Entry{Addr: netip.MustParseAddr("10.0.0.6"), Names: []string{"web", "web"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Managed("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("managed = %v, want two entries", got)
+	}
+	if !reflect.DeepEqual(got[0].Names, []string{"db", "db.lan", "cache"}) {
+		t.Errorf("merged names = %v", got[0].Names)
+	}
+	if !reflect.DeepEqual(got[1].Names, []string{"web"}) {
+		t.Errorf("new entry names = %v", got[1].Names)
+	}
+	if f.Entries[0].Names[0] != "localhost" {
+		t.Errorf("entries outside the block changed: %v", f.Entries)
+	}
+}
+
+func TestParseLongLine(t *testing.T) {
+	raw := "127.0.0.1 localhost\n# " + strings.Repeat("x", 100<<10) + "\n10.0.0.1 after\r\n"
+	f := Parse([]byte(raw))
+	if len(f.Entries) != 2 || f.Entries[1].Names[0] != "after" || f.Entries[1].Line != 3 {
+		t.Errorf("entries = %v, want the line after the long one", f.Entries)
+	}
+}
+
+// SetManaged and Save keep every byte outside the block
+func TestSetManagedKeepsBytes(t *testing.T) {
+	entry := Entry{Addr: netip.MustParseAddr("10.0.0.5"), Names: []string{"db"}}
+	tests := []struct {
+		name          string
+		before, after string // around the block, or the whole file without one
+		block         bool
+	}{
+		{"crlf and comments around the block",
+			"# hosts\r\n127.0.0.1\tlocalhost  # loopback\r\n\r\n",
+			"  ::1 localhost\r\n#trailing comment", true},
+		{"no final newline, block appended", "127.0.0.1 localhost\n# last line", "", false},
+		{"empty file", "", "", false},
+	}
+	for _, tt := range tests {
+		nl := "\n"
+		if strings.Contains(tt.before, "\r\n") {
+			nl = "\r\n"
+		}
+		raw := tt.before + tt.after
+		if tt.block {
+			raw = tt.before + "# BEGIN test" + nl + "10.0.0.1 old" + nl + "# END test" + nl + tt.after
+		}
+		path := filepath.Join(t.TempDir(), "hosts")
+		if err := os.WriteFile(path, []byte(raw), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = f.SetManaged("test", []Entry{entry}); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Save(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := "# BEGIN test" + nl + "10.0.0.5\tdb" + nl + "# END test" + nl
+		want := tt.before + block + tt.after
+		if !tt.block {
+			want = raw
+			if raw != "" && !strings.HasSuffix(raw, "\n") {
+				want += nl
+			}
+			want += block
+		}
+		if string(got) != want {
+			t.Errorf("%s: saved %q, want %q", tt.name, got, want)
+		}
+
+		// removing the block leaves the rest as it was
+		if err = f.SetManaged("test", nil); err != nil {
+			t.Fatal(err)
+		}
+		if rest := strings.Replace(want, block, "", 1); !bytes.Equal(f.Raw, []byte(rest)) {
+			t.Errorf("%s: without the block %q, want %q", tt.name, f.Raw, rest)
+		}
+	}
+}
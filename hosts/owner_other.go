@@ -0,0 +1,25 @@
+//go:build !windows
+
+package hosts
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepOwner chowns tmp to the owner of orig, skipped when nothing changes
+// so that users editing their own file need no privileges.
+func keepOwner(tmp *os.File, orig os.FileInfo) error {
+	want, ok := orig.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	cur, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if have, ok := cur.Sys().(*syscall.Stat_t); ok && have.Uid == want.Uid && have.Gid == want.Gid {
+		return nil
+	}
+	return tmp.Chown(int(want.Uid), int(want.Gid))
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package hosts
+
+import "os"
+
+// keepOwner is a no-op, a new file in the directory inherits its ACL.
+func keepOwner(tmp *os.File, orig os.FileInfo) error {
+	return nil
+}
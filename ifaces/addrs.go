@@ -0,0 +1,130 @@
+package ifaces
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// LifetimeForever is the lifetime of addresses that never expire.
+const LifetimeForever = 0xffffffff
+
+// address scopes
+const (
+	ScopeGlobal  = "global"
+	ScopeSite    = "site"
+	ScopeLink    = "link"
+	ScopeHost    = "host"
+	ScopeNowhere = "nowhere"
+)
+
+// Address is one address of an interface. Flags use the names of
+// `ip address`: secondary, temporary, nodad, optimistic, dadfailed,
+// homeaddress, deprecated, tentative, permanent, mngtmpaddr,
+// noprefixroute, autojoin and stable-privacy.
+type Address struct {
+	Index     int          `json:"index"`
+	Iface     string       `json:"iface"`
+	Prefix    netip.Prefix `json:"prefix"`
+	Peer      netip.Addr   `json:"peer"`      // point-to-point remote end
+	Broadcast netip.Addr   `json:"broadcast"` // IPv4 only
+	Scope     string       `json:"scope"`
+	Label     string       `json:"label"`
+	Flags     []string     `json:"flags"`
+	// seconds left, LifetimeForever for static addresses
+	ValidLifetime     uint32 `json:"valid_lft"`
+	PreferredLifetime uint32 `json:"preferred_lft"`
+}
+
+func (a Address) ToPortableJSON() string {
+	data, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (a Address) ToTableString() string {
+	extra := ""
+	if a.Peer.IsValid() {
+		extra += "\tpeer " + a.Peer.String()
+	}
+	if a.Broadcast.IsValid() {
+		extra += "\tbrd " + a.Broadcast.String()
+	}
+	return fmt.Sprintf("%d: %s\t%s%s\tscope %s\t%s\tvalid_lft %s\tpreferred_lft %s\n",
+		a.Index, a.Iface, a.Prefix, extra, a.Scope, strings.Join(a.Flags, ","),
+		lifetimeString(a.ValidLifetime), lifetimeString(a.PreferredLifetime))
+}
+
+func lifetimeString(lft uint32) string {
+	if lft == LifetimeForever {
+		return "forever"
+	}
+	return strconv.FormatUint(uint64(lft), 10) + "sec"
+}
+
+// HasFlag reports whether the address carries the flag name, e.g. "tentative".
+func (a Address) HasFlag(name string) bool {
+	for _, f := range a.Flags {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// netAddresses lists addresses through the net package: prefix and scope
+// only, the flags are empty and the lifetimes forever.
+func netAddresses() ([]Address, error) {
+	list, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]Address, 0)
+	for _, iface := range list {
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ipNet.IP)
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			ones, _ := ipNet.Mask.Size()
+			addrs = append(addrs, Address{
+				Index:             iface.Index,
+				Iface:             iface.Name,
+				Prefix:            netip.PrefixFrom(addr, ones),
+				Scope:             addrScope(addr),
+				Label:             iface.Name,
+				Flags:             make([]string, 0),
+				ValidLifetime:     LifetimeForever,
+				PreferredLifetime: LifetimeForever,
+			})
+		}
+	}
+	return addrs, nil
+}
+
+// addrScope derives the scope from the address itself.
+func addrScope(addr netip.Addr) string {
+	switch {
+	case addr.IsLoopback():
+		return ScopeHost
+	case addr.IsLinkLocalUnicast():
+		return ScopeLink
+	case addr.Is6() && netip.MustParsePrefix("fec0::/10").Contains(addr):
+		return ScopeSite
+	}
+	return ScopeGlobal
+}
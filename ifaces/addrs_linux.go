@@ -0,0 +1,207 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+const IF_INET6_PATH = "/proc/net/if_inet6"
+
+// IFA_F_* bits in the order of their names, bit 0 is secondary on IPv4
+var addrFlagNames = []string{
+	"temporary", "nodad", "optimistic", "dadfailed", "homeaddress", "deprecated",
+	"tentative", "permanent", "mngtmpaddr", "noprefixroute", "autojoin", "stable-privacy",
+}
+
+// Addresses dumps the addresses over rtnetlink. Without rtnetlink IPv6
+// flags come from /proc/net/if_inet6 and IPv4 from the net package.
+func Addresses() ([]Address, error) {
+	msgs, err := rtnl.Dump(unix.RTM_GETADDR, rtnl.IfAddrmsgBytes(&unix.IfAddrmsg{Family: unix.AF_UNSPEC}))
+	if err != nil {
+		return fallbackAddresses()
+	}
+	names := linkNames()
+	addrs := make([]Address, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWADDR {
+			continue
+		}
+		info, attrs, err := rtnl.IfAddrmsg(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		if a, ok := fromAddrMsg(info, attrs); ok {
+			a.Iface = names[a.Index]
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs, nil
+}
+
+func linkNames() map[int]string {
+	names := make(map[int]string)
+	if list, err := List(); err == nil {
+		for _, iface := range list {
+			names[iface.Index] = iface.Name
+		}
+	}
+	return names
+}
+
+func fromAddrMsg(info *unix.IfAddrmsg, attrs rtnl.Attrs) (Address, bool) {
+	a := Address{
+		Index:             int(info.Index),
+		Scope:             scopeName(info.Scope),
+		ValidLifetime:     LifetimeForever,
+		PreferredLifetime: LifetimeForever,
+	}
+	// IFA_LOCAL is the local end, IFA_ADDRESS the peer of point-to-point links
+	var local, address netip.Addr
+	if attr, ok := attrs.Get(unix.IFA_LOCAL); ok {
+		local, _ = netip.AddrFromSlice(attr.Data)
+	}
+	if attr, ok := attrs.Get(unix.IFA_ADDRESS); ok {
+		address, _ = netip.AddrFromSlice(attr.Data)
+	}
+	switch {
+	case local.IsValid():
+		a.Prefix = netip.PrefixFrom(local, int(info.Prefixlen))
+		if address.IsValid() && address != local {
+			a.Peer = address
+		}
+	case address.IsValid():
+		a.Prefix = netip.PrefixFrom(address, int(info.Prefixlen))
+	default:
+		return a, false
+	}
+	if attr, ok := attrs.Get(unix.IFA_BROADCAST); ok {
+		a.Broadcast, _ = netip.AddrFromSlice(attr.Data)
+	}
+	if attr, ok := attrs.Get(unix.IFA_LABEL); ok {
+		a.Label = attr.String()
+	}
+	// IFA_FLAGS carries the bits that do not fit ifa_flags
+	flags := uint32(info.Flags)
+	if attr, ok := attrs.Get(unix.IFA_FLAGS); ok {
+		flags = attr.Uint32()
+	}
+	a.Flags = addrFlags(flags, info.Family == unix.AF_INET)
+	if attr, ok := attrs.Get(unix.IFA_CACHEINFO); ok && len(attr.Data) >= unix.SizeofIfaCacheinfo {
+		ci := (*unix.IfaCacheinfo)(unsafe.Pointer(&attr.Data[0]))
+		a.ValidLifetime, a.PreferredLifetime = ci.Valid, ci.Prefered
+	}
+	return a, true
+}
+
+func addrFlags(flags uint32, ipv4 bool) []string {
+	names := make([]string, 0)
+	for i, name := range addrFlagNames {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		if i == 0 && ipv4 {
+			name = "secondary"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func scopeName(scope uint8) string {
+	switch scope {
+	case unix.RT_SCOPE_UNIVERSE:
+		return ScopeGlobal
+	case unix.RT_SCOPE_SITE:
+		return ScopeSite
+	case unix.RT_SCOPE_LINK:
+		return ScopeLink
+	case unix.RT_SCOPE_HOST:
+		return ScopeHost
+	case unix.RT_SCOPE_NOWHERE:
+		return ScopeNowhere
+	}
+	return strconv.Itoa(int(scope))
+}
+
+func fallbackAddresses() ([]Address, error) {
+	addrs, err := netAddresses()
+	if err != nil {
+		return nil, err
+	}
+	v6, err := readIfInet6(IF_INET6_PATH)
+	if err != nil {
+		return addrs, nil
+	}
+	merged := make([]Address, 0, len(addrs))
+	for _, a := range addrs {
+		if a.Prefix.Addr().Is4() {
+			merged = append(merged, a)
+		}
+	}
+	return append(merged, v6...), nil
+}
+
+// readIfInet6 parses /proc/net/if_inet6: address, ifindex, prefix length,
+// scope, flags in hex and the interface name. Lifetimes are not in there.
+func readIfInet6(path string) ([]Address, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	addrs := make([]Address, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[0])
+		if err != nil || len(raw) != 16 {
+			continue
+		}
+		index, err1 := strconv.ParseUint(fields[1], 16, 32)
+		plen, err2 := strconv.ParseUint(fields[2], 16, 8)
+		scope, err3 := strconv.ParseUint(fields[3], 16, 32)
+		flags, err4 := strconv.ParseUint(fields[4], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		addrs = append(addrs, Address{
+			Index:             int(index),
+			Iface:             fields[5],
+			Prefix:            netip.PrefixFrom(netip.AddrFrom16(*(*[16]byte)(raw)), int(plen)),
+			Scope:             ipv6ScopeName(scope),
+			Label:             fields[5],
+			Flags:             addrFlags(uint32(flags), false),
+			ValidLifetime:     LifetimeForever,
+			PreferredLifetime: LifetimeForever,
+		})
+	}
+	return addrs, scanner.Err()
+}
+
+// ipv6ScopeName maps the IPV6_ADDR_* scope bits of if_inet6.
+func ipv6ScopeName(scope uint64) string {
+	switch scope & 0xf0 {
+	case 0x00:
+		return ScopeGlobal
+	case 0x10:
+		return ScopeHost
+	case 0x20:
+		return ScopeLink
+	case 0x40:
+		return ScopeSite
+	}
+	return strconv.FormatUint(scope, 16)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ifaces
+
+// Addresses lists the addresses known to the net package, flags and
+// lifetimes are only available on Linux.
+func Addresses() ([]Address, error) {
+	return netAddresses()
+}
@@ -0,0 +1,81 @@
+package ifaces
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// configuration errors, a *ConfigError wraps one of them
+var (
+	ErrPermission   = errors.New("operation not permitted")
+	ErrExists       = errors.New("already exists")
+	ErrAddrNotFound = errors.New("address not found")
+	ErrInvalid      = errors.New("invalid argument")
+	ErrBusy         = errors.New("interface busy")
+)
+
+// ConfigError reports a failed change of an interface. Err is one of the
+// errors above, ErrNotFound or ErrUnsupported when the errno maps to one,
+// else the errno itself.
+type ConfigError struct {
+	Op    string
+	Iface string
+	Err   error
+	Errno syscall.Errno
+}
+
+func (e *ConfigError) Error() string {
+	return e.Op + " " + e.Iface + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func configError(op, iface string, err error) error {
+	if err == nil {
+		return nil
+	}
+	ce := &ConfigError{Op: op, Iface: iface, Err: err}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return ce
+	}
+	ce.Errno = errno
+	switch errno {
+	case syscall.EPERM, syscall.EACCES:
+		ce.Err = ErrPermission
+	case syscall.ENODEV:
+		ce.Err = ErrNotFound
+	case syscall.EEXIST:
+		ce.Err = ErrExists
+	case syscall.EADDRNOTAVAIL:
+		ce.Err = ErrAddrNotFound
+	case syscall.EINVAL, syscall.ERANGE:
+		ce.Err = ErrInvalid
+	case syscall.EBUSY:
+		ce.Err = ErrBusy
+	case syscall.EOPNOTSUPP:
+		ce.Err = ErrUnsupported
+	default:
+		ce.Err = errno
+	}
+	return ce
+}
+
+// NewConfigError wraps err of op on iface like the functions of this
+// package do, for packages changing links over the same APIs.
+func NewConfigError(op, iface string, err error) error {
+	return configError(op, iface, err)
+}
+
+// IndexOf returns the index of the interface name, a missing one is a
+// *ConfigError of op wrapping ErrNotFound.
+func IndexOf(op, name string) (int, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, &ConfigError{Op: op, Iface: name, Err: ErrNotFound}
+	}
+	return iface.Index, nil
+}
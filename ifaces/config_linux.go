@@ -0,0 +1,160 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"net"
+	"net/netip"
+	"unsafe"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// SetUp sets the interface administratively up.
+func SetUp(name string) error {
+	return setFlags("set up", name, unix.IFF_UP)
+}
+
+// SetDown sets the interface administratively down.
+func SetDown(name string) error {
+	return setFlags("set down", name, 0)
+}
+
+func setFlags(op, name string, flags uint32) error {
+	index, err := IndexOf(op, name)
+	if err != nil {
+		return err
+	}
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: int32(index), Flags: flags, Change: unix.IFF_UP})
+	return configError(op, name, rtnl.Request(unix.RTM_NEWLINK, 0, body))
+}
+
+// SetMTU changes the MTU.
+func SetMTU(name string, mtu int) error {
+	if mtu <= 0 {
+		return &ConfigError{Op: "set mtu", Iface: name, Err: ErrInvalid}
+	}
+	index, err := IndexOf("set mtu", name)
+	if err != nil {
+		return err
+	}
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: int32(index)})
+	body = rtnl.AppendUint32(body, unix.IFLA_MTU, uint32(mtu))
+	return configError("set mtu", name, rtnl.Request(unix.RTM_NEWLINK, 0, body))
+}
+
+// SetMAC changes the hardware address, many drivers want the link down for it.
+func SetMAC(name string, mac net.HardwareAddr) error {
+	if len(mac) == 0 {
+		return &ConfigError{Op: "set mac", Iface: name, Err: ErrInvalid}
+	}
+	return setLinkAttr("set mac", name, unix.IFLA_ADDRESS, mac)
+}
+
+// Rename changes the interface name, older kernels fail with ErrBusy while it is up.
+func Rename(name, newName string) error {
+	if newName == "" || len(newName) >= unix.IFNAMSIZ {
+		return &ConfigError{Op: "rename", Iface: name, Err: ErrInvalid}
+	}
+	return setLinkAttr("rename", name, unix.IFLA_IFNAME, append([]byte(newName), 0))
+}
+
+func setLinkAttr(op, name string, typ uint16, data []byte) error {
+	index, err := IndexOf(op, name)
+	if err != nil {
+		return err
+	}
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: int32(index)})
+	body = rtnl.AppendAttr(body, typ, data)
+	return configError(op, name, rtnl.Request(unix.RTM_NEWLINK, 0, body))
+}
+
+// AddAddress adds a.Prefix to the interface. Peer, Broadcast, Label and
+// Flags by name (nodad, noprefixroute, mngtmpaddr, homeaddress, autojoin)
+// are used when set. Zero lifetimes mean forever, otherwise both apply.
+func AddAddress(name string, a Address) error {
+	index, err := IndexOf("add address", name)
+	if err != nil {
+		return err
+	}
+	flags, err := flagBits(a.Flags)
+	if err != nil {
+		return &ConfigError{Op: "add address", Iface: name, Err: err}
+	}
+	valid, preferred := a.ValidLifetime, a.PreferredLifetime
+	if valid == 0 && preferred == 0 {
+		valid, preferred = LifetimeForever, LifetimeForever
+	}
+	body := addrBody(index, a.Prefix, a.Peer, uint8(flags))
+	if a.Broadcast.IsValid() {
+		body = rtnl.AppendAttr(body, unix.IFA_BROADCAST, a.Broadcast.AsSlice())
+	}
+	if a.Label != "" {
+		body = rtnl.AppendString(body, unix.IFA_LABEL, a.Label)
+	}
+	body = rtnl.AppendUint32(body, unix.IFA_FLAGS, flags)
+	ci := make([]byte, unix.SizeofIfaCacheinfo)
+	*(*unix.IfaCacheinfo)(unsafe.Pointer(&ci[0])) = unix.IfaCacheinfo{Prefered: preferred, Valid: valid}
+	body = rtnl.AppendAttr(body, unix.IFA_CACHEINFO, ci)
+	err = rtnl.Request(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, body)
+	return configError("add address", name, err)
+}
+
+// DeleteAddress removes prefix from the interface.
+func DeleteAddress(name string, prefix netip.Prefix) error {
+	index, err := IndexOf("delete address", name)
+	if err != nil {
+		return err
+	}
+	body := addrBody(index, prefix, netip.Addr{}, 0)
+	return configError("delete address", name, rtnl.Request(unix.RTM_DELADDR, 0, body))
+}
+
+// addrBody is an ifaddrmsg with IFA_LOCAL and IFA_ADDRESS, the peer on
+// point-to-point links.
+func addrBody(index int, prefix netip.Prefix, peer netip.Addr, flags uint8) []byte {
+	addr := prefix.Addr().Unmap()
+	family := uint8(unix.AF_INET6)
+	if addr.Is4() {
+		family = unix.AF_INET
+	}
+	scope := uint8(unix.RT_SCOPE_UNIVERSE)
+	if addr.Is4() && addr.IsLoopback() {
+		scope = unix.RT_SCOPE_HOST
+	}
+	body := rtnl.IfAddrmsgBytes(&unix.IfAddrmsg{
+		Family:    family,
+		Prefixlen: uint8(prefix.Bits()),
+		Flags:     flags,
+		Scope:     scope,
+		Index:     uint32(index),
+	})
+	remote := addr
+	if peer.IsValid() {
+		remote = peer.Unmap()
+	}
+	body = rtnl.AppendAttr(body, unix.IFA_LOCAL, addr.AsSlice())
+	return rtnl.AppendAttr(body, unix.IFA_ADDRESS, remote.AsSlice())
+}
+
+// flagBits turns flag names back into IFA_F_* bits.
+func flagBits(names []string) (uint32, error) {
+	var bits uint32
+	for _, name := range names {
+		if name == "secondary" {
+			name = addrFlagNames[0]
+		}
+		found := false
+		for i, n := range addrFlagNames {
+			if n == name {
+				bits |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, ErrInvalid
+		}
+	}
+	return bits, nil
+}
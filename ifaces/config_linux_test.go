@@ -0,0 +1,159 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/kmahyyg/go-network-compo/internal/netnstest"
+	"golang.org/x/sys/unix"
+)
+
+func findAddress(t *testing.T, prefix netip.Prefix) (Address, bool) {
+	t.Helper()
+	addrs, err := Addresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addrs {
+		if a.Prefix == prefix {
+			return a, true
+		}
+	}
+	return Address{}, false
+}
+
+func TestConfigErrors(t *testing.T) {
+	netnstest.Enter(t)
+	if err := SetUp("lo"); err != nil {
+		t.Fatal(err)
+	}
+	prefix := netip.MustParsePrefix("10.9.8.7/24")
+	if err := AddAddress("lo", Address{Prefix: prefix}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"add twice", AddAddress("lo", Address{Prefix: prefix}), ErrExists},
+		{"delete missing", DeleteAddress("lo", netip.MustParsePrefix("10.99.0.1/24")), ErrAddrNotFound},
+		{"unknown flag", AddAddress("lo", Address{Prefix: netip.MustParsePrefix("10.1.0.1/24"), Flags: []string{"bogus"}}), ErrInvalid},
+		{"no interface", SetUp("nonexistent0"), ErrNotFound},
+		{"no interface address", AddAddress("nonexistent0", Address{Prefix: prefix}), ErrNotFound},
+		{"zero mtu", SetMTU("lo", 0), ErrInvalid},
+		{"empty mac", SetMAC("lo", nil), ErrInvalid},
+		{"long name", Rename("lo", "a-name-longer-than-ifnamsiz"), ErrInvalid},
+	}
+	for _, tt := range tests {
+		var ce *ConfigError
+		if !errors.As(tt.err, &ce) {
+			t.Errorf("%s: %v is not a *ConfigError", tt.name, tt.err)
+			continue
+		}
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, tt.err, tt.want)
+		}
+		if ce.Iface == "" || ce.Op == "" {
+			t.Errorf("%s: op %q iface %q", tt.name, ce.Op, ce.Iface)
+		}
+	}
+
+	if err := DeleteAddress("lo", prefix); err != nil {
+		t.Fatal(err)
+	}
+	err := DeleteAddress("lo", prefix)
+	var ce *ConfigError
+	if !errors.Is(err, ErrAddrNotFound) || !errors.As(err, &ce) || ce.Errno != unix.EADDRNOTAVAIL {
+		t.Errorf("delete twice: %v", err)
+	}
+}
+
+func TestAddressRoundTrip(t *testing.T) {
+	netnstest.Enter(t)
+	if err := SetUp("lo"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		addr      Address
+		valid     uint32
+		preferred uint32
+		flags     []string
+	}{
+		{"forever", Address{Prefix: netip.MustParsePrefix("10.20.0.1/16"), Label: "lo:test"},
+			LifetimeForever, LifetimeForever, nil},
+		{"v4 lifetimes", Address{Prefix: netip.MustParsePrefix("10.30.0.1/24"), ValidLifetime: 3600, PreferredLifetime: 1800},
+			3600, 1800, nil},
+		{"v6 lifetimes", Address{Prefix: netip.MustParsePrefix("2001:db8::10/64"), ValidLifetime: 600, PreferredLifetime: 0,
+			Flags: []string{"nodad"}}, 600, 0, []string{"nodad"}},
+		{"v6 flags", Address{Prefix: netip.MustParsePrefix("2001:db8:1::10/64"), Flags: []string{"nodad", "noprefixroute"}},
+			LifetimeForever, LifetimeForever, []string{"nodad", "noprefixroute"}},
+	}
+	for _, tt := range tests {
+		if err := AddAddress("lo", tt.addr); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := findAddress(t, tt.addr.Prefix)
+		if !ok {
+			t.Fatalf("%s: %s not listed", tt.name, tt.addr.Prefix)
+		}
+		if got.Iface != "lo" {
+			t.Errorf("%s: iface %q", tt.name, got.Iface)
+		}
+		// the kernel counts down from the time it added the address
+		if got.ValidLifetime > tt.valid || tt.valid-got.ValidLifetime > 2 {
+			t.Errorf("%s: valid lifetime %d, want %d", tt.name, got.ValidLifetime, tt.valid)
+		}
+		if got.PreferredLifetime > tt.preferred || tt.preferred-got.PreferredLifetime > 2 {
+			t.Errorf("%s: preferred lifetime %d, want %d", tt.name, got.PreferredLifetime, tt.preferred)
+		}
+		for _, f := range tt.flags {
+			if !got.HasFlag(f) {
+				t.Errorf("%s: flags %v, want %s", tt.name, got.Flags, f)
+			}
+		}
+		if tt.addr.Label != "" && got.Label != tt.addr.Label {
+			t.Errorf("%s: label %q, want %q", tt.name, got.Label, tt.addr.Label)
+		}
+		if tt.preferred == 0 && !got.HasFlag("deprecated") {
+			t.Errorf("%s: flags %v, a zero preferred lifetime deprecates the address", tt.name, got.Flags)
+		}
+		if err := DeleteAddress("lo", tt.addr.Prefix); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := findAddress(t, tt.addr.Prefix); ok {
+			t.Errorf("%s still listed after delete", tt.addr.Prefix)
+		}
+	}
+}
+
+func TestLinkSettings(t *testing.T) {
+	netnstest.Enter(t)
+	if err := SetMTU("lo", 1500); err != nil {
+		t.Fatal(err)
+	}
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].MTU != 1500 {
+		t.Errorf("interfaces %+v, want lo with mtu 1500", list)
+	}
+	if err := Rename("lo", "lo-renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUp("lo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("old name after rename: %v", err)
+	}
+	if err := SetUp("lo-renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDown("lo-renamed"); err != nil {
+		t.Fatal(err)
+	}
+}
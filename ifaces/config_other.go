@@ -0,0 +1,38 @@
+//go:build !linux
+
+package ifaces
+
+import (
+	"net"
+	"net/netip"
+)
+
+// The configuration functions are implemented over rtnetlink, Linux only.
+
+func SetUp(name string) error {
+	return &ConfigError{Op: "set up", Iface: name, Err: ErrUnsupported}
+}
+
+func SetDown(name string) error {
+	return &ConfigError{Op: "set down", Iface: name, Err: ErrUnsupported}
+}
+
+func SetMTU(name string, mtu int) error {
+	return &ConfigError{Op: "set mtu", Iface: name, Err: ErrUnsupported}
+}
+
+func SetMAC(name string, mac net.HardwareAddr) error {
+	return &ConfigError{Op: "set mac", Iface: name, Err: ErrUnsupported}
+}
+
+func Rename(name, newName string) error {
+	return &ConfigError{Op: "rename", Iface: name, Err: ErrUnsupported}
+}
+
+func AddAddress(name string, a Address) error {
+	return &ConfigError{Op: "add address", Iface: name, Err: ErrUnsupported}
+}
+
+func DeleteAddress(name string, prefix netip.Prefix) error {
+	return &ConfigError{Op: "delete address", Iface: name, Err: ErrUnsupported}
+}
@@ -0,0 +1,193 @@
+package ifaces
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// Counters are the traffic counters of one interface at Time. Bits is
+// the counter width, 32 bit counters wrap and are unwrapped by Sampler.
+type Counters struct {
+	Index       int       `json:"index"`
+	Name        string    `json:"name"`
+	Time        time.Time `json:"time"`
+	Bits        int       `json:"bits"`
+	RxBytes     uint64    `json:"rx_bytes"`
+	RxPackets   uint64    `json:"rx_packets"`
+	RxErrors    uint64    `json:"rx_errors"`
+	RxDropped   uint64    `json:"rx_dropped"`
+	RxMulticast uint64    `json:"rx_multicast"` // non-unicast packets on Windows
+	TxBytes     uint64    `json:"tx_bytes"`
+	TxPackets   uint64    `json:"tx_packets"`
+	TxErrors    uint64    `json:"tx_errors"`
+	TxDropped   uint64    `json:"tx_dropped"`
+}
+
+func (c Counters) ToPortableJSON() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (c Counters) ToTableString() string {
+	return fmt.Sprintf("%d: %s\trx %d bytes %d packets %d errors %d dropped %d multicast\ttx %d bytes %d packets %d errors %d dropped\n",
+		c.Index, c.Name, c.RxBytes, c.RxPackets, c.RxErrors, c.RxDropped, c.RxMulticast,
+		c.TxBytes, c.TxPackets, c.TxErrors, c.TxDropped)
+}
+
+// Rates are per second averages over Interval.
+type Rates struct {
+	Index       int           `json:"index"`
+	Name        string        `json:"name"`
+	Interval    time.Duration `json:"interval"`
+	RxBytes     float64       `json:"rx_bytes"`
+	RxPackets   float64       `json:"rx_packets"`
+	RxErrors    float64       `json:"rx_errors"`
+	RxDropped   float64       `json:"rx_dropped"`
+	RxMulticast float64       `json:"rx_multicast"`
+	TxBytes     float64       `json:"tx_bytes"`
+	TxPackets   float64       `json:"tx_packets"`
+	TxErrors    float64       `json:"tx_errors"`
+	TxDropped   float64       `json:"tx_dropped"`
+}
+
+func (r Rates) ToPortableJSON() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (r Rates) ToTableString() string {
+	return fmt.Sprintf("%d: %s\trx %.0f B/s %.1f pkt/s\ttx %.0f B/s %.1f pkt/s\terrors %.1f/s\tdropped %.1f/s\tover %s\n",
+		r.Index, r.Name, r.RxBytes, r.RxPackets, r.TxBytes, r.TxPackets,
+		r.RxErrors+r.TxErrors, r.RxDropped+r.TxDropped, r.Interval)
+}
+
+// Sampler keeps the samples of a sliding window and turns them into rates.
+type Sampler struct {
+	Window time.Duration
+
+	mu      sync.Mutex
+	samples map[string][]Counters
+}
+
+// NewSampler returns a sampler averaging over window.
+func NewSampler(window time.Duration) *Sampler {
+	return &Sampler{Window: window, samples: make(map[string][]Counters)}
+}
+
+// key tells a recreated interface from the old one with the same index.
+func (c Counters) key() string {
+	return strconv.Itoa(c.Index) + "/" + c.Name
+}
+
+// Add records one reading of ReadCounters. Interfaces missing from it are forgotten.
+func (s *Sampler) Add(counters []Counters) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool, len(counters))
+	for _, c := range counters {
+		k := c.key()
+		seen[k] = true
+		list := append(s.samples[k], c)
+		// drop what is older than the window, keeping one sample at its start
+		cut := 0
+		for cut+1 < len(list) && c.Time.Sub(list[cut+1].Time) >= s.Window {
+			cut++
+		}
+		s.samples[k] = list[cut:]
+	}
+	for k := range s.samples {
+		if !seen[k] {
+			delete(s.samples, k)
+		}
+	}
+}
+
+// Sample reads the counters, adds them and returns the rates.
+func (s *Sampler) Sample() ([]Rates, error) {
+	counters, err := ReadCounters()
+	if err != nil {
+		return nil, err
+	}
+	s.Add(counters)
+	return s.Rates(), nil
+}
+
+// Rates averages the window of every interface with at least two samples.
+func (s *Sampler) Rates() []Rates {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rates := make([]Rates, 0, len(s.samples))
+	for _, list := range s.samples {
+		if len(list) < 2 {
+			continue
+		}
+		first, last := list[0], list[len(list)-1]
+		interval := last.Time.Sub(first.Time)
+		if interval <= 0 {
+			continue
+		}
+		// sum the steps, each step unwraps at most one wrap
+		var sum Counters
+		for i := 1; i < len(list); i++ {
+			sum = addDelta(sum, list[i-1], list[i])
+		}
+		sec := interval.Seconds()
+		rates = append(rates, Rates{
+			Index:       last.Index,
+			Name:        last.Name,
+			Interval:    interval,
+			RxBytes:     float64(sum.RxBytes) / sec,
+			RxPackets:   float64(sum.RxPackets) / sec,
+			RxErrors:    float64(sum.RxErrors) / sec,
+			RxDropped:   float64(sum.RxDropped) / sec,
+			RxMulticast: float64(sum.RxMulticast) / sec,
+			TxBytes:     float64(sum.TxBytes) / sec,
+			TxPackets:   float64(sum.TxPackets) / sec,
+			TxErrors:    float64(sum.TxErrors) / sec,
+			TxDropped:   float64(sum.TxDropped) / sec,
+		})
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Index < rates[j].Index })
+	return rates
+}
+
+func addDelta(sum, prev, cur Counters) Counters {
+	d := func(a, b uint64) uint64 {
+		return delta(a, b, cur.Bits)
+	}
+	sum.RxBytes += d(prev.RxBytes, cur.RxBytes)
+	sum.RxPackets += d(prev.RxPackets, cur.RxPackets)
+	sum.RxErrors += d(prev.RxErrors, cur.RxErrors)
+	sum.RxDropped += d(prev.RxDropped, cur.RxDropped)
+	sum.RxMulticast += d(prev.RxMulticast, cur.RxMulticast)
+	sum.TxBytes += d(prev.TxBytes, cur.TxBytes)
+	sum.TxPackets += d(prev.TxPackets, cur.TxPackets)
+	sum.TxErrors += d(prev.TxErrors, cur.TxErrors)
+	sum.TxDropped += d(prev.TxDropped, cur.TxDropped)
+	return sum
+}
+
+// delta is the increase from prev to cur. A 32 bit counter going down
+// wrapped, a 64 bit one was reset and counts from zero again.
+func delta(prev, cur uint64, bits int) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if bits == 32 && prev <= 0xffffffff {
+		return cur + (1 << 32) - prev
+	}
+	return cur
+}
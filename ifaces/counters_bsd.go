@@ -0,0 +1,8 @@
+//go:build dragonfly || freebsd || netbsd || openbsd
+
+package ifaces
+
+// ReadCounters is not implemented, the if_data layout differs on every BSD.
+func ReadCounters() ([]Counters, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,69 @@
+//go:build darwin
+
+package ifaces
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/route"
+)
+
+// https://github.com/apple/darwin-xnu/blob/main/bsd/net/if.h
+const (
+	NET_RT_IFLIST2 = 6
+	RTM_IFINFO2    = 0x12
+
+	ifMsghdr2SndDrops = 24 // int ifm_snd_drops in struct if_msghdr2
+	ifMsghdr2DataOff  = 32 // struct if_data64 in struct if_msghdr2
+)
+
+// ReadCounters reads the 64 bit counters of the if_msghdr2 messages
+// of sysctl NET_RT_IFLIST2, which x/net/route does not parse. if_data64 has
+// no output drops, TxDropped is the send queue drops of the message header
+// like netstat -d shows, a 32 bit count whose wrap is taken for a reset.
+func ReadCounters() ([]Counters, error) {
+	rib, err := route.FetchRIB(syscall.AF_UNSPEC, NET_RT_IFLIST2, 0)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	list := make([]Counters, 0)
+	for len(rib) >= 4 {
+		msgLen := int(binary.LittleEndian.Uint16(rib))
+		if msgLen < 4 || msgLen > len(rib) {
+			break
+		}
+		msg := rib[:msgLen]
+		rib = rib[msgLen:]
+		if msg[3] != RTM_IFINFO2 || len(msg) < ifMsghdr2DataOff+104 {
+			continue
+		}
+		data := msg[ifMsghdr2DataOff:]
+		// packed struct if_data64, counters start after type, mtu, metric and baudrate
+		field := func(off int) uint64 {
+			return binary.LittleEndian.Uint64(data[off:])
+		}
+		c := Counters{
+			Index:       int(binary.LittleEndian.Uint16(msg[12:])),
+			Time:        now,
+			Bits:        64,
+			RxPackets:   field(24),
+			RxErrors:    field(32),
+			TxPackets:   field(40),
+			TxErrors:    field(48),
+			RxBytes:     field(64),
+			TxBytes:     field(72),
+			RxMulticast: field(80),
+			RxDropped:   field(96),
+			TxDropped:   uint64(binary.LittleEndian.Uint32(msg[ifMsghdr2SndDrops:])),
+		}
+		if iface, err := net.InterfaceByIndex(c.Index); err == nil {
+			c.Name = iface.Name
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+const PROC_NET_DEV_PATH = "/proc/net/dev"
+
+// ReadCounters reads IFLA_STATS64 of every link, or /proc/net/dev without rtnetlink.
+func ReadCounters() ([]Counters, error) {
+	msgs, err := rtnl.Dump(unix.RTM_GETLINK, rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC}))
+	if err != nil {
+		return readProcNetDev(PROC_NET_DEV_PATH)
+	}
+	now := time.Now()
+	list := make([]Counters, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWLINK {
+			continue
+		}
+		info, attrs, err := rtnl.IfInfomsg(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		stats, ok := attrs.Get(unix.IFLA_STATS64)
+		if !ok || len(stats.Data) < 9*8 {
+			continue
+		}
+		c := Counters{Index: int(info.Index), Time: now, Bits: 64}
+		if a, ok := attrs.Get(unix.IFLA_IFNAME); ok {
+			c.Name = a.String()
+		}
+		// struct rtnl_link_stats64, the fields used here come first
+		field := func(i int) uint64 {
+			return rtnl.Attr{Data: stats.Data[i*8:]}.Uint64()
+		}
+		c.RxPackets, c.TxPackets = field(0), field(1)
+		c.RxBytes, c.TxBytes = field(2), field(3)
+		c.RxErrors, c.TxErrors = field(4), field(5)
+		c.RxDropped, c.TxDropped = field(6), field(7)
+		c.RxMulticast = field(8)
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// readProcNetDev parses "name: 8 receive columns 8 transmit columns".
+// The counters are unsigned long, 32 bit wide on 32 bit kernels.
+func readProcNetDev(path string) ([]Counters, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	now := time.Now()
+	list := make([]Counters, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			continue
+		}
+		v := make([]uint64, 16)
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		c := Counters{
+			Name:        strings.TrimSpace(name),
+			Time:        now,
+			Bits:        strconv.IntSize,
+			RxBytes:     v[0],
+			RxPackets:   v[1],
+			RxErrors:    v[2],
+			RxDropped:   v[3],
+			RxMulticast: v[7],
+			TxBytes:     v[8],
+			TxPackets:   v[9],
+			TxErrors:    v[10],
+			TxDropped:   v[11],
+		}
+		if iface, err := ByName(c.Name); err == nil {
+			c.Index = iface.Index
+		}
+		list = append(list, c)
+	}
+	return list, scanner.Err()
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package ifaces
+
+import (
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/wintypes"
+)
+
+// ReadCounters reads the 64 bit counters of GetIfTable2.
+func ReadCounters() ([]Counters, error) {
+	rows, err := wintypes.GetIfTable2()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	list := make([]Counters, 0, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.InterfaceAndOperStatusFlags&wintypes.IAOSFFilterInterface != 0 {
+			continue
+		}
+		list = append(list, Counters{
+			Index:       int(row.InterfaceIndex),
+			Name:        row.Alias(),
+			Time:        now,
+			Bits:        64,
+			RxBytes:     row.InOctets,
+			RxPackets:   row.InUcastPkts + row.InNUcastPkts,
+			RxErrors:    row.InErrors,
+			RxDropped:   row.InDiscards,
+			RxMulticast: row.InNUcastPkts,
+			TxBytes:     row.OutOctets,
+			TxPackets:   row.OutUcastPkts + row.OutNUcastPkts,
+			TxErrors:    row.OutErrors,
+			TxDropped:   row.OutDiscards,
+		})
+	}
+	return list, nil
+}
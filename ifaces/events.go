@@ -0,0 +1,288 @@
+package ifaces
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// event types
+const (
+	EventLinkAdded   = "link_added"
+	EventLinkRemoved = "link_removed"
+	EventLinkUp      = "link_up"
+	EventLinkDown    = "link_down"
+	EventLinkRenamed = "link_renamed"
+	EventMTUChanged  = "mtu_changed"
+	EventAddrAdded   = "addr_added"
+	EventAddrRemoved = "addr_removed"
+)
+
+// PollPeriod is how often systems without change notification are polled.
+var PollPeriod = 2 * time.Second
+
+// Event is one link or address change. Link is the interface after the
+// change, or before it for removals; Addr is set for address events.
+type Event struct {
+	Type    string       `json:"type"`
+	Time    time.Time    `json:"time"`
+	Index   int          `json:"index"`
+	Name    string       `json:"name"`
+	OldName string       `json:"old_name,omitempty"`
+	OldMTU  int          `json:"old_mtu,omitempty"`
+	Link    *Interface   `json:"link,omitempty"`
+	Addr    *Address     `json:"addr,omitempty"`
+	Prefix  netip.Prefix `json:"prefix"`
+	// found by comparing a full dump after lost notifications or a poll
+	Resync bool `json:"resync"`
+}
+
+func (e Event) ToPortableJSON() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (e Event) ToTableString() string {
+	detail := ""
+	switch e.Type {
+	case EventLinkRenamed:
+		detail = "from " + e.OldName
+	case EventMTUChanged:
+		detail = strconv.Itoa(e.OldMTU) + " -> " + strconv.Itoa(e.Link.MTU)
+	case EventAddrAdded, EventAddrRemoved:
+		detail = e.Prefix.String()
+	}
+	return fmt.Sprintf("%s\t%d: %s\t%s\n", e.Type, e.Index, e.Name, detail)
+}
+
+// Subscription delivers events until its context is done or Close.
+// Events and Errors are closed then.
+type Subscription struct {
+	Events <-chan Event
+	Errors <-chan error
+
+	events chan Event
+	errors chan error
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	state  *linkState
+}
+
+func newSubscription(ctx context.Context) (*Subscription, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{
+		events: make(chan Event, 64),
+		errors: make(chan error, 4),
+		cancel: cancel,
+		state:  newLinkState(),
+	}
+	s.Events, s.Errors = s.events, s.errors
+	return s, ctx
+}
+
+// Close stops the subscription and waits for it to finish.
+func (s *Subscription) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// emit delivers events, false when the subscription is done.
+func (s *Subscription) emit(ctx context.Context, events []Event) bool {
+	for _, e := range events {
+		select {
+		case s.events <- e:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Subscription) sendErr(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+// prime loads the current state without emitting events for it.
+func (s *Subscription) prime() error {
+	links, err := List()
+	if err != nil {
+		return err
+	}
+	addrs, err := Addresses()
+	if err != nil {
+		return err
+	}
+	s.state.resync(links, addrs)
+	return nil
+}
+
+// resync diffs a full dump against the known state.
+func (s *Subscription) resync(ctx context.Context) bool {
+	links, err := List()
+	if err != nil {
+		s.sendErr(err)
+		return true
+	}
+	addrs, err := Addresses()
+	if err != nil {
+		s.sendErr(err)
+		return true
+	}
+	return s.emit(ctx, s.state.resync(links, addrs))
+}
+
+// linkState is the last known links and addresses, events are the
+// differences to it.
+type linkState struct {
+	links map[int]Interface
+	addrs map[string]Address
+}
+
+func newLinkState() *linkState {
+	return &linkState{links: make(map[int]Interface), addrs: make(map[string]Address)}
+}
+
+func addrKey(a Address) string {
+	return strconv.Itoa(a.Index) + "/" + a.Prefix.String()
+}
+
+// isUp reports whether the link can pass traffic, loopback and tun
+// report an unknown operational state when running.
+func isUp(i Interface) bool {
+	return i.AdminUp && (i.OperState == OperUp || i.OperState == OperUnknown)
+}
+
+func (st *linkState) link(iface Interface) []Event {
+	now := time.Now()
+	link := iface
+	ev := func(typ string) Event {
+		return Event{Type: typ, Time: now, Index: iface.Index, Name: iface.Name, Link: &link}
+	}
+	old, ok := st.links[iface.Index]
+	st.links[iface.Index] = iface
+	if !ok {
+		events := []Event{ev(EventLinkAdded)}
+		if isUp(iface) {
+			events = append(events, ev(EventLinkUp))
+		}
+		return events
+	}
+	events := make([]Event, 0)
+	if old.Name != iface.Name {
+		e := ev(EventLinkRenamed)
+		e.OldName = old.Name
+		events = append(events, e)
+	}
+	if old.MTU != iface.MTU {
+		e := ev(EventMTUChanged)
+		e.OldMTU = old.MTU
+		events = append(events, e)
+	}
+	if up := isUp(iface); up != isUp(old) {
+		if up {
+			events = append(events, ev(EventLinkUp))
+		} else {
+			events = append(events, ev(EventLinkDown))
+		}
+	}
+	return events
+}
+
+func (st *linkState) removeLink(index int) []Event {
+	old, ok := st.links[index]
+	if !ok {
+		return nil
+	}
+	delete(st.links, index)
+	events := make([]Event, 0)
+	// the kernel drops the addresses with the link
+	for _, a := range st.addrs {
+		if a.Index == index {
+			events = append(events, st.removeAddr(a)...)
+		}
+	}
+	return append(events, Event{Type: EventLinkRemoved, Time: time.Now(), Index: index, Name: old.Name, Link: &old})
+}
+
+func (st *linkState) addr(a Address) []Event {
+	k := addrKey(a)
+	_, ok := st.addrs[k]
+	st.addrs[k] = a
+	if ok {
+		// lifetime or flag update
+		return nil
+	}
+	return []Event{st.addrEvent(EventAddrAdded, a)}
+}
+
+func (st *linkState) removeAddr(a Address) []Event {
+	k := addrKey(a)
+	old, ok := st.addrs[k]
+	if !ok {
+		return nil
+	}
+	delete(st.addrs, k)
+	return []Event{st.addrEvent(EventAddrRemoved, old)}
+}
+
+func (st *linkState) addrEvent(typ string, a Address) Event {
+	e := Event{Type: typ, Time: time.Now(), Index: a.Index, Name: a.Iface, Addr: &a, Prefix: a.Prefix}
+	if link, ok := st.links[a.Index]; ok {
+		e.Name, e.Link = link.Name, &link
+	}
+	return e
+}
+
+// resync replaces the state with a full dump and returns the differences.
+func (st *linkState) resync(links []Interface, addrs []Address) []Event {
+	events := make([]Event, 0)
+	seenAddr := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		seenAddr[addrKey(a)] = true
+	}
+	for _, k := range sortedKeys(st.addrs) {
+		if !seenAddr[k] {
+			events = append(events, st.removeAddr(st.addrs[k])...)
+		}
+	}
+	seenLink := make(map[int]bool, len(links))
+	for _, l := range links {
+		seenLink[l.Index] = true
+	}
+	for index := range st.links {
+		if !seenLink[index] {
+			events = append(events, st.removeLink(index)...)
+		}
+	}
+	for _, l := range links {
+		events = append(events, st.link(l)...)
+	}
+	for _, a := range addrs {
+		events = append(events, st.addr(a)...)
+	}
+	for i := range events {
+		events[i].Resync = true
+	}
+	return events
+}
+
+func sortedKeys(m map[string]Address) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
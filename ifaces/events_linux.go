@@ -0,0 +1,99 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+const eventGroups = unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR
+
+// Subscribe listens to the rtnetlink link and address groups. Lost
+// notifications (ENOBUFS) trigger a full dump, diffed against the known state.
+func Subscribe(ctx context.Context) (*Subscription, error) {
+	// listen before the dump, a change in between is seen twice at worst
+	conn, err := rtnl.Listen(eventGroups)
+	if err != nil {
+		return nil, err
+	}
+	s, ctx := newSubscription(ctx)
+	if err = s.prime(); err != nil {
+		s.cancel()
+		conn.Close()
+		return nil, err
+	}
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer s.wg.Done()
+		defer close(s.errors)
+		defer close(s.events)
+		s.read(ctx, conn)
+	}()
+	return s, nil
+}
+
+func (s *Subscription) read(ctx context.Context, conn *rtnl.Conn) {
+	for {
+		msgs, err := conn.Receive()
+		if errors.Is(err, unix.ENOBUFS) {
+			if !s.resync(ctx) {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				s.sendErr(err)
+				s.cancel()
+			}
+			return
+		}
+		for _, m := range msgs {
+			if !s.emit(ctx, s.handle(m)) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Subscription) handle(m rtnl.Message) []Event {
+	switch m.Type {
+	case unix.RTM_NEWLINK, unix.RTM_DELLINK:
+		info, attrs, err := rtnl.IfInfomsg(m.Data)
+		// bridges notify port changes on the same group with AF_BRIDGE,
+		// a port leaving its bridge is an RTM_DELLINK of that family
+		if err != nil || info.Family != unix.AF_UNSPEC {
+			return nil
+		}
+		if m.Type == unix.RTM_DELLINK {
+			return s.state.removeLink(int(info.Index))
+		}
+		return s.state.link(fromLink(info, attrs))
+	case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+		info, attrs, err := rtnl.IfAddrmsg(m.Data)
+		if err != nil {
+			return nil
+		}
+		a, ok := fromAddrMsg(info, attrs)
+		if !ok {
+			return nil
+		}
+		if link, ok := s.state.links[a.Index]; ok {
+			a.Iface = link.Name
+		}
+		if m.Type == unix.RTM_DELADDR {
+			return s.state.removeAddr(a)
+		}
+		return s.state.addr(a)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+func readCapture(t *testing.T, path string) []rtnl.Message {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msgs := make([]rtnl.Message, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		typ, data, _ := strings.Cut(line, " ")
+		n, err := strconv.Atoi(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := hex.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, rtnl.Message{Type: uint16(n), Data: b})
+	}
+	return msgs
+}
+
+func TestHandleIgnoresBridgeFamily(t *testing.T) {
+	s, _ := newSubscription(context.Background())
+	defer s.cancel()
+	port := Interface{Index: 4, Name: "p0", MTU: 1500, AdminUp: true, OperState: OperUp}
+	addr := Address{Index: 4, Iface: "p0", Prefix: netip.MustParsePrefix("10.0.0.1/24")}
+	s.state.resync([]Interface{port}, []Address{addr})
+
+	msgs := readCapture(t, "testdata/bridge_port_events.txt")
+	if len(msgs) == 0 {
+		t.Fatal("empty capture")
+	}
+	for _, m := range msgs {
+		if events := s.handle(m); len(events) != 0 {
+			t.Errorf("AF_BRIDGE message type %d emitted %v", m.Type, events)
+		}
+	}
+	if _, ok := s.state.links[4]; !ok {
+		t.Error("port dropped from the link state")
+	}
+
+	// the same index deleted with AF_UNSPEC is a real removal
+	del := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: 4})
+	events := s.handle(rtnl.Message{Type: unix.RTM_DELLINK, Data: del})
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if strings.Join(types, ",") != EventAddrRemoved+","+EventLinkRemoved {
+		t.Errorf("AF_UNSPEC RTM_DELLINK events = %v", types)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package ifaces
+
+import (
+	"context"
+	"time"
+)
+
+// Subscribe polls the links and addresses every PollPeriod and emits
+// the differences, there is no change notification used here.
+func Subscribe(ctx context.Context) (*Subscription, error) {
+	s, ctx := newSubscription(ctx)
+	if err := s.prime(); err != nil {
+		s.cancel()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(s.errors)
+		defer close(s.events)
+		ticker := time.NewTicker(PollPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !s.resync(ctx) {
+					return
+				}
+			}
+		}
+	}()
+	return s, nil
+}
@@ -0,0 +1,132 @@
+package ifaces
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/routes"
+)
+
+// interface types, kinds without a constant here are passed through, e.g. "vxlan"
+const (
+	TypeEthernet  = "ethernet"
+	TypeWireless  = "wireless"
+	TypeLoopback  = "loopback"
+	TypeTun       = "tun"
+	TypeTap       = "tap"
+	TypeWireguard = "wireguard"
+	TypeBridge    = "bridge"
+	TypeVLAN      = "vlan"
+	TypeVeth      = "veth"
+	TypeBond      = "bond"
+	TypePPP       = "ppp"
+	TypeOther     = "other"
+)
+
+// operational states, RFC 2863 ifOperStatus
+const (
+	OperUnknown        = "unknown"
+	OperNotPresent     = "notpresent"
+	OperDown           = "down"
+	OperLowerLayerDown = "lowerlayerdown"
+	OperTesting        = "testing"
+	OperDormant        = "dormant"
+	OperUp             = "up"
+)
+
+var ErrNotFound = errors.New("interface not found")
+
+// Interface describes one network interface. Name is what routes.NetRoute.NetIf
+// holds: the device name, or the friendly name on Windows.
+type Interface struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	Alias     string `json:"alias"` // ifalias on Linux, description on Windows
+	MAC       string `json:"mac"`
+	MTU       int    `json:"mtu"`
+	AdminUp   bool   `json:"admin_up"`
+	OperState string `json:"oper_state"`
+	Type      string `json:"type"`
+	Speed     int64  `json:"speed"` // Mbit/s, 0 when unknown
+	Driver    string `json:"driver"`
+}
+
+func (i Interface) ToPortableJSON() string {
+	data, err := json.Marshal(i)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (i Interface) ToTableString() string {
+	admin := "down"
+	if i.AdminUp {
+		admin = "up"
+	}
+	return fmt.Sprintf("%d: %s\t%s\tmac %s\tmtu %d\tadmin %s\toper %s\tspeed %d\tdriver %s\t%s\n",
+		i.Index, i.Name, i.Type, i.MAC, i.MTU, admin, i.OperState, i.Speed, i.Driver, i.Alias)
+}
+
+// ByName returns the interface called name.
+func ByName(name string) (*Interface, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ByIndex returns the interface with the given index.
+func ByIndex(index int) (*Interface, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Index == index {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ForRoute returns the interface a route leaves through.
+func ForRoute(nr routes.NetRoute) (*Interface, error) {
+	return ByName(nr.NetIf)
+}
+
+// typeFromName guesses the type from common naming schemes.
+func typeFromName(name string) string {
+	prefixes := []struct {
+		prefix, typ string
+	}{
+		{"wg", TypeWireguard},
+		{"utun", TypeTun},
+		{"tun", TypeTun},
+		{"tap", TypeTap},
+		{"bridge", TypeBridge},
+		{"br", TypeBridge},
+		{"bond", TypeBond},
+		{"lagg", TypeBond},
+		{"veth", TypeVeth},
+		{"epair", TypeVeth},
+		{"vlan", TypeVLAN},
+		{"ppp", TypePPP},
+		{"lo", TypeLoopback},
+	}
+	name = strings.ToLower(name)
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p.prefix) {
+			return p.typ
+		}
+	}
+	return ""
+}
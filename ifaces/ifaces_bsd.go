@@ -0,0 +1,86 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package ifaces
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/net/route"
+)
+
+// IFT_IEEE80211, missing from syscall on darwin where wifi is IFT_ETHER
+const iftIEEE80211 = 0x47
+
+// List reads the interface messages of the routing socket.
+// Speed and driver are not available here.
+func List() ([]Interface, error) {
+	rib, err := route.FetchRIB(syscall.AF_UNSPEC, route.RIBTypeInterface, 0)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := route.ParseRIB(route.RIBTypeInterface, rib)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Interface, 0)
+	for _, m := range msgs {
+		imsg, ok := m.(*route.InterfaceMessage)
+		if !ok {
+			continue
+		}
+		iface := Interface{
+			Index:     imsg.Index,
+			Name:      imsg.Name,
+			AdminUp:   imsg.Flags&syscall.IFF_UP != 0,
+			OperState: OperDown,
+		}
+		if imsg.Flags&syscall.IFF_RUNNING != 0 {
+			iface.OperState = OperUp
+		}
+		if len(imsg.Addrs) > syscall.RTAX_IFP {
+			if la, ok := imsg.Addrs[syscall.RTAX_IFP].(*route.LinkAddr); ok {
+				if iface.Name == "" {
+					iface.Name = la.Name
+				}
+				if len(la.Addr) > 0 {
+					iface.MAC = net.HardwareAddr(la.Addr).String()
+				}
+			}
+		}
+		ift := 0
+		for _, sys := range imsg.Sys() {
+			if metrics, ok := sys.(*route.InterfaceMetrics); ok {
+				ift, iface.MTU = metrics.Type, metrics.MTU
+			}
+		}
+		iface.Type = ifType(ift, iface.Name)
+		list = append(list, iface)
+	}
+	return list, nil
+}
+
+// ifType maps the IFT_* type, virtual interfaces are told apart by name.
+func ifType(ift int, name string) string {
+	switch ift {
+	case syscall.IFT_LOOP:
+		return TypeLoopback
+	case syscall.IFT_BRIDGE:
+		return TypeBridge
+	case syscall.IFT_L2VLAN:
+		return TypeVLAN
+	case syscall.IFT_IEEE8023ADLAG:
+		return TypeBond
+	case syscall.IFT_PPP:
+		return TypePPP
+	case iftIEEE80211:
+		return TypeWireless
+	}
+	if t := typeFromName(name); t != "" {
+		return t
+	}
+	if ift == syscall.IFT_ETHER {
+		return TypeEthernet
+	}
+	return TypeOther
+}
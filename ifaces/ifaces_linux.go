@@ -0,0 +1,121 @@
+//go:build linux
+
+package ifaces
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+const SYS_CLASS_NET_PATH = "/sys/class/net"
+
+// IFLA_OPERSTATE values
+var operStates = []string{OperUnknown, OperNotPresent, OperDown, OperLowerLayerDown, OperTesting, OperDormant, OperUp}
+
+// List dumps the links over rtnetlink, speed and driver come from sysfs.
+func List() ([]Interface, error) {
+	msgs, err := rtnl.Dump(unix.RTM_GETLINK, rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC}))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Interface, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWLINK {
+			continue
+		}
+		info, attrs, err := rtnl.IfInfomsg(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, fromLink(info, attrs))
+	}
+	return list, nil
+}
+
+func fromLink(info *unix.IfInfomsg, attrs rtnl.Attrs) Interface {
+	iface := Interface{
+		Index:     int(info.Index),
+		AdminUp:   info.Flags&unix.IFF_UP != 0,
+		OperState: OperUnknown,
+	}
+	if a, ok := attrs.Get(unix.IFLA_IFNAME); ok {
+		iface.Name = a.String()
+	}
+	if a, ok := attrs.Get(unix.IFLA_IFALIAS); ok {
+		iface.Alias = a.String()
+	}
+	if a, ok := attrs.Get(unix.IFLA_MTU); ok {
+		iface.MTU = int(a.Uint32())
+	}
+	if a, ok := attrs.Get(unix.IFLA_OPERSTATE); ok && int(a.Uint8()) < len(operStates) {
+		iface.OperState = operStates[a.Uint8()]
+	}
+	if a, ok := attrs.Get(unix.IFLA_ADDRESS); ok && info.Type != unix.ARPHRD_LOOPBACK && len(a.Data) > 0 {
+		iface.MAC = net.HardwareAddr(a.Data).String()
+	}
+	kind := ""
+	if a, ok := attrs.Get(unix.IFLA_LINKINFO); ok {
+		if k, ok := a.Nested().Get(unix.IFLA_INFO_KIND); ok {
+			kind = k.String()
+		}
+	}
+	sysDir := filepath.Join(SYS_CLASS_NET_PATH, iface.Name)
+	iface.Type = linkType(sysDir, info.Type, kind, iface.Name)
+	iface.Speed = readSpeed(sysDir)
+	iface.Driver = kind
+	if target, err := os.Readlink(filepath.Join(sysDir, "device", "driver")); err == nil {
+		iface.Driver = filepath.Base(target)
+	}
+	return iface
+}
+
+func linkType(sysDir string, arphrd uint16, kind, name string) string {
+	switch kind {
+	case "":
+	case "tun":
+		// both modes share the kind, tap devices carry ethernet frames
+		if arphrd == unix.ARPHRD_ETHER {
+			return TypeTap
+		}
+		return TypeTun
+	default:
+		// bridge, vlan, veth, bond and wireguard kinds are the type names
+		return kind
+	}
+	switch arphrd {
+	case unix.ARPHRD_LOOPBACK:
+		return TypeLoopback
+	case unix.ARPHRD_ETHER:
+		if _, err := os.Stat(filepath.Join(sysDir, "wireless")); err == nil {
+			return TypeWireless
+		}
+		return TypeEthernet
+	case unix.ARPHRD_PPP:
+		return TypePPP
+	case unix.ARPHRD_NONE:
+		if t := typeFromName(name); t != "" {
+			return t
+		}
+		return TypeTun
+	}
+	return TypeOther
+}
+
+// readSpeed reads the link speed in Mbit/s, -1 or an error for links without one.
+func readSpeed(sysDir string) int64 {
+	data, err := os.ReadFile(filepath.Join(sysDir, "speed"))
+	if err != nil {
+		return 0
+	}
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || speed < 0 {
+		return 0
+	}
+	return speed
+}
@@ -0,0 +1,85 @@
+//go:build windows
+
+package ifaces
+
+import (
+	"net"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/wintypes"
+)
+
+var operStates = map[wintypes.IfOperStatus]string{
+	wintypes.IfOperStatusUp:             OperUp,
+	wintypes.IfOperStatusDown:           OperDown,
+	wintypes.IfOperStatusTesting:        OperTesting,
+	wintypes.IfOperStatusUnknown:        OperUnknown,
+	wintypes.IfOperStatusDormant:        OperDormant,
+	wintypes.IfOperStatusNotPresent:     OperNotPresent,
+	wintypes.IfOperStatusLowerLayerDown: OperLowerLayerDown,
+}
+
+// List reads GetIfTable2, NDIS filter interfaces are left out.
+func List() ([]Interface, error) {
+	rows, err := wintypes.GetIfTable2()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Interface, 0, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.InterfaceAndOperStatusFlags&wintypes.IAOSFFilterInterface != 0 {
+			continue
+		}
+		iface := Interface{
+			Index:     int(row.InterfaceIndex),
+			Name:      row.Alias(),
+			Alias:     row.Description(),
+			MTU:       int(row.MTU),
+			AdminUp:   row.AdminStatus == wintypes.NetIfAdminStatusUp,
+			OperState: OperUnknown,
+			Type:      ifType(row),
+		}
+		if mac := row.PhysicalAddress(); len(mac) > 0 {
+			iface.MAC = net.HardwareAddr(mac).String()
+		}
+		if state, ok := operStates[row.OperStatus]; ok {
+			iface.OperState = state
+		}
+		// bit/s, all ones when unknown
+		if row.TransmitLinkSpeed != ^uint64(0) {
+			iface.Speed = int64(row.TransmitLinkSpeed / 1000000)
+		}
+		list = append(list, iface)
+	}
+	return list, nil
+}
+
+func ifType(row *wintypes.MibIfRow2) string {
+	switch row.Type {
+	case wintypes.IfTypeEthernetCSMACD:
+		if strings.Contains(strings.ToLower(row.Description()), "tap") {
+			return TypeTap
+		}
+		return TypeEthernet
+	case wintypes.IfTypeIEEE80211:
+		return TypeWireless
+	case wintypes.IfTypeSoftwareLoopback:
+		return TypeLoopback
+	case wintypes.IfTypePPP:
+		return TypePPP
+	case wintypes.IfTypeL2Vlan:
+		return TypeVLAN
+	case wintypes.IfTypeIEEE8023adLag:
+		return TypeBond
+	case wintypes.IfTypeTunnel:
+		return TypeTun
+	case wintypes.IfTypePropVirtual:
+		// wintun based adapters, WireGuard names its own
+		if strings.Contains(strings.ToLower(row.Description()), "wireguard") {
+			return TypeWireguard
+		}
+		return TypeTun
+	}
+	return TypeOther
+}
@@ -0,0 +1,116 @@
+// Package dnstest runs local stand-in nameservers for the tests of the
+// other packages. It works on wire format messages so dnsclient can use it
+// from its own tests.
+package dnstest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+)
+
+// Handler answers the wire format query b, nil sends nothing.
+type Handler func(b []byte) []byte
+
+// Server answers on loopback, UDP and TCP share the port. A nil handler
+// leaves that transport closed.
+type Server struct {
+	UDP, TCP Handler
+
+	udpHits int32
+	tcpHits int32
+}
+
+// UDPHits counts the datagrams received so far.
+func (s *Server) UDPHits() int {
+	return int(atomic.LoadInt32(&s.udpHits))
+}
+
+// TCPHits counts the stream messages received so far.
+func (s *Server) TCPHits() int {
+	return int(atomic.LoadInt32(&s.tcpHits))
+}
+
+// Start listens until the test ends and returns the server address.
+func (s *Server) Start(t testing.TB) netip.AddrPort {
+	t.Helper()
+	for try := 0; try < 10; try++ {
+		tl, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := tl.Addr().(*net.TCPAddr).AddrPort()
+		if s.UDP != nil {
+			ul, err := net.ListenPacket("udp", addr.String())
+			if err != nil {
+				tl.Close()
+				continue
+			}
+			t.Cleanup(func() { ul.Close() })
+			go s.serveUDP(ul)
+		}
+		if s.TCP != nil {
+			t.Cleanup(func() { tl.Close() })
+			go ServeStream(tl, func(b []byte) []byte {
+				atomic.AddInt32(&s.tcpHits, 1)
+				return s.TCP(b)
+			})
+		} else {
+			tl.Close()
+		}
+		return addr
+	}
+	t.Fatal("no free port for udp and tcp")
+	return netip.AddrPort{}
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.udpHits, 1)
+		if out := s.UDP(buf[:n]); out != nil {
+			conn.WriteTo(out, peer)
+		}
+	}
+}
+
+// ServeStream answers length prefixed messages on the connections of l,
+// TCP or TLS, until l is closed.
+func ServeStream(l net.Listener, h Handler) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var l [2]byte
+			for {
+				if _, err := io.ReadFull(conn, l[:]); err != nil {
+					return
+				}
+				b := make([]byte, binary.BigEndian.Uint16(l[:]))
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				out := h(b)
+				if out == nil {
+					continue
+				}
+				buf := make([]byte, 2+len(out))
+				binary.BigEndian.PutUint16(buf, uint16(len(out)))
+				copy(buf[2:], out)
+				if _, err := conn.Write(buf); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,4 @@
+// Package netnstest moves Linux tests into a fresh network namespace so they
+// can change interfaces without touching the host. It is empty on other
+// systems.
+package netnstest
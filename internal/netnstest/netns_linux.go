@@ -0,0 +1,47 @@
+//go:build linux
+
+package netnstest
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// Enter moves the test goroutine into a fresh network namespace, only lo
+// exists there. Tests not run as root are skipped. The thread is dropped
+// if it cannot go back. Subtests run on other goroutines, so callers must
+// not use t.Run.
+func Enter(t testing.TB) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root for a network namespace")
+	}
+	runtime.LockOSThread()
+	orig, err := os.Open(ThreadPath())
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Fatal(err)
+	}
+	if err = unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		orig.Close()
+		runtime.UnlockOSThread()
+		t.Skipf("unshare: %v", err)
+	}
+	t.Cleanup(func() {
+		defer orig.Close()
+		if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err != nil {
+			t.Errorf("setns back: %v", err)
+			return
+		}
+		runtime.UnlockOSThread()
+	})
+}
+
+// ThreadPath is the namespace file of the calling thread.
+func ThreadPath() string {
+	return "/proc/self/task/" + strconv.Itoa(unix.Gettid()) + "/ns/net"
+}
@@ -0,0 +1,206 @@
+package leakcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/dns"
+	"github.com/kmahyyg/go-network-compo/routes"
+)
+
+// tunnel interface name prefixes of common VPN clients, matched case-insensitively
+var tunnelPrefixes = []string{
+	"tun", "tap", "wg", "utun", "ppp", "ipsec", "gpd", "tailscale", "zt", "nordlynx",
+	"proton", "mullvad", "wintun", "wireguard", "openvpn", "tap-windows", "cscotun",
+}
+
+// Finding tells where the queries to one nameserver leave the host.
+type Finding struct {
+	Nameserver netip.Addr `json:"nameserver"`
+	Domains    []string   `json:"domains"` // split DNS domains sent to it, "." for everything else
+	Interface  string     `json:"iface,omitempty"`
+	Gateway    string     `json:"gateway,omitempty"`
+	Route      string     `json:"route,omitempty"` // matched destination
+	Tunnel     bool       `json:"tunnel"`
+	Leak       bool       `json:"leak"`
+	Unchecked  bool       `json:"unchecked"` // path unknown, e.g. local stub or no route found: may leak
+	Note       string     `json:"note,omitempty"`
+}
+
+func (f Finding) ToTableString() string {
+	mark := "ok"
+	switch {
+	case f.Leak:
+		mark = "LEAK"
+	case f.Unchecked:
+		mark = "UNCHECKED"
+	}
+	return fmt.Sprintf("%s\t%s\tdev %s\tvia %s\t%s\t%s\n", f.Nameserver, strings.Join(f.Domains, ","), f.Interface, f.Gateway, mark, f.Note)
+}
+
+// Report is the result of a leak check.
+type Report struct {
+	VPNActive bool      `json:"vpn_active"`
+	Tunnels   []string  `json:"tunnels"`
+	Findings  []Finding `json:"findings"`
+	Leaks     int       `json:"leaks"`
+	Unchecked int       `json:"unchecked"`
+}
+
+func (r *Report) ToPortableJSON() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (r *Report) ToTableString() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "vpn active: %v %v, leaks: %d, unchecked: %d\n", r.VPNActive, r.Tunnels, r.Leaks, r.Unchecked)
+	for _, f := range r.Findings {
+		sb.WriteString(f.ToTableString())
+	}
+	return sb.String()
+}
+
+// Options override the detected state, zero values detect it.
+type Options struct {
+	Tunnels []string // names of the VPN interfaces
+}
+
+// IsTunnel guesses from the name whether an interface belongs to a VPN.
+func IsTunnel(name string) bool {
+	lname := strings.ToLower(name)
+	for _, p := range tunnelPrefixes {
+		if strings.HasPrefix(lname, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectTunnels returns the up interfaces that look like VPN tunnels:
+// point-to-point ones and those with a known VPN name.
+func DetectTunnels() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	tunnels := make([]string, 0)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if iface.Flags&net.FlagPointToPoint != 0 || IsTunnel(iface.Name) {
+			tunnels = append(tunnels, iface.Name)
+		}
+	}
+	return tunnels, nil
+}
+
+// CheckSystem retrieves the DNS config and the tunnels and checks them like
+// Check. Routes come from routes.KernelLookup where available, so IPv6 and
+// policy routing (e.g. fwmark tables of WireGuard clients) are followed,
+// else from the main table of routes.Retrieve.
+func CheckSystem(opts Options) (*Report, error) {
+	cfg, err := dns.RetrieveConfig()
+	if err != nil {
+		return nil, err
+	}
+	table, err := routes.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Tunnels == nil {
+		if opts.Tunnels, err = DetectTunnels(); err != nil {
+			return nil, err
+		}
+	}
+	lookup := func(addr netip.Addr) (*routes.NetRoute, error) {
+		nr, err := routes.KernelLookup(addr)
+		if err == routes.ErrNoKernelLookup {
+			return routes.Lookup(table, addr)
+		}
+		return nr, err
+	}
+	return check(cfg, opts.Tunnels, lookup), nil
+}
+
+// Check looks up the route of every nameserver of the split DNS rules of cfg
+// in table. With a tunnel up, a server reached through another interface is
+// a leak. Servers whose path is not known are counted as unchecked.
+func Check(cfg *dns.Config, table []routes.NetRoute, tunnels []string) *Report {
+	return check(cfg, tunnels, func(addr netip.Addr) (*routes.NetRoute, error) {
+		return routes.Lookup(table, addr)
+	})
+}
+
+func check(cfg *dns.Config, tunnels []string, lookup func(netip.Addr) (*routes.NetRoute, error)) *Report {
+	isTunnel := make(map[string]bool)
+	for _, t := range tunnels {
+		isTunnel[t] = true
+	}
+	r := &Report{VPNActive: len(tunnels) != 0, Tunnels: append([]string{}, tunnels...), Findings: make([]Finding, 0)}
+
+	// one finding per server, in rule order
+	index := make(map[netip.Addr]int)
+	for _, rule := range cfg.SplitDNS().Rules {
+		for _, srv := range rule.Servers {
+			i, ok := index[srv.Addr()]
+			if !ok {
+				i = len(r.Findings)
+				index[srv.Addr()] = i
+				r.Findings = append(r.Findings, Finding{Nameserver: srv.Addr(), Domains: make([]string, 0)})
+			}
+			f := &r.Findings[i]
+			if !containsStr(f.Domains, rule.Domain) {
+				f.Domains = append(f.Domains, rule.Domain)
+			}
+		}
+	}
+
+	for i := range r.Findings {
+		f := &r.Findings[i]
+		sort.Strings(f.Domains)
+		addr := f.Nameserver
+		if addr.IsLoopback() {
+			f.Unchecked, f.Note = true, "local stub, its upstreams are not known"
+			r.Unchecked++
+			continue
+		}
+		nr, err := lookup(addr)
+		if err != nil {
+			// e.g. ipv6 on Linux without kernel lookup, Retrieve only reads the ipv4 table
+			f.Unchecked, f.Note = true, err.Error()
+			r.Unchecked++
+			continue
+		}
+		f.Interface = nr.NetIf
+		f.Route = nr.Destination
+		if !nr.OnLink() {
+			f.Gateway = nr.Gateway
+		} else {
+			f.Note = "on link"
+		}
+		f.Tunnel = isTunnel[nr.NetIf] || IsTunnel(nr.NetIf)
+		f.Leak = r.VPNActive && !f.Tunnel
+		if f.Leak {
+			r.Leaks++
+		}
+	}
+	return r
+}
+
+func containsStr(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package links
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// bridge port STP states, BR_STATE_* in kernel order
+var portStates = []string{"disabled", "listening", "learning", "forwarding", "blocking"}
+
+// Bridge is a bridge with its ports.
+type Bridge struct {
+	Index         int          `json:"index"`
+	Name          string       `json:"name"`
+	STP           bool         `json:"stp"`
+	VLANFiltering bool         `json:"vlan_filtering"`
+	VLANs         []BridgeVLAN `json:"vlans"` // of the bridge device itself
+	Ports         []BridgePort `json:"ports"`
+}
+
+// BridgePort is one port of a bridge.
+type BridgePort struct {
+	Index    int          `json:"index"`
+	Name     string       `json:"name"`
+	State    string       `json:"state"` // disabled, listening, learning, forwarding, blocking
+	Cost     uint32       `json:"cost"`
+	Priority uint16       `json:"priority"`
+	VLANs    []BridgeVLAN `json:"vlans"` // only with VLAN filtering
+}
+
+// BridgeVLAN is a VLAN allowed on a port.
+type BridgeVLAN struct {
+	ID       uint16 `json:"id"`
+	PVID     bool   `json:"pvid"`     // untagged ingress goes to this VLAN
+	Untagged bool   `json:"untagged"` // egress without tag
+}
+
+func (v BridgeVLAN) String() string {
+	s := fmt.Sprint(v.ID)
+	if v.PVID {
+		s += " PVID"
+	}
+	if v.Untagged {
+		s += " Egress Untagged"
+	}
+	return s
+}
+
+func (br Bridge) ToPortableJSON() string {
+	data, err := json.Marshal(br)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (br Bridge) ToTableString() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d: %s\tstp %t\tvlan_filtering %t\tvlans %s\n", br.Index, br.Name, br.STP, br.VLANFiltering, vlanList(br.VLANs))
+	for _, p := range br.Ports {
+		fmt.Fprintf(&sb, "\t%d: %s\t%s\tcost %d\tpriority %d\tvlans %s\n", p.Index, p.Name, p.State, p.Cost, p.Priority, vlanList(p.VLANs))
+	}
+	return sb.String()
+}
+
+func vlanList(vlans []BridgeVLAN) string {
+	list := make([]string, 0, len(vlans))
+	for _, v := range vlans {
+		list = append(list, v.String())
+	}
+	return strings.Join(list, ",")
+}
+
+// FDBEntry is one entry of the bridge forwarding database, like `bridge fdb`.
+type FDBEntry struct {
+	MAC    string   `json:"mac"`
+	Iface  string   `json:"iface"`  // the port
+	Master string   `json:"master"` // the bridge, empty for entries of the device itself
+	VLAN   uint16   `json:"vlan,omitempty"`
+	Dst    string   `json:"dst,omitempty"` // remote endpoint of vxlan entries
+	State  string   `json:"state"`         // permanent, static, dynamic or stale
+	Flags  []string `json:"flags"`         // self, master, extern_learn, offload, router
+}
+
+func (e FDBEntry) ToPortableJSON() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (e FDBEntry) ToTableString() string {
+	return fmt.Sprintf("%s\tdev %s\tmaster %s\tvlan %d\tdst %s\t%s\t%s\n",
+		e.MAC, e.Iface, e.Master, e.VLAN, e.Dst, e.State, strings.Join(e.Flags, ","))
+}
+
+// Bond is a bond with its slaves, read from sysfs.
+type Bond struct {
+	Name        string      `json:"name"`
+	Mode        string      `json:"mode"`         // balance-rr, active-backup, ...
+	ActiveSlave string      `json:"active_slave"` // active-backup, balance-tlb and balance-alb only
+	Miimon      int         `json:"miimon"`
+	Slaves      []BondSlave `json:"slaves"`
+}
+
+// BondSlave is one slave of a bond.
+type BondSlave struct {
+	Name         string `json:"name"`
+	State        string `json:"state"`      // active or backup
+	MIIStatus    string `json:"mii_status"` // up, down, going_down, going_back
+	LinkFailures int    `json:"link_failures"`
+}
+
+func (b Bond) ToPortableJSON() string {
+	data, err := json.Marshal(b)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (b Bond) ToTableString() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\tmode %s\tactive %s\tmiimon %d\n", b.Name, b.Mode, b.ActiveSlave, b.Miimon)
+	for _, s := range b.Slaves {
+		fmt.Fprintf(&sb, "\t%s\t%s\tmii %s\tfailures %d\n", s.Name, s.State, s.MIIStatus, s.LinkFailures)
+	}
+	return sb.String()
+}
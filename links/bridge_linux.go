@@ -0,0 +1,272 @@
+//go:build linux
+
+package links
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// from linux/if_bridge.h and linux/rtnetlink.h, missing in x/sys
+const (
+	rtextFilterBRVLAN  = 1 << 1 // RTEXT_FILTER_BRVLAN
+	iflaBridgeVLANInfo = 2      // IFLA_BRIDGE_VLAN_INFO
+
+	bridgeVLANInfoPVID       = 1 << 1
+	bridgeVLANInfoUntagged   = 1 << 2
+	bridgeVLANInfoRangeBegin = 1 << 3
+	bridgeVLANInfoRangeEnd   = 1 << 4
+)
+
+// Bridges lists the bridges with their ports from /sys/class/net and the
+// VLANs of every port from the IFLA_AF_SPEC of an AF_BRIDGE link dump.
+func Bridges() ([]Bridge, error) {
+	entries, err := os.ReadDir(ifaces.SYS_CLASS_NET_PATH)
+	if err != nil {
+		return nil, err
+	}
+	vlans, err := bridgeVLANs()
+	if err != nil {
+		return nil, err
+	}
+	bridges := make([]Bridge, 0)
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(ifaces.SYS_CLASS_NET_PATH, e.Name(), "bridge")); err != nil {
+			continue
+		}
+		br := readBridge(ifaces.SYS_CLASS_NET_PATH, e.Name())
+		br.VLANs = append([]BridgeVLAN{}, vlans[br.Index]...)
+		for i := range br.Ports {
+			br.Ports[i].VLANs = append([]BridgeVLAN{}, vlans[br.Ports[i].Index]...)
+		}
+		bridges = append(bridges, br)
+	}
+	return bridges, nil
+}
+
+func readBridge(root, name string) Bridge {
+	dir := filepath.Join(root, name)
+	br := Bridge{
+		Index:         readSysInt(filepath.Join(dir, "ifindex")),
+		Name:          name,
+		STP:           readSysInt(filepath.Join(dir, "bridge", "stp_state")) > 0,
+		VLANFiltering: readSysInt(filepath.Join(dir, "bridge", "vlan_filtering")) > 0,
+		Ports:         make([]BridgePort, 0),
+	}
+	ports, _ := os.ReadDir(filepath.Join(dir, "brif"))
+	for _, p := range ports {
+		// brif/PORT links to the brport directory of the port
+		portDir := filepath.Join(dir, "brif", p.Name())
+		port := BridgePort{
+			Index:    readSysInt(filepath.Join(root, p.Name(), "ifindex")),
+			Name:     p.Name(),
+			State:    "unknown",
+			Cost:     uint32(readSysInt(filepath.Join(portDir, "path_cost"))),
+			Priority: uint16(readSysInt(filepath.Join(portDir, "priority"))),
+		}
+		if state := readSysInt(filepath.Join(portDir, "state")); state >= 0 && state < len(portStates) {
+			port.State = portStates[state]
+		}
+		br.Ports = append(br.Ports, port)
+	}
+	return br
+}
+
+// readSysInt reads a decimal or 0x hex sysfs value, -1 when unreadable.
+func readSysInt(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 0, 64)
+	if err != nil {
+		return -1
+	}
+	return int(v)
+}
+
+func readSysString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// bridgeVLANs returns the VLANs of the bridges and bridge ports by index.
+func bridgeVLANs() (map[int][]BridgeVLAN, error) {
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_BRIDGE})
+	body = rtnl.AppendUint32(body, unix.IFLA_EXT_MASK, rtextFilterBRVLAN)
+	msgs, err := rtnl.Dump(unix.RTM_GETLINK, body)
+	if err != nil {
+		return nil, err
+	}
+	vlans := make(map[int][]BridgeVLAN)
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWLINK {
+			continue
+		}
+		info, attrs, err := rtnl.IfInfomsg(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		spec, ok := attrs.Get(unix.IFLA_AF_SPEC)
+		if !ok {
+			continue
+		}
+		rangeStart := uint16(0)
+		for _, a := range spec.Nested() {
+			if a.Type != iflaBridgeVLANInfo || len(a.Data) < 4 {
+				continue
+			}
+			// struct bridge_vlan_info: flags, vid
+			flags, vid := nativeUint16(a.Data[0:2]), nativeUint16(a.Data[2:4])
+			first := vid
+			switch {
+			case flags&bridgeVLANInfoRangeBegin != 0:
+				rangeStart = vid
+				continue
+			case flags&bridgeVLANInfoRangeEnd != 0 && rangeStart != 0:
+				first, rangeStart = rangeStart, 0
+			}
+			for id := first; id <= vid && id != 0; id++ {
+				vlans[int(info.Index)] = append(vlans[int(info.Index)], BridgeVLAN{
+					ID:       id,
+					PVID:     flags&bridgeVLANInfoPVID != 0,
+					Untagged: flags&bridgeVLANInfoUntagged != 0,
+				})
+			}
+		}
+	}
+	return vlans, nil
+}
+
+func nativeUint16(b []byte) uint16 {
+	return rtnl.Attr{Data: b}.Uint16()
+}
+
+// FDB dumps the forwarding database of bridge, every bridge when "".
+// Entries of bridge ports and of the bridge device itself are included,
+// as are the remote entries of vxlan devices.
+func FDB(bridge string) ([]FDBEntry, error) {
+	msgs, err := rtnl.Dump(unix.RTM_GETNEIGH, rtnl.NdMsgBytes(&unix.NdMsg{Family: unix.AF_BRIDGE}))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string)
+	if list, err := net.Interfaces(); err == nil {
+		for _, iface := range list {
+			names[iface.Index] = iface.Name
+		}
+	}
+	entries := make([]FDBEntry, 0)
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWNEIGH {
+			continue
+		}
+		nd, attrs, err := rtnl.NdMsg(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		e := FDBEntry{Iface: names[int(nd.Ifindex)], State: fdbState(nd.State), Flags: fdbFlags(nd.Flags)}
+		for _, a := range attrs {
+			switch a.Type {
+			case unix.NDA_LLADDR:
+				e.MAC = net.HardwareAddr(a.Data).String()
+			case unix.NDA_MASTER:
+				e.Master = names[int(a.Uint32())]
+			case unix.NDA_VLAN:
+				e.VLAN = a.Uint16()
+			case unix.NDA_DST:
+				if addr, ok := netip.AddrFromSlice(a.Data); ok {
+					e.Dst = addr.String()
+				}
+			}
+		}
+		if bridge != "" && e.Master != bridge && e.Iface != bridge {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func fdbState(state uint16) string {
+	switch {
+	case state&unix.NUD_PERMANENT != 0:
+		return "permanent"
+	case state&unix.NUD_NOARP != 0:
+		return "static"
+	case state&unix.NUD_STALE != 0:
+		return "stale"
+	}
+	return "dynamic"
+}
+
+func fdbFlags(flags uint8) []string {
+	names := make([]string, 0)
+	for _, f := range []struct {
+		bit  uint8
+		name string
+	}{
+		{unix.NTF_SELF, "self"},
+		{unix.NTF_MASTER, "master"},
+		{unix.NTF_EXT_LEARNED, "extern_learn"},
+		{unix.NTF_OFFLOADED, "offload"},
+		{unix.NTF_ROUTER, "router"},
+	} {
+		if flags&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// Bonds lists the bonds with mode, active slave and slaves from
+// /sys/class/net/*/bonding.
+func Bonds() ([]Bond, error) {
+	entries, err := os.ReadDir(ifaces.SYS_CLASS_NET_PATH)
+	if err != nil {
+		return nil, err
+	}
+	bonds := make([]Bond, 0)
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(ifaces.SYS_CLASS_NET_PATH, e.Name(), "bonding")); err != nil {
+			continue
+		}
+		bonds = append(bonds, readBond(ifaces.SYS_CLASS_NET_PATH, e.Name()))
+	}
+	return bonds, nil
+}
+
+func readBond(root, name string) Bond {
+	dir := filepath.Join(root, name, "bonding")
+	b := Bond{
+		Name:        name,
+		ActiveSlave: readSysString(filepath.Join(dir, "active_slave")),
+		Miimon:      readSysInt(filepath.Join(dir, "miimon")),
+		Slaves:      make([]BondSlave, 0),
+	}
+	// "active-backup 1"
+	if fields := strings.Fields(readSysString(filepath.Join(dir, "mode"))); len(fields) > 0 {
+		b.Mode = fields[0]
+	}
+	for _, slave := range strings.Fields(readSysString(filepath.Join(dir, "slaves"))) {
+		slaveDir := filepath.Join(root, slave, "bonding_slave")
+		b.Slaves = append(b.Slaves, BondSlave{
+			Name:         slave,
+			State:        readSysString(filepath.Join(slaveDir, "state")),
+			MIIStatus:    readSysString(filepath.Join(slaveDir, "mii_status")),
+			LinkFailures: readSysInt(filepath.Join(slaveDir, "link_failure_count")),
+		})
+	}
+	return b
+}
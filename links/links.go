@@ -0,0 +1,111 @@
+package links
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// link kinds, the IFLA_INFO_KIND names
+const (
+	KindDummy   = "dummy"
+	KindVeth    = "veth"
+	KindBridge  = "bridge"
+	KindVLAN    = "vlan"
+	KindMACVLAN = "macvlan"
+	KindIPVLAN  = "ipvlan"
+	KindBond    = "bond"
+)
+
+var ErrUnsupported = errors.New("virtual links are only supported on Linux")
+
+// Spec describes a link to create, Kind selects which fields apply.
+type Spec struct {
+	Name string
+	Kind string
+	MTU  int              // kernel default when 0
+	MAC  net.HardwareAddr // random when nil
+
+	Parent string // vlan, macvlan and ipvlan lower device
+
+	Peer      string // veth peer name
+	PeerNetNS string // netns of the peer, "/var/run/netns/NAME" or "/proc/PID/ns/net"
+
+	VLANID       int
+	VLANProtocol string // "802.1Q" when empty, or "802.1ad"
+
+	// macvlan: bridge, private, vepa, passthru, source
+	// ipvlan: l2, l3, l3s
+	// bond: balance-rr, active-backup, balance-xor, broadcast, 802.3ad, balance-tlb, balance-alb
+	Mode string
+
+	Miimon int // bond link monitoring interval in ms
+
+	STP           bool // bridge
+	VLANFiltering bool // bridge
+}
+
+// LinkInfo is a link read back with its link-info attributes.
+type LinkInfo struct {
+	Index         int    `json:"index"`
+	Name          string `json:"name"`
+	Kind          string `json:"kind"`
+	MTU           int    `json:"mtu"`
+	MAC           string `json:"mac"`
+	Master        string `json:"master"`     // bridge or bond it is attached to
+	SlaveKind     string `json:"slave_kind"` // kind of the master
+	Parent        string `json:"parent"`     // lower device, or the veth peer
+	ParentIndex   int    `json:"parent_index"`
+	ParentNetNSID int    `json:"parent_netnsid"` // -1 when the parent is in this netns
+	VLANID        int    `json:"vlan_id,omitempty"`
+	VLANProtocol  string `json:"vlan_protocol,omitempty"`
+	Mode          string `json:"mode,omitempty"`
+	Miimon        int    `json:"miimon,omitempty"`
+	STP           bool   `json:"stp,omitempty"`
+	VLANFiltering bool   `json:"vlan_filtering,omitempty"`
+}
+
+func (li LinkInfo) ToPortableJSON() string {
+	data, err := json.Marshal(li)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (li LinkInfo) ToTableString() string {
+	detail := ""
+	switch li.Kind {
+	case KindVLAN:
+		detail = fmt.Sprintf("id %d protocol %s", li.VLANID, li.VLANProtocol)
+	case KindMACVLAN, KindIPVLAN:
+		detail = "mode " + li.Mode
+	case KindBond:
+		detail = fmt.Sprintf("mode %s miimon %d", li.Mode, li.Miimon)
+	case KindBridge:
+		detail = fmt.Sprintf("stp %t vlan_filtering %t", li.STP, li.VLANFiltering)
+	}
+	return fmt.Sprintf("%d: %s\t%s\tparent %s\tmaster %s\tmtu %d\tmac %s\t%s\n",
+		li.Index, li.Name, li.Kind, li.Parent, li.Master, li.MTU, li.MAC, detail)
+}
+
+// mode names and their kernel values
+var (
+	macvlanModes = map[string]uint32{"private": 1, "vepa": 2, "bridge": 4, "passthru": 8, "source": 16}
+	ipvlanModes  = map[string]uint32{"l2": 0, "l3": 1, "l3s": 2}
+	bondModes    = map[string]uint32{
+		"balance-rr": 0, "active-backup": 1, "balance-xor": 2, "broadcast": 3,
+		"802.3ad": 4, "balance-tlb": 5, "balance-alb": 6,
+	}
+	vlanProtocols = map[string]uint32{"802.1Q": 0x8100, "802.1ad": 0x88a8}
+)
+
+func modeName(modes map[string]uint32, v uint32) string {
+	for name, mv := range modes {
+		if mv == v {
+			return name
+		}
+	}
+	return fmt.Sprint(v)
+}
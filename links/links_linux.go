@@ -0,0 +1,312 @@
+//go:build linux
+
+package links
+
+import (
+	"net"
+	"os"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+const vethInfoPeer = 1 // VETH_INFO_PEER
+
+// Add creates the link described by spec.
+func Add(spec Spec) error {
+	body, closeNS, err := newLinkBody(spec)
+	if closeNS != nil {
+		defer closeNS()
+	}
+	if err != nil {
+		return ifaces.NewConfigError("add "+spec.Kind, spec.Name, err)
+	}
+	err = rtnl.Request(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, body)
+	return ifaces.NewConfigError("add "+spec.Kind, spec.Name, err)
+}
+
+func newLinkBody(spec Spec) ([]byte, func(), error) {
+	body, err := newLinkHeader(spec.Name, spec.MTU, spec.MAC)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch spec.Kind {
+	case KindVLAN, KindMACVLAN, KindIPVLAN:
+		parent, err := net.InterfaceByName(spec.Parent)
+		if err != nil {
+			return nil, nil, ifaces.ErrNotFound
+		}
+		body = rtnl.AppendUint32(body, unix.IFLA_LINK, uint32(parent.Index))
+	}
+	var (
+		data    []byte
+		closeNS func()
+	)
+	switch spec.Kind {
+	case KindDummy:
+	case KindVeth:
+		if spec.Peer == "" {
+			return nil, nil, ifaces.ErrInvalid
+		}
+		peer := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC})
+		peer = rtnl.AppendString(peer, unix.IFLA_IFNAME, spec.Peer)
+		if spec.MTU > 0 {
+			peer = rtnl.AppendUint32(peer, unix.IFLA_MTU, uint32(spec.MTU))
+		}
+		if spec.PeerNetNS != "" {
+			ns, err := os.Open(spec.PeerNetNS)
+			if err != nil {
+				return nil, nil, err
+			}
+			closeNS = func() { ns.Close() }
+			peer = rtnl.AppendUint32(peer, unix.IFLA_NET_NS_FD, uint32(ns.Fd()))
+		}
+		// VETH_INFO_PEER holds an ifinfomsg followed by the peer attributes
+		data = rtnl.AppendAttr(data, vethInfoPeer, peer)
+	case KindBridge:
+		stp := uint32(0)
+		if spec.STP {
+			stp = 1
+		}
+		data = rtnl.AppendUint32(data, unix.IFLA_BR_STP_STATE, stp)
+		if spec.VLANFiltering {
+			data = rtnl.AppendAttr(data, unix.IFLA_BR_VLAN_FILTERING, []byte{1})
+		}
+	case KindVLAN:
+		if spec.VLANID < 1 || spec.VLANID > 4094 {
+			return nil, closeNS, ifaces.ErrInvalid
+		}
+		proto, ok := vlanProtocols["802.1Q"]
+		if spec.VLANProtocol != "" {
+			proto, ok = vlanProtocols[spec.VLANProtocol]
+		}
+		if !ok {
+			return nil, closeNS, ifaces.ErrInvalid
+		}
+		data = rtnl.AppendUint16(data, unix.IFLA_VLAN_ID, uint16(spec.VLANID))
+		// the protocol is in network byte order
+		data = rtnl.AppendAttr(data, unix.IFLA_VLAN_PROTOCOL, []byte{byte(proto >> 8), byte(proto)})
+	case KindMACVLAN:
+		mode, err := lookupMode(macvlanModes, spec.Mode, "bridge")
+		if err != nil {
+			return nil, closeNS, err
+		}
+		data = rtnl.AppendUint32(data, unix.IFLA_MACVLAN_MODE, mode)
+	case KindIPVLAN:
+		mode, err := lookupMode(ipvlanModes, spec.Mode, "l3")
+		if err != nil {
+			return nil, closeNS, err
+		}
+		data = rtnl.AppendUint16(data, unix.IFLA_IPVLAN_MODE, uint16(mode))
+	case KindBond:
+		mode, err := lookupMode(bondModes, spec.Mode, "balance-rr")
+		if err != nil {
+			return nil, closeNS, err
+		}
+		data = rtnl.AppendAttr(data, unix.IFLA_BOND_MODE, []byte{uint8(mode)})
+		if spec.Miimon > 0 {
+			data = rtnl.AppendUint32(data, unix.IFLA_BOND_MIIMON, uint32(spec.Miimon))
+		}
+	default:
+		return nil, closeNS, ifaces.ErrInvalid
+	}
+	return appendLinkInfo(body, spec.Kind, data), closeNS, nil
+}
+
+// newLinkHeader starts an RTM_NEWLINK body creating name.
+func newLinkHeader(name string, mtu int, mac net.HardwareAddr) ([]byte, error) {
+	if name == "" || len(name) >= unix.IFNAMSIZ {
+		return nil, ifaces.ErrInvalid
+	}
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC})
+	body = rtnl.AppendString(body, unix.IFLA_IFNAME, name)
+	if mtu > 0 {
+		body = rtnl.AppendUint32(body, unix.IFLA_MTU, uint32(mtu))
+	}
+	if len(mac) > 0 {
+		body = rtnl.AppendAttr(body, unix.IFLA_ADDRESS, mac)
+	}
+	return body, nil
+}
+
+func appendLinkInfo(body []byte, kind string, data []byte) []byte {
+	info := rtnl.AppendString(nil, unix.IFLA_INFO_KIND, kind)
+	if len(data) > 0 {
+		info = rtnl.AppendNested(info, unix.IFLA_INFO_DATA, data)
+	}
+	return rtnl.AppendNested(body, unix.IFLA_LINKINFO, info)
+}
+
+func lookupMode(modes map[string]uint32, name, def string) (uint32, error) {
+	if name == "" {
+		name = def
+	}
+	mode, ok := modes[name]
+	if !ok {
+		return 0, ifaces.ErrInvalid
+	}
+	return mode, nil
+}
+
+// Delete removes a link, deleting one end of a veth pair removes both.
+func Delete(name string) error {
+	index, err := ifaces.IndexOf("delete", name)
+	if err != nil {
+		return err
+	}
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: int32(index)})
+	return ifaces.NewConfigError("delete", name, rtnl.Request(unix.RTM_DELLINK, 0, body))
+}
+
+// SetMaster attaches a link to a bridge or bond, master "" detaches it.
+// Bond ports have to be down.
+func SetMaster(name, master string) error {
+	index, err := ifaces.IndexOf("set master", name)
+	if err != nil {
+		return err
+	}
+	masterIndex := 0
+	if master != "" {
+		if masterIndex, err = ifaces.IndexOf("set master", master); err != nil {
+			return err
+		}
+	}
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: int32(index)})
+	body = rtnl.AppendUint32(body, unix.IFLA_MASTER, uint32(masterIndex))
+	return ifaces.NewConfigError("set master", name, rtnl.Request(unix.RTM_NEWLINK, 0, body))
+}
+
+// SetNetNS moves a link into the netns at nsPath, "/var/run/netns/NAME"
+// or "/proc/PID/ns/net".
+func SetNetNS(name, nsPath string) error {
+	index, err := ifaces.IndexOf("set netns", name)
+	if err != nil {
+		return err
+	}
+	ns, err := os.Open(nsPath)
+	if err != nil {
+		return ifaces.NewConfigError("set netns", name, err)
+	}
+	defer ns.Close()
+	body := rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC, Index: int32(index)})
+	body = rtnl.AppendUint32(body, unix.IFLA_NET_NS_FD, uint32(ns.Fd()))
+	return ifaces.NewConfigError("set netns", name, rtnl.Request(unix.RTM_NEWLINK, 0, body))
+}
+
+// List dumps every link with its link-info attributes.
+func List() ([]LinkInfo, error) {
+	list := make([]LinkInfo, 0)
+	masters := make([]int, 0)
+	names := make(map[int]string)
+	err := dumpLinks(func(info *unix.IfInfomsg, attrs rtnl.Attrs) {
+		li, master := parseLink(info, attrs)
+		names[li.Index] = li.Name
+		list = append(list, li)
+		masters = append(masters, master)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Master = names[masters[i]]
+		// a parent in another netns has an index of that netns
+		if list[i].ParentNetNSID < 0 {
+			list[i].Parent = names[list[i].ParentIndex]
+		}
+	}
+	return list, nil
+}
+
+// Get returns one link by name.
+func Get(name string) (*LinkInfo, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i], nil
+		}
+	}
+	return nil, ifaces.ErrNotFound
+}
+
+func dumpLinks(fn func(info *unix.IfInfomsg, attrs rtnl.Attrs)) error {
+	msgs, err := rtnl.Dump(unix.RTM_GETLINK, rtnl.IfInfomsgBytes(&unix.IfInfomsg{Family: unix.AF_UNSPEC}))
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWLINK {
+			continue
+		}
+		info, attrs, err := rtnl.IfInfomsg(m.Data)
+		if err != nil {
+			return err
+		}
+		fn(info, attrs)
+	}
+	return nil
+}
+
+func parseLink(info *unix.IfInfomsg, attrs rtnl.Attrs) (LinkInfo, int) {
+	li := LinkInfo{Index: int(info.Index), ParentNetNSID: -1}
+	master := 0
+	for _, a := range attrs {
+		switch a.Type {
+		case unix.IFLA_IFNAME:
+			li.Name = a.String()
+		case unix.IFLA_MTU:
+			li.MTU = int(a.Uint32())
+		case unix.IFLA_ADDRESS:
+			li.MAC = net.HardwareAddr(a.Data).String()
+		case unix.IFLA_MASTER:
+			master = int(a.Uint32())
+		case unix.IFLA_LINK:
+			li.ParentIndex = int(a.Uint32())
+		case unix.IFLA_LINK_NETNSID:
+			li.ParentNetNSID = int(int32(a.Uint32()))
+		case unix.IFLA_LINKINFO:
+			parseLinkInfo(&li, a.Nested())
+		}
+	}
+	// indexes of a parent in another netns may equal our own
+	if li.ParentIndex == li.Index && li.ParentNetNSID < 0 {
+		li.ParentIndex = 0
+	}
+	return li, master
+}
+
+func parseLinkInfo(li *LinkInfo, attrs rtnl.Attrs) {
+	if a, ok := attrs.Get(unix.IFLA_INFO_KIND); ok {
+		li.Kind = a.String()
+	}
+	if a, ok := attrs.Get(unix.IFLA_INFO_SLAVE_KIND); ok {
+		li.SlaveKind = a.String()
+	}
+	a, ok := attrs.Get(unix.IFLA_INFO_DATA)
+	if !ok {
+		return
+	}
+	for _, d := range a.Nested() {
+		switch {
+		case li.Kind == KindVLAN && d.Type == unix.IFLA_VLAN_ID:
+			li.VLANID = int(d.Uint16())
+		case li.Kind == KindVLAN && d.Type == unix.IFLA_VLAN_PROTOCOL && len(d.Data) >= 2:
+			li.VLANProtocol = modeName(vlanProtocols, uint32(d.Data[0])<<8|uint32(d.Data[1]))
+		case li.Kind == KindMACVLAN && d.Type == unix.IFLA_MACVLAN_MODE:
+			li.Mode = modeName(macvlanModes, d.Uint32())
+		case li.Kind == KindIPVLAN && d.Type == unix.IFLA_IPVLAN_MODE:
+			li.Mode = modeName(ipvlanModes, uint32(d.Uint16()))
+		case li.Kind == KindBond && d.Type == unix.IFLA_BOND_MODE:
+			li.Mode = modeName(bondModes, uint32(d.Uint8()))
+		case li.Kind == KindBond && d.Type == unix.IFLA_BOND_MIIMON:
+			li.Miimon = int(d.Uint32())
+		case li.Kind == KindBridge && d.Type == unix.IFLA_BR_STP_STATE:
+			li.STP = d.Uint32() != 0
+		case li.Kind == KindBridge && d.Type == unix.IFLA_BR_VLAN_FILTERING:
+			li.VLANFiltering = d.Uint8() != 0
+		}
+	}
+}
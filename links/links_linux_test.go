@@ -0,0 +1,230 @@
+//go:build linux
+
+package links
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/internal/netnstest"
+	"golang.org/x/sys/unix"
+)
+
+// otherNetNS creates a second namespace next to the current one and
+// returns it open, its path works as Spec.PeerNetNS.
+func otherNetNS(t *testing.T) (*os.File, string) {
+	t.Helper()
+	cur, err := os.Open(netnstest.ThreadPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if err = unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		t.Fatal(err)
+	}
+	other, err := os.Open(netnstest.ThreadPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+	if err = unix.Setns(int(cur.Fd()), unix.CLONE_NEWNET); err != nil {
+		t.Fatal(err)
+	}
+	return other, "/proc/self/fd/" + strconv.Itoa(int(other.Fd()))
+}
+
+// inNetNS runs fn inside ns and comes back.
+func inNetNS(t *testing.T, ns *os.File, fn func()) {
+	t.Helper()
+	cur, err := os.Open(netnstest.ThreadPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if err = unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := unix.Setns(int(cur.Fd()), unix.CLONE_NEWNET); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	fn()
+}
+
+// mustAdd creates spec, kinds without a kernel module skip the test.
+func mustAdd(t *testing.T, spec Spec) {
+	t.Helper()
+	err := Add(spec)
+	if errors.Is(err, ifaces.ErrUnsupported) || errors.Is(err, ifaces.ErrNotFound) && spec.Parent == "" {
+		t.Skipf("%s links not available: %v", spec.Kind, err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustGet(t *testing.T, name string) *LinkInfo {
+	t.Helper()
+	li, err := Get(name)
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+	return li
+}
+
+func TestAddVeth(t *testing.T) {
+	netnstest.Enter(t)
+	mustAdd(t, Spec{Name: "va0", Kind: KindVeth, Peer: "vb0", MTU: 1400})
+	for _, pair := range [][2]string{{"va0", "vb0"}, {"vb0", "va0"}} {
+		li := mustGet(t, pair[0])
+		if li.Kind != KindVeth || li.MTU != 1400 || li.Parent != pair[1] || li.ParentNetNSID != -1 {
+			t.Errorf("%s = %+v", pair[0], li)
+		}
+	}
+	if err := Add(Spec{Name: "va0", Kind: KindVeth, Peer: "vc0"}); !errors.Is(err, ifaces.ErrExists) {
+		t.Errorf("add twice: %v, want ErrExists", err)
+	}
+	// deleting one end removes both
+	if err := Delete("va0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("vb0"); !errors.Is(err, ifaces.ErrNotFound) {
+		t.Errorf("peer after delete: %v", err)
+	}
+}
+
+func TestAddVethPeerNetNS(t *testing.T) {
+	netnstest.Enter(t)
+	other, otherPath := otherNetNS(t)
+	mustAdd(t, Spec{Name: "host0", Kind: KindVeth, Peer: "guest0", PeerNetNS: otherPath})
+	li := mustGet(t, "host0")
+	if li.Kind != KindVeth || li.ParentNetNSID < 0 || li.ParentIndex == 0 {
+		t.Errorf("host0 = %+v, want a peer in another netns", li)
+	}
+	if _, err := Get("guest0"); !errors.Is(err, ifaces.ErrNotFound) {
+		t.Errorf("guest0 in the test netns: %v", err)
+	}
+	inNetNS(t, other, func() {
+		guest := mustGet(t, "guest0")
+		if guest.Kind != KindVeth || guest.Index != li.ParentIndex {
+			t.Errorf("guest0 = %+v, want index %d", guest, li.ParentIndex)
+		}
+	})
+
+	// SetNetNS moves an existing link the same way
+	mustAdd(t, Spec{Name: "mv0", Kind: KindVeth, Peer: "mv1"})
+	if err := SetNetNS("mv1", otherPath); err != nil {
+		t.Fatal(err)
+	}
+	if li := mustGet(t, "mv0"); li.ParentNetNSID < 0 {
+		t.Errorf("mv0 = %+v after moving its peer", li)
+	}
+	inNetNS(t, other, func() { mustGet(t, "mv1") })
+}
+
+func TestAddBridgeSetMaster(t *testing.T) {
+	netnstest.Enter(t)
+	mustAdd(t, Spec{Name: "br0", Kind: KindBridge, STP: true})
+	mustAdd(t, Spec{Name: "port0", Kind: KindVeth, Peer: "port1"})
+	if br := mustGet(t, "br0"); br.Kind != KindBridge || !br.STP {
+		t.Errorf("br0 = %+v", br)
+	}
+	if err := SetMaster("port0", "br0"); err != nil {
+		t.Fatal(err)
+	}
+	if li := mustGet(t, "port0"); li.Master != "br0" || li.SlaveKind != KindBridge {
+		t.Errorf("port0 = %+v, want a bridge port of br0", li)
+	}
+	if err := SetMaster("port0", ""); err != nil {
+		t.Fatal(err)
+	}
+	if li := mustGet(t, "port0"); li.Master != "" {
+		t.Errorf("port0 still attached to %q", li.Master)
+	}
+	if err := SetMaster("port0", "nonexistent0"); !errors.Is(err, ifaces.ErrNotFound) {
+		t.Errorf("unknown master: %v", err)
+	}
+}
+
+func TestAddMACVLAN(t *testing.T) {
+	netnstest.Enter(t)
+	mustAdd(t, Spec{Name: "lower0", Kind: KindVeth, Peer: "lower1"})
+	mustAdd(t, Spec{Name: "mac0", Kind: KindMACVLAN, Parent: "lower0", Mode: "private"})
+	li := mustGet(t, "mac0")
+	if li.Kind != KindMACVLAN || li.Mode != "private" || li.Parent != "lower0" {
+		t.Errorf("mac0 = %+v", li)
+	}
+	if err := Add(Spec{Name: "mac1", Kind: KindMACVLAN, Parent: "lower0", Mode: "bogus"}); !errors.Is(err, ifaces.ErrInvalid) {
+		t.Errorf("bad mode: %v", err)
+	}
+	if err := Add(Spec{Name: "mac2", Kind: KindMACVLAN, Parent: "nonexistent0"}); !errors.Is(err, ifaces.ErrNotFound) {
+		t.Errorf("missing parent: %v", err)
+	}
+}
+
+func TestAddIPVLAN(t *testing.T) {
+	netnstest.Enter(t)
+	mustAdd(t, Spec{Name: "lower0", Kind: KindVeth, Peer: "lower1"})
+	mustAdd(t, Spec{Name: "ipv0", Kind: KindIPVLAN, Parent: "lower0", Mode: "l2"})
+	li := mustGet(t, "ipv0")
+	if li.Kind != KindIPVLAN || li.Mode != "l2" || li.Parent != "lower0" {
+		t.Errorf("ipv0 = %+v", li)
+	}
+}
+
+func TestAddVLAN(t *testing.T) {
+	netnstest.Enter(t)
+	mustAdd(t, Spec{Name: "trunk0", Kind: KindVeth, Peer: "trunk1"})
+	if err := Add(Spec{Name: "bad.0", Kind: KindVLAN, Parent: "trunk0", VLANID: 4095}); !errors.Is(err, ifaces.ErrInvalid) {
+		t.Errorf("vlan id 4095: %v", err)
+	}
+	mustAdd(t, Spec{Name: "trunk0.42", Kind: KindVLAN, Parent: "trunk0", VLANID: 42, VLANProtocol: "802.1ad"})
+	li := mustGet(t, "trunk0.42")
+	if li.Kind != KindVLAN || li.VLANID != 42 || li.VLANProtocol != "802.1ad" || li.Parent != "trunk0" {
+		t.Errorf("trunk0.42 = %+v", li)
+	}
+}
+
+func TestAddBond(t *testing.T) {
+	netnstest.Enter(t)
+	mustAdd(t, Spec{Name: "bond0", Kind: KindBond, Mode: "active-backup", Miimon: 100})
+	mustAdd(t, Spec{Name: "slave0", Kind: KindVeth, Peer: "slave1"})
+	li := mustGet(t, "bond0")
+	if li.Kind != KindBond || li.Mode != "active-backup" || li.Miimon != 100 {
+		t.Errorf("bond0 = %+v", li)
+	}
+	if err := SetMaster("slave0", "bond0"); err != nil {
+		t.Fatal(err)
+	}
+	if li := mustGet(t, "slave0"); li.Master != "bond0" || li.SlaveKind != KindBond {
+		t.Errorf("slave0 = %+v, want a port of bond0", li)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	netnstest.Enter(t)
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"veth without peer", Add(Spec{Name: "v0", Kind: KindVeth}), ifaces.ErrInvalid},
+		{"unknown kind", Add(Spec{Name: "x0", Kind: "bogus"}), ifaces.ErrInvalid},
+		{"long name", Add(Spec{Name: "a-name-longer-than-ifnamsiz", Kind: KindBridge}), ifaces.ErrInvalid},
+		{"delete missing", Delete("nonexistent0"), ifaces.ErrNotFound},
+		{"netns of missing link", SetNetNS("nonexistent0", netnstest.ThreadPath()), ifaces.ErrNotFound},
+	}
+	for _, tt := range tests {
+		var ce *ifaces.ConfigError
+		if !errors.As(tt.err, &ce) || !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: %v, want a *ConfigError wrapping %v", tt.name, tt.err, tt.want)
+		}
+	}
+	if _, err := Get("nonexistent0"); !errors.Is(err, ifaces.ErrNotFound) {
+		t.Errorf("get missing: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !linux
+
+package links
+
+// Add creates the link described by spec.
+func Add(spec Spec) error {
+	return ErrUnsupported
+}
+
+// Delete removes a link, deleting one end of a veth pair removes both.
+func Delete(name string) error {
+	return ErrUnsupported
+}
+
+// SetMaster attaches a link to a bridge or bond, master "" detaches it.
+func SetMaster(name, master string) error {
+	return ErrUnsupported
+}
+
+// SetNetNS moves a link into another network namespace.
+func SetNetNS(name, nsPath string) error {
+	return ErrUnsupported
+}
+
+// List dumps every link with its link-info attributes.
+func List() ([]LinkInfo, error) {
+	return nil, ErrUnsupported
+}
+
+// Get returns one link by name.
+func Get(name string) (*LinkInfo, error) {
+	return nil, ErrUnsupported
+}
+
+// AddTunnel creates the tunnel link described by t.
+func AddTunnel(t Tunnel) error {
+	return ErrUnsupported
+}
+
+// Tunnels lists the tunnel links with their parameters.
+func Tunnels() ([]Tunnel, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTunnel returns one tunnel link by name.
+func GetTunnel(name string) (*Tunnel, error) {
+	return nil, ErrUnsupported
+}
+
+// Bridges lists the bridges with their ports.
+func Bridges() ([]Bridge, error) {
+	return nil, ErrUnsupported
+}
+
+// FDB dumps the forwarding database of bridge, every bridge when "".
+func FDB(bridge string) ([]FDBEntry, error) {
+	return nil, ErrUnsupported
+}
+
+// Bonds lists the bonds with their slaves.
+func Bonds() ([]Bond, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,110 @@
+package links
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+
+	"github.com/kmahyyg/go-network-compo/routes"
+)
+
+// tunnel kinds
+const (
+	KindGRE    = "gre"
+	KindIPIP   = "ipip"
+	KindSIT    = "sit"
+	KindVXLAN  = "vxlan"
+	KindGENEVE = "geneve"
+)
+
+// default UDP destination ports, the IANA ones
+const (
+	DefaultVXLANPort  = 4789
+	DefaultGENEVEPort = 6081
+)
+
+// Tunnel is a tunnel link to create or read back, Kind selects which fields apply.
+type Tunnel struct {
+	Index    int        `json:"index"`
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind"`
+	MTU      int        `json:"mtu"`
+	Local    netip.Addr `json:"local"`    // not for geneve
+	Remote   netip.Addr `json:"remote"`   // vxlan: remote or multicast group
+	Parent   string     `json:"parent"`   // device carrying the outer packets
+	TTL      uint8      `json:"ttl"`      // 0 inherits from the inner packet
+	Key      uint32     `json:"key"`      // gre, 0 without key
+	VNI      uint32     `json:"vni"`      // vxlan and geneve
+	DstPort  uint16     `json:"dst_port"` // vxlan and geneve, the default port when 0
+	Learning bool       `json:"learning"` // vxlan MAC learning
+}
+
+func (t Tunnel) ToPortableJSON() string {
+	data, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (t Tunnel) ToTableString() string {
+	detail := ""
+	switch t.Kind {
+	case KindGRE:
+		detail = fmt.Sprintf("key %d", t.Key)
+	case KindVXLAN:
+		detail = fmt.Sprintf("vni %d dstport %d learning %t", t.VNI, t.DstPort, t.Learning)
+	case KindGENEVE:
+		detail = fmt.Sprintf("vni %d dstport %d", t.VNI, t.DstPort)
+	}
+	return fmt.Sprintf("%d: %s\t%s\tlocal %s\tremote %s\tdev %s\tttl %d\t%s\n",
+		t.Index, t.Name, t.Kind, t.endpoint(t.Local), t.endpoint(t.Remote), t.Parent, t.TTL, detail)
+}
+
+func (t Tunnel) endpoint(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return "any"
+	}
+	return addr.String()
+}
+
+// TunnelRoute is a route with the tunnel its interface belongs to, if any.
+type TunnelRoute struct {
+	routes.NetRoute
+	Tunnel *Tunnel `json:"tunnel,omitempty"`
+}
+
+func (tr TunnelRoute) ToPortableJSON() string {
+	data, err := json.Marshal(tr)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+func (tr TunnelRoute) ToTableString() string {
+	s := tr.NetRoute.ToTableString()
+	if tr.Tunnel == nil {
+		return s
+	}
+	return fmt.Sprintf("%s\t%s %s -> %s\n", s[:len(s)-1], tr.Tunnel.Kind,
+		tr.Tunnel.endpoint(tr.Tunnel.Local), tr.Tunnel.endpoint(tr.Tunnel.Remote))
+}
+
+// AnnotateRoutes pairs every route of a table from routes.Retrieve with the
+// tunnel of its interface, to show the endpoints the traffic is carried to.
+func AnnotateRoutes(table []routes.NetRoute) ([]TunnelRoute, error) {
+	tunnels, err := Tunnels()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Tunnel)
+	for i := range tunnels {
+		byName[tunnels[i].Name] = &tunnels[i]
+	}
+	annotated := make([]TunnelRoute, 0, len(table))
+	for _, nr := range table {
+		annotated = append(annotated, TunnelRoute{NetRoute: nr, Tunnel: byName[nr.NetIf]})
+	}
+	return annotated, nil
+}
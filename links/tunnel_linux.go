@@ -0,0 +1,288 @@
+//go:build linux
+
+package links
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// IFLA_GRE_* and IFLA_IPTUN_*, missing in x/sys
+const (
+	iflaGRELink   = 1
+	iflaGREIFlags = 2
+	iflaGREOFlags = 3
+	iflaGREIKey   = 4
+	iflaGREOKey   = 5
+	iflaGRELocal  = 6
+	iflaGRERemote = 7
+	iflaGRETTL    = 8
+
+	iflaIPTunLink   = 1
+	iflaIPTunLocal  = 2
+	iflaIPTunRemote = 3
+	iflaIPTunTTL    = 4
+
+	greKeyFlag = 0x2000 // GRE_KEY, in network byte order on the wire
+)
+
+// AddTunnel creates the tunnel link described by t. GRE, IPIP and SIT
+// take IPv4 endpoints, VXLAN and GENEVE either family.
+func AddTunnel(t Tunnel) error {
+	body, err := newTunnelBody(t)
+	if err == nil {
+		err = rtnl.Request(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, body)
+	}
+	return ifaces.NewConfigError("add "+t.Kind, t.Name, err)
+}
+
+func newTunnelBody(t Tunnel) ([]byte, error) {
+	body, err := newLinkHeader(t.Name, t.MTU, nil)
+	if err != nil {
+		return nil, err
+	}
+	parent := uint32(0)
+	if t.Parent != "" {
+		iface, err := net.InterfaceByName(t.Parent)
+		if err != nil {
+			return nil, ifaces.ErrNotFound
+		}
+		parent = uint32(iface.Index)
+	}
+	var data []byte
+	switch t.Kind {
+	case KindGRE:
+		if !ipv4OrUnset(t.Local) || !ipv4OrUnset(t.Remote) {
+			return nil, ifaces.ErrInvalid
+		}
+		data = appendAddr(data, iflaGRELocal, t.Local)
+		data = appendAddr(data, iflaGRERemote, t.Remote)
+		data = rtnl.AppendAttr(data, iflaGRETTL, []byte{t.TTL})
+		if parent != 0 {
+			data = rtnl.AppendUint32(data, iflaGRELink, parent)
+		}
+		if t.Key != 0 {
+			data = rtnl.AppendAttr(data, iflaGREIFlags, bigEndian16(greKeyFlag))
+			data = rtnl.AppendAttr(data, iflaGREOFlags, bigEndian16(greKeyFlag))
+			data = rtnl.AppendAttr(data, iflaGREIKey, bigEndian32(t.Key))
+			data = rtnl.AppendAttr(data, iflaGREOKey, bigEndian32(t.Key))
+		}
+	case KindIPIP, KindSIT:
+		if !ipv4OrUnset(t.Local) || !ipv4OrUnset(t.Remote) {
+			return nil, ifaces.ErrInvalid
+		}
+		data = appendAddr(data, iflaIPTunLocal, t.Local)
+		data = appendAddr(data, iflaIPTunRemote, t.Remote)
+		data = rtnl.AppendAttr(data, iflaIPTunTTL, []byte{t.TTL})
+		if parent != 0 {
+			data = rtnl.AppendUint32(data, iflaIPTunLink, parent)
+		}
+	case KindVXLAN:
+		data = rtnl.AppendUint32(data, unix.IFLA_VXLAN_ID, t.VNI)
+		data = appendAddr46(data, unix.IFLA_VXLAN_LOCAL, unix.IFLA_VXLAN_LOCAL6, t.Local)
+		data = appendAddr46(data, unix.IFLA_VXLAN_GROUP, unix.IFLA_VXLAN_GROUP6, t.Remote)
+		data = rtnl.AppendAttr(data, unix.IFLA_VXLAN_TTL, []byte{t.TTL})
+		data = rtnl.AppendAttr(data, unix.IFLA_VXLAN_LEARNING, []byte{boolByte(t.Learning)})
+		data = rtnl.AppendAttr(data, unix.IFLA_VXLAN_PORT, bigEndian16(portOr(t.DstPort, DefaultVXLANPort)))
+		if parent != 0 {
+			data = rtnl.AppendUint32(data, unix.IFLA_VXLAN_LINK, parent)
+		}
+	case KindGENEVE:
+		// geneve has no local address and no lower device
+		if t.Local.IsValid() || parent != 0 || !t.Remote.IsValid() {
+			return nil, ifaces.ErrInvalid
+		}
+		data = rtnl.AppendUint32(data, unix.IFLA_GENEVE_ID, t.VNI)
+		data = appendAddr46(data, unix.IFLA_GENEVE_REMOTE, unix.IFLA_GENEVE_REMOTE6, t.Remote)
+		data = rtnl.AppendAttr(data, unix.IFLA_GENEVE_TTL, []byte{t.TTL})
+		data = rtnl.AppendAttr(data, unix.IFLA_GENEVE_PORT, bigEndian16(portOr(t.DstPort, DefaultGENEVEPort)))
+	default:
+		return nil, ifaces.ErrInvalid
+	}
+	return appendLinkInfo(body, t.Kind, data), nil
+}
+
+func ipv4OrUnset(addr netip.Addr) bool {
+	return !addr.IsValid() || addr.Is4()
+}
+
+func appendAddr(b []byte, typ uint16, addr netip.Addr) []byte {
+	if !addr.IsValid() {
+		return b
+	}
+	return rtnl.AppendAttr(b, typ, addr.AsSlice())
+}
+
+func appendAddr46(b []byte, typ4, typ6 uint16, addr netip.Addr) []byte {
+	if addr.Is6() {
+		return appendAddr(b, typ6, addr)
+	}
+	return appendAddr(b, typ4, addr)
+}
+
+func bigEndian16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func bigEndian32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func portOr(port, def uint16) uint16 {
+	if port == 0 {
+		return def
+	}
+	return port
+}
+
+// Tunnels lists the tunnel links with their parameters.
+func Tunnels() ([]Tunnel, error) {
+	tunnels := make([]Tunnel, 0)
+	err := dumpLinks(func(info *unix.IfInfomsg, attrs rtnl.Attrs) {
+		if t, ok := parseTunnel(info, attrs); ok {
+			tunnels = append(tunnels, t)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tunnels, nil
+}
+
+// GetTunnel returns one tunnel link by name.
+func GetTunnel(name string) (*Tunnel, error) {
+	tunnels, err := Tunnels()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tunnels {
+		if tunnels[i].Name == name {
+			return &tunnels[i], nil
+		}
+	}
+	return nil, ifaces.ErrNotFound
+}
+
+func parseTunnel(info *unix.IfInfomsg, attrs rtnl.Attrs) (Tunnel, bool) {
+	t := Tunnel{Index: int(info.Index)}
+	var data rtnl.Attrs
+	for _, a := range attrs {
+		switch a.Type {
+		case unix.IFLA_IFNAME:
+			t.Name = a.String()
+		case unix.IFLA_MTU:
+			t.MTU = int(a.Uint32())
+		case unix.IFLA_LINKINFO:
+			li := a.Nested()
+			if k, ok := li.Get(unix.IFLA_INFO_KIND); ok {
+				t.Kind = k.String()
+			}
+			if d, ok := li.Get(unix.IFLA_INFO_DATA); ok {
+				data = d.Nested()
+			}
+		}
+	}
+	parent := uint32(0)
+	switch t.Kind {
+	case KindGRE:
+		for _, d := range data {
+			switch d.Type {
+			case iflaGRELocal:
+				t.Local = attrAddr(d)
+			case iflaGRERemote:
+				t.Remote = attrAddr(d)
+			case iflaGRETTL:
+				t.TTL = d.Uint8()
+			case iflaGRELink:
+				parent = d.Uint32()
+			case iflaGREOKey:
+				if len(d.Data) >= 4 {
+					t.Key = binary.BigEndian.Uint32(d.Data)
+				}
+			}
+		}
+	case KindIPIP, KindSIT:
+		for _, d := range data {
+			switch d.Type {
+			case iflaIPTunLocal:
+				t.Local = attrAddr(d)
+			case iflaIPTunRemote:
+				t.Remote = attrAddr(d)
+			case iflaIPTunTTL:
+				t.TTL = d.Uint8()
+			case iflaIPTunLink:
+				parent = d.Uint32()
+			}
+		}
+	case KindVXLAN:
+		for _, d := range data {
+			switch d.Type {
+			case unix.IFLA_VXLAN_ID:
+				t.VNI = d.Uint32()
+			case unix.IFLA_VXLAN_LOCAL, unix.IFLA_VXLAN_LOCAL6:
+				t.Local = attrAddr(d)
+			case unix.IFLA_VXLAN_GROUP, unix.IFLA_VXLAN_GROUP6:
+				t.Remote = attrAddr(d)
+			case unix.IFLA_VXLAN_TTL:
+				t.TTL = d.Uint8()
+			case unix.IFLA_VXLAN_LEARNING:
+				t.Learning = d.Uint8() != 0
+			case unix.IFLA_VXLAN_PORT:
+				if len(d.Data) >= 2 {
+					t.DstPort = binary.BigEndian.Uint16(d.Data)
+				}
+			case unix.IFLA_VXLAN_LINK:
+				parent = d.Uint32()
+			}
+		}
+	case KindGENEVE:
+		for _, d := range data {
+			switch d.Type {
+			case unix.IFLA_GENEVE_ID:
+				t.VNI = d.Uint32()
+			case unix.IFLA_GENEVE_REMOTE, unix.IFLA_GENEVE_REMOTE6:
+				t.Remote = attrAddr(d)
+			case unix.IFLA_GENEVE_TTL:
+				t.TTL = d.Uint8()
+			case unix.IFLA_GENEVE_PORT:
+				if len(d.Data) >= 2 {
+					t.DstPort = binary.BigEndian.Uint16(d.Data)
+				}
+			}
+		}
+	default:
+		return t, false
+	}
+	if parent != 0 {
+		if iface, err := net.InterfaceByIndex(int(parent)); err == nil {
+			t.Parent = iface.Name
+		}
+	}
+	return t, true
+}
+
+// attrAddr returns the address of a 4 or 16 byte attribute, the unset
+// address 0.0.0.0 as invalid.
+func attrAddr(a rtnl.Attr) netip.Addr {
+	addr, ok := netip.AddrFromSlice(a.Data)
+	if !ok || addr.IsUnspecified() {
+		return netip.Addr{}
+	}
+	return addr
+}
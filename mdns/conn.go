@@ -0,0 +1,133 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// mconn is a UDP socket set up for one multicast group on one interface.
+type mconn struct {
+	udp   *net.UDPConn
+	group *net.UDPAddr
+	p4    *ipv4.PacketConn
+	p6    *ipv6.PacketConn
+	iface *net.Interface
+}
+
+// listen opens a socket for network "udp4" or "udp6". With join the socket
+// is bound to the mDNS port and joins the group, otherwise it uses an
+// ephemeral port for one-shot queries.
+func listen(network string, iface *net.Interface, join bool) (*mconn, error) {
+	c := &mconn{iface: iface}
+	addr := ":0"
+	if join {
+		addr = ":" + strconv.Itoa(Port)
+	}
+	if network == "udp6" {
+		c.group = &net.UDPAddr{IP: net.ParseIP(IPv6Group), Port: Port}
+		addr = "[::]" + addr
+	} else {
+		c.group = &net.UDPAddr{IP: net.ParseIP(IPv4Group), Port: Port}
+		addr = "0.0.0.0" + addr
+	}
+	if iface != nil {
+		c.group.Zone = iface.Name
+	}
+	lc := net.ListenConfig{Control: reuseControl}
+	pc, err := lc.ListenPacket(context.Background(), network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c.udp = pc.(*net.UDPConn)
+	if err = c.setup(join); err != nil {
+		c.udp.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mconn) setup(join bool) error {
+	group := &net.UDPAddr{IP: c.group.IP}
+	if c.group.IP.To4() != nil {
+		c.p4 = ipv4.NewPacketConn(c.udp)
+		if c.iface != nil {
+			if err := c.p4.SetMulticastInterface(c.iface); err != nil {
+				return err
+			}
+		}
+		// loopback lets a responder on this host answer
+		_ = c.p4.SetMulticastLoopback(true)
+		_ = c.p4.SetMulticastTTL(255)
+		// not supported on windows, packets are then not filtered by interface
+		_ = c.p4.SetControlMessage(ipv4.FlagInterface, true)
+		if join {
+			return c.p4.JoinGroup(c.iface, group)
+		}
+		return nil
+	}
+	c.p6 = ipv6.NewPacketConn(c.udp)
+	if c.iface != nil {
+		if err := c.p6.SetMulticastInterface(c.iface); err != nil {
+			return err
+		}
+	}
+	_ = c.p6.SetMulticastLoopback(true)
+	_ = c.p6.SetMulticastHopLimit(255)
+	_ = c.p6.SetControlMessage(ipv6.FlagInterface, true)
+	if join {
+		return c.p6.JoinGroup(c.iface, group)
+	}
+	return nil
+}
+
+// readFrom returns the interface index the packet came in on, 0 if unknown.
+func (c *mconn) readFrom(b []byte) (int, int, *net.UDPAddr, error) {
+	var (
+		n       int
+		ifIndex int
+		src     net.Addr
+		err     error
+	)
+	if c.p4 != nil {
+		var cm *ipv4.ControlMessage
+		n, cm, src, err = c.p4.ReadFrom(b)
+		if cm != nil {
+			ifIndex = cm.IfIndex
+		}
+	} else {
+		var cm *ipv6.ControlMessage
+		n, cm, src, err = c.p6.ReadFrom(b)
+		if cm != nil {
+			ifIndex = cm.IfIndex
+		}
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	udpSrc, _ := src.(*net.UDPAddr)
+	return n, ifIndex, udpSrc, nil
+}
+
+func (c *mconn) writeTo(b []byte, dst *net.UDPAddr) error {
+	_, err := c.udp.WriteToUDP(b, dst)
+	return err
+}
+
+func (c *mconn) close() error {
+	return c.udp.Close()
+}
+
+// networks turns Options.Network into the socket networks to use.
+func networks(network string) []string {
+	switch network {
+	case "udp6":
+		return []string{"udp6"}
+	case "udp":
+		return []string{"udp4", "udp6"}
+	}
+	return []string{"udp4"}
+}
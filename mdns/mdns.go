@@ -0,0 +1,131 @@
+package mdns
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+// Multicast DNS (RFC 6762) and DNS-Based Service Discovery (RFC 6763).
+// On Linux the loopback interface needs `ip link set lo multicast on`
+// before it can be used, and carries IPv4 multicast only.
+
+const (
+	Port      = 5353
+	IPv4Group = "224.0.0.251"
+	IPv6Group = "ff02::fb"
+
+	// DefaultDomain is the mDNS top level domain.
+	DefaultDomain = "local."
+	// ServicesName lists the service types of a domain (RFC 6763 section 9).
+	ServicesName = "_services._dns-sd._udp.local."
+
+	// top bit of the class: unicast response in questions, cache flush in records
+	classQU         dnsclient.Class = 0x8000
+	classCacheFlush dnsclient.Class = 0x8000
+
+	hostTTL    = 120  // A, AAAA, SRV and reverse PTR
+	serviceTTL = 4500 // PTR and TXT
+	// legacy unicast answers must not be cached for long (section 6.7)
+	legacyTTL = 10
+	maxPacket = 9000
+)
+
+var (
+	ErrNoAnswer     = errors.New("no mdns answer")
+	ErrNotLocalName = errors.New("not a .local name")
+)
+
+// IsLocalName reports whether name belongs to the mDNS domain.
+func IsLocalName(name string) bool {
+	name = dnsclient.CanonicalName(name)
+	return name == DefaultDomain || strings.HasSuffix(name, "."+DefaultDomain)
+}
+
+// ServiceFqdn turns "_http._tcp" into "_http._tcp.local.", full names stay.
+func ServiceFqdn(service string) string {
+	if IsLocalName(service) {
+		return dnsclient.Fqdn(service)
+	}
+	return dnsclient.Fqdn(strings.TrimSuffix(service, ".") + "." + DefaultDomain)
+}
+
+// InstanceFqdn builds "<instance>.<service>.local." escaping dots and
+// backslashes of the instance label.
+func InstanceFqdn(instance, service string) string {
+	var sb strings.Builder
+	for i := 0; i < len(instance); i++ {
+		switch c := instance[i]; c {
+		case '.', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String() + "." + ServiceFqdn(service)
+}
+
+// splitFirstLabel returns the unescaped first label of a presentation
+// format name and the rest of the name.
+func splitFirstLabel(name string) (string, string) {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '\\' && i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]):
+			n, _ := strconv.Atoi(name[i+1 : i+4])
+			sb.WriteByte(byte(n))
+			i += 3
+		case c == '\\' && i+1 < len(name):
+			sb.WriteByte(name[i+1])
+			i++
+		case c == '.':
+			return sb.String(), name[i+1:]
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// reverseName returns the PTR name of addr, "4.3.2.1.in-addr.arpa." style.
+func reverseName(addr netip.Addr) string {
+	var sb strings.Builder
+	b := addr.AsSlice()
+	if addr.Is4() {
+		for i := len(b) - 1; i >= 0; i-- {
+			sb.WriteString(strconv.Itoa(int(b[i])))
+			sb.WriteByte('.')
+		}
+		sb.WriteString("in-addr.arpa.")
+		return sb.String()
+	}
+	const hexDigits = "0123456789abcdef"
+	for i := len(b) - 1; i >= 0; i-- {
+		sb.WriteByte(hexDigits[b[i]&0xf])
+		sb.WriteByte('.')
+		sb.WriteByte(hexDigits[b[i]>>4])
+		sb.WriteByte('.')
+	}
+	sb.WriteString("ip6.arpa.")
+	return sb.String()
+}
+
+// sameRecord compares name, type and data, ignoring the TTL and class bits.
+func sameRecord(a, b dnsclient.Resource) bool {
+	if a.Type != b.Type || !strings.EqualFold(a.Name, b.Name) {
+		return false
+	}
+	if a.Data == nil || b.Data == nil {
+		return a.Data == b.Data
+	}
+	return a.Data.String() == b.Data.String()
+}
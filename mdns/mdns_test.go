@@ -0,0 +1,293 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+var testAddrs = []netip.Addr{netip.MustParseAddr("192.0.2.10"), netip.MustParseAddr("2001:db8::10")}
+
+// loopback returns the loopback interface, multicast has to be enabled on it
+// ("ip link set lo multicast on" on Linux).
+func loopback(t *testing.T) *net.Interface {
+	t.Helper()
+	ifs, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ifs {
+		if ifs[i].Flags&net.FlagLoopback == 0 {
+			continue
+		}
+		if ifs[i].Flags&net.FlagMulticast == 0 || ifs[i].Flags&net.FlagUp == 0 {
+			t.Skipf("%s has no multicast", ifs[i].Name)
+		}
+		return &ifs[i]
+	}
+	t.Skip("no loopback interface")
+	return nil
+}
+
+func startResponder(t *testing.T, iface *net.Interface, services ...Service) *Responder {
+	t.Helper()
+	r, err := NewResponder(iface, "gotest", testAddrs, "udp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range services {
+		r.AddService(s)
+	}
+	if err = r.Start(); err != nil {
+		t.Skipf("mdns port: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func sortedAddrs(addrs []netip.Addr) []netip.Addr {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+	return addrs
+}
+
+func TestResponderLookupHost(t *testing.T) {
+	lo := loopback(t)
+	startResponder(t, lo)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	addrs, err := LookupHost(ctx, "gotest.local", Options{Iface: lo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedAddrs(addrs); !reflect.DeepEqual(got, testAddrs) {
+		t.Errorf("LookupHost = %v, want %v", got, testAddrs)
+	}
+	if _, err = LookupHost(ctx, "gotest.example", Options{Iface: lo}); err != ErrNotLocalName {
+		t.Errorf("non local name: %v", err)
+	}
+}
+
+func TestResponderBrowse(t *testing.T) {
+	lo := loopback(t)
+	svc := Service{Instance: `Web. Server\1`, Service: "_gotest._tcp", Port: 8080, TXT: []string{"path=/"}}
+	r := startResponder(t, lo, svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	list, err := Browse(ctx, "_gotest._tcp", Options{Iface: lo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("Browse = %v, want one instance", list)
+	}
+	se := list[0]
+	want := ServiceEntry{
+		// unpacked names escape the space too
+		Instance: `Web\.\032Server\\1._gotest._tcp.local.`,
+		Name:     svc.Instance,
+		Service:  "_gotest._tcp.local.",
+		Host:     r.Host(),
+		Port:     8080,
+		TXT:      []string{"path=/"},
+		Addrs:    testAddrs,
+	}
+	se.Addrs = sortedAddrs(se.Addrs)
+	if !reflect.DeepEqual(se, want) {
+		t.Errorf("Browse = %+v\nwant %+v", se, want)
+	}
+}
+
+// goodbyes reads packets of the group until one with zero TTLs arrives.
+func goodbyes(t *testing.T, c *mconn) []dnsclient.Resource {
+	t.Helper()
+	buf := make([]byte, maxPacket)
+	c.udp.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		n, _, _, err := c.readFrom(buf)
+		if err != nil {
+			t.Fatalf("no goodbye: %v", err)
+		}
+		msg := new(dnsclient.Message)
+		if msg.Unpack(buf[:n]) != nil || !msg.Response || len(msg.Answers) == 0 || msg.Answers[0].TTL != 0 {
+			continue
+		}
+		return msg.Answers
+	}
+}
+
+func hasRecord(records []dnsclient.Resource, name string, typ dnsclient.Type) bool {
+	for _, rr := range records {
+		if rr.Type == typ && dnsclient.CanonicalName(rr.Name) == dnsclient.CanonicalName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRemoveServiceGoodbye(t *testing.T) {
+	lo := loopback(t)
+	group, err := listen("udp4", lo, true)
+	if err != nil {
+		t.Skipf("mdns port: %v", err)
+	}
+	defer group.close()
+	r := startResponder(t, lo,
+		Service{Instance: "one", Service: "_gotest._tcp", Port: 1},
+		Service{Instance: "two", Service: "_gotest._tcp", Port: 2})
+
+	// the type is still in use, its _services PTR stays
+	r.RemoveService("one", "_gotest._tcp")
+	records := goodbyes(t, group)
+	one := InstanceFqdn("one", "_gotest._tcp")
+	for _, typ := range []dnsclient.Type{dnsclient.TypeSRV, dnsclient.TypeTXT} {
+		if !hasRecord(records, one, typ) {
+			t.Errorf("goodbye %v lacks %s %v", records, one, typ)
+		}
+	}
+	if !hasRecord(records, "_gotest._tcp.local.", dnsclient.TypePTR) {
+		t.Errorf("goodbye %v lacks the instance PTR", records)
+	}
+	if hasRecord(records, ServicesName, dnsclient.TypePTR) || hasRecord(records, InstanceFqdn("two", "_gotest._tcp"), dnsclient.TypeSRV) {
+		t.Errorf("goodbye %v withdraws records still published", records)
+	}
+	for _, rr := range records {
+		if rr.TTL != 0 {
+			t.Errorf("goodbye record %v has a TTL", rr)
+		}
+	}
+
+	r.RemoveService("two", "_gotest._tcp")
+	if records = goodbyes(t, group); !hasRecord(records, ServicesName, dnsclient.TypePTR) {
+		t.Errorf("last instance goodbye %v lacks the _services PTR", records)
+	}
+}
+
+// handleTo runs handle for a legacy query from a unicast port and returns
+// the reply, nil when the responder stays silent.
+func handleTo(t *testing.T, r *Responder, query *dnsclient.Message) *dnsclient.Message {
+	t.Helper()
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	c := &mconn{udp: server, group: &net.UDPAddr{IP: net.ParseIP(IPv4Group), Port: Port}}
+	r.handle(c, query, client.LocalAddr().(*net.UDPAddr))
+
+	buf := make([]byte, maxPacket)
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	n, err := client.Read(buf)
+	if err != nil {
+		return nil
+	}
+	resp := new(dnsclient.Message)
+	if err = resp.Unpack(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandleKnownAnswers(t *testing.T) {
+	r, err := NewResponder(&net.Interface{Index: 1, Name: "test0"}, "gotest", testAddrs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := r.Host()
+	a := func(ttl uint32) dnsclient.Resource {
+		return dnsclient.Resource{Name: host, Type: dnsclient.TypeA, Class: dnsclient.ClassINET, TTL: ttl,
+			Data: &dnsclient.A{Addr: testAddrs[0]}}
+	}
+	aaaa := dnsclient.Resource{Name: host, Type: dnsclient.TypeAAAA, Class: dnsclient.ClassINET, TTL: hostTTL,
+		Data: &dnsclient.AAAA{Addr: testAddrs[1]}}
+	tests := []struct {
+		name  string
+		known []dnsclient.Resource
+		want  []dnsclient.Type
+	}{
+		{"nothing known", nil, []dnsclient.Type{dnsclient.TypeA, dnsclient.TypeAAAA}},
+		{"A known", []dnsclient.Resource{a(hostTTL)}, []dnsclient.Type{dnsclient.TypeAAAA}},
+		// less than half the TTL left, the answer is refreshed
+		{"A about to expire", []dnsclient.Resource{a(hostTTL/2 - 1)}, []dnsclient.Type{dnsclient.TypeA, dnsclient.TypeAAAA}},
+		{"all known", []dnsclient.Resource{a(hostTTL), aaaa}, nil},
+	}
+	for _, tt := range tests {
+		query := &dnsclient.Message{Header: dnsclient.Header{ID: 0x7777},
+			Questions: []dnsclient.Question{{Name: host, Type: dnsclient.TypeANY, Class: dnsclient.ClassINET}},
+			Answers:   tt.known}
+		resp := handleTo(t, r, query)
+		var got []dnsclient.Type
+		if resp != nil {
+			for _, rr := range resp.Answers {
+				got = append(got, rr.Type)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: answers %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleLegacyUnicast(t *testing.T) {
+	r, err := NewResponder(&net.Interface{Index: 1, Name: "test0"}, "gotest", testAddrs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddService(Service{Instance: "web", Service: "_http._tcp", Port: 80})
+	q := dnsclient.Question{Name: "_http._tcp.local.", Type: dnsclient.TypePTR, Class: dnsclient.ClassINET}
+	resp := handleTo(t, r, &dnsclient.Message{Header: dnsclient.Header{ID: 0x1234}, Questions: []dnsclient.Question{q}})
+	if resp == nil {
+		t.Fatal("no reply")
+	}
+	// the legacy resolver matches the reply by id and question
+	if resp.ID != 0x1234 || !reflect.DeepEqual(resp.Questions, []dnsclient.Question{q}) {
+		t.Errorf("reply id %#x questions %v", resp.ID, resp.Questions)
+	}
+	if len(resp.Answers) != 1 || len(resp.Additionals) != 4 {
+		t.Errorf("reply answers %v additionals %v, want PTR then SRV, TXT, A and AAAA", resp.Answers, resp.Additionals)
+	}
+	for _, rr := range append(resp.Answers, resp.Additionals...) {
+		if rr.TTL > legacyTTL || rr.Class != dnsclient.ClassINET {
+			t.Errorf("legacy record %v, want TTL at most %d and no cache flush bit", rr, legacyTTL)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		instance, service string
+		fqdn              string
+	}{
+		{"Printer", "_ipp._tcp", "Printer._ipp._tcp.local."},
+		{"Web. Server", "_http._tcp.local.", `Web\. Server._http._tcp.local.`},
+		{`back\slash`, "_http._tcp", `back\\slash._http._tcp.local.`},
+		{"Living Room", "_airplay._tcp.local", "Living Room._airplay._tcp.local."},
+	}
+	for _, tt := range tests {
+		fqdn := InstanceFqdn(tt.instance, tt.service)
+		if fqdn != tt.fqdn {
+			t.Errorf("InstanceFqdn(%q, %q) = %q, want %q", tt.instance, tt.service, fqdn, tt.fqdn)
+		}
+		label, rest := splitFirstLabel(fqdn)
+		if label != tt.instance || rest != ServiceFqdn(tt.service) {
+			t.Errorf("splitFirstLabel(%q) = %q, %q", fqdn, label, rest)
+		}
+	}
+	// decimal escapes as dnsclient prints bytes outside printable ASCII
+	if label, rest := splitFirstLabel(`caf\195\169\032bar.local.`); label != "café bar" || rest != "local." {
+		t.Errorf("splitFirstLabel decimal escapes = %q, %q", label, rest)
+	}
+	if !IsLocalName("Host.LOCAL") || IsLocalName("host.example.") || IsLocalName("notlocal.") {
+		t.Error("IsLocalName")
+	}
+}
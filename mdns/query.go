@@ -0,0 +1,329 @@
+package mdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+// DefaultTimeout applies when the context has no deadline.
+const DefaultTimeout = 2 * time.Second
+
+// Options pick where queries go, zero values use the system default
+// multicast interface over IPv4.
+type Options struct {
+	Iface   *net.Interface
+	Network string // "udp4", "udp6" or "udp" for both
+}
+
+// zoned adds the interface to link-local addresses so they can be dialed.
+func (opts Options) zoned(addr netip.Addr) netip.Addr {
+	if opts.Iface != nil && addr.IsLinkLocalUnicast() {
+		return addr.WithZone(opts.Iface.Name)
+	}
+	return addr
+}
+
+// Query sends a one-shot query (RFC 6762 section 5.1) for name and returns
+// the records of the first response answering it. Responders reply to the
+// ephemeral port by unicast, so no mDNS port needs to be free.
+func Query(ctx context.Context, name string, t dnsclient.Type, opts Options) ([]dnsclient.Resource, error) {
+	q := dnsclient.Question{Name: dnsclient.Fqdn(name), Type: t, Class: dnsclient.ClassINET}
+	var records []dnsclient.Resource
+	err := exchange(ctx, opts, []dnsclient.Question{q}, func(msg *dnsclient.Message, _ func(...dnsclient.Question)) bool {
+		for _, rr := range msg.Answers {
+			if strings.EqualFold(rr.Name, q.Name) && (rr.Type == t || t == dnsclient.TypeANY) {
+				records = append(append(records, msg.Answers...), msg.Additionals...)
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNoAnswer
+	}
+	return records, nil
+}
+
+// LookupHost resolves a .local host name to its addresses like
+// nss-mdns does, asking for A and AAAA at once.
+func LookupHost(ctx context.Context, name string, opts Options) ([]netip.Addr, error) {
+	if !IsLocalName(name) {
+		return nil, ErrNotLocalName
+	}
+	fqdn := dnsclient.Fqdn(name)
+	questions := []dnsclient.Question{
+		{Name: fqdn, Type: dnsclient.TypeA, Class: dnsclient.ClassINET},
+		{Name: fqdn, Type: dnsclient.TypeAAAA, Class: dnsclient.ClassINET},
+	}
+	addrs := make([]netip.Addr, 0)
+	err := exchange(ctx, opts, questions, func(msg *dnsclient.Message, _ func(...dnsclient.Question)) bool {
+		for _, rr := range append(msg.Answers, msg.Additionals...) {
+			if !strings.EqualFold(rr.Name, fqdn) {
+				continue
+			}
+			switch d := rr.Data.(type) {
+			case *dnsclient.A:
+				addrs = appendAddr(addrs, d.Addr)
+			case *dnsclient.AAAA:
+				addrs = appendAddr(addrs, opts.zoned(d.Addr))
+			}
+		}
+		return len(addrs) != 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoAnswer
+	}
+	return addrs, nil
+}
+
+// ServiceEntry is one discovered service instance.
+type ServiceEntry struct {
+	Instance string       `json:"instance"` // full name, "Printer._ipp._tcp.local."
+	Name     string       `json:"name"`     // unescaped instance label
+	Service  string       `json:"service"`  // "_ipp._tcp.local."
+	Host     string       `json:"host,omitempty"`
+	Port     uint16       `json:"port,omitempty"`
+	TXT      []string     `json:"txt,omitempty"`
+	Addrs    []netip.Addr `json:"addrs,omitempty"`
+}
+
+func (se ServiceEntry) ToPortableJSON() string {
+	data, err := json.Marshal(se)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Browse discovers the instances of service ("_http._tcp" or a full name)
+// until the context ends. Missing SRV, TXT and address records are asked
+// for as soon as an instance shows up.
+func Browse(ctx context.Context, service string, opts Options) ([]ServiceEntry, error) {
+	svc := ServiceFqdn(service)
+	entries := make(map[string]*ServiceEntry)
+	hostAddrs := make(map[string][]netip.Addr)
+	asked := make(map[string]bool)
+	q := dnsclient.Question{Name: svc, Type: dnsclient.TypePTR, Class: dnsclient.ClassINET}
+	err := exchange(ctx, opts, []dnsclient.Question{q}, func(msg *dnsclient.Message, ask func(...dnsclient.Question)) bool {
+		records := append(msg.Answers, msg.Additionals...)
+		for _, rr := range records {
+			name := dnsclient.CanonicalName(rr.Name)
+			switch d := rr.Data.(type) {
+			case *dnsclient.NameData:
+				if rr.Type == dnsclient.TypePTR && name == dnsclient.CanonicalName(svc) {
+					key := dnsclient.CanonicalName(d.Target)
+					if _, ok := entries[key]; !ok && rr.TTL != 0 {
+						label, _ := splitFirstLabel(d.Target)
+						entries[key] = &ServiceEntry{Instance: d.Target, Name: label, Service: svc}
+					}
+				}
+			case *dnsclient.A:
+				hostAddrs[name] = appendAddr(hostAddrs[name], d.Addr)
+			case *dnsclient.AAAA:
+				hostAddrs[name] = appendAddr(hostAddrs[name], opts.zoned(d.Addr))
+			}
+		}
+		for _, rr := range records {
+			se, ok := entries[dnsclient.CanonicalName(rr.Name)]
+			if !ok {
+				continue
+			}
+			switch d := rr.Data.(type) {
+			case *dnsclient.SRV:
+				se.Host, se.Port = d.Target, d.Port
+			case *dnsclient.TXT:
+				se.TXT = d.Strings
+			}
+		}
+		for key, se := range entries {
+			if se.Host == "" && !asked[key] {
+				asked[key] = true
+				ask(dnsclient.Question{Name: se.Instance, Type: dnsclient.TypeSRV, Class: dnsclient.ClassINET},
+					dnsclient.Question{Name: se.Instance, Type: dnsclient.TypeTXT, Class: dnsclient.ClassINET})
+			}
+			host := dnsclient.CanonicalName(se.Host)
+			if se.Host != "" && len(hostAddrs[host]) == 0 && !asked[host] {
+				asked[host] = true
+				ask(dnsclient.Question{Name: se.Host, Type: dnsclient.TypeA, Class: dnsclient.ClassINET},
+					dnsclient.Question{Name: se.Host, Type: dnsclient.TypeAAAA, Class: dnsclient.ClassINET})
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]ServiceEntry, 0, len(entries))
+	for _, se := range entries {
+		se.Addrs = hostAddrs[dnsclient.CanonicalName(se.Host)]
+		list = append(list, *se)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Instance < list[j].Instance })
+	return list, nil
+}
+
+// BrowseServices lists the service types announced on the link.
+func BrowseServices(ctx context.Context, opts Options) ([]string, error) {
+	types := make([]string, 0)
+	q := dnsclient.Question{Name: ServicesName, Type: dnsclient.TypePTR, Class: dnsclient.ClassINET}
+	err := exchange(ctx, opts, []dnsclient.Question{q}, func(msg *dnsclient.Message, _ func(...dnsclient.Question)) bool {
+		for _, rr := range msg.Answers {
+			if d, ok := rr.Data.(*dnsclient.NameData); ok && strings.EqualFold(rr.Name, ServicesName) {
+				if !containsFold(types, d.Target) {
+					types = append(types, d.Target)
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(types)
+	return types, nil
+}
+
+// exchange sends questions from ephemeral ports and hands every response
+// to handle until it returns true or the context ends, the latter is not
+// an error. handle may ask further questions. Queries are repeated after
+// 1, 2, 4... seconds.
+func exchange(ctx context.Context, opts Options, questions []dnsclient.Question, handle func(*dnsclient.Message, func(...dnsclient.Question)) bool) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	conns := make([]*mconn, 0, 2)
+	defer func() {
+		for _, c := range conns {
+			c.close()
+		}
+	}()
+	for _, network := range networks(opts.Network) {
+		c, err := listen(network, opts.Iface, false)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, c)
+	}
+
+	send := func(qs []dnsclient.Question) error {
+		msg := &dnsclient.Message{Questions: qs}
+		b, err := msg.Pack()
+		if err != nil {
+			return err
+		}
+		var lastErr error
+		sent := 0
+		for _, c := range conns {
+			if err := c.writeTo(b, c.group); err != nil {
+				lastErr = err
+				continue
+			}
+			sent++
+		}
+		if sent == 0 {
+			return lastErr
+		}
+		return nil
+	}
+	if err := send(questions); err != nil {
+		return err
+	}
+
+	var pending []dnsclient.Question
+	ask := func(qs ...dnsclient.Question) {
+		pending = append(pending, qs...)
+	}
+	msgs := make(chan *dnsclient.Message)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, c := range conns {
+		go func(c *mconn) {
+			buf := make([]byte, maxPacket)
+			for {
+				n, ifIndex, _, err := c.readFrom(buf)
+				if err != nil {
+					return
+				}
+				if opts.Iface != nil && ifIndex != 0 && ifIndex != opts.Iface.Index {
+					continue
+				}
+				msg := &dnsclient.Message{}
+				if msg.Unpack(buf[:n]) != nil || !msg.Response {
+					continue
+				}
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(c)
+	}
+
+	interval := time.Second
+	resend := time.NewTimer(interval)
+	defer resend.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-resend.C:
+			interval *= 2
+			resend.Reset(interval)
+			if err := send(questions); err != nil {
+				return err
+			}
+		case msg := <-msgs:
+			pending = pending[:0]
+			for i := range msg.Answers {
+				msg.Answers[i].Class &^= classCacheFlush
+			}
+			for i := range msg.Additionals {
+				msg.Additionals[i].Class &^= classCacheFlush
+			}
+			if handle(msg, ask) {
+				return nil
+			}
+			if len(pending) != 0 {
+				more := append([]dnsclient.Question{}, pending...)
+				questions = append(questions, more...)
+				if err := send(more); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func appendAddr(addrs []netip.Addr, addr netip.Addr) []netip.Addr {
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,422 @@
+package mdns
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+)
+
+var ErrResponderStarted = errors.New("mdns responder already started")
+
+// Service is a DNS-SD service instance published by a Responder.
+type Service struct {
+	Instance string // "My Web Server"
+	Service  string // "_http._tcp"
+	Port     uint16
+	TXT      []string // "key=value" pairs
+	Host     string   // target host, defaults to the responder host
+}
+
+// Responder answers mDNS queries for a host name and its services on one
+// interface. It announces its records on start and sends goodbyes on close,
+// probing for name conflicts is not done.
+type Responder struct {
+	iface   *net.Interface
+	host    string
+	addrs   []netip.Addr
+	network string
+
+	mu       sync.Mutex
+	services []Service
+	conns    []*mconn
+	wg       sync.WaitGroup
+	closed   chan struct{}
+}
+
+// NewResponder publishes host ("myhost" or "myhost.local") with addrs on
+// iface, nil addrs take the interface addresses. network is "udp4", "udp6"
+// or "udp" for both, empty means "udp4".
+func NewResponder(iface *net.Interface, host string, addrs []netip.Addr, network string) (*Responder, error) {
+	if iface == nil {
+		return nil, errors.New("mdns responder needs an interface")
+	}
+	if !IsLocalName(host) {
+		host = strings.TrimSuffix(host, ".") + "." + DefaultDomain
+	}
+	if addrs == nil {
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		addrs = make([]netip.Addr, 0, len(ifAddrs))
+		for _, a := range ifAddrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				if addr, ok := netip.AddrFromSlice(ipNet.IP); ok {
+					addrs = append(addrs, addr.Unmap().WithZone(""))
+				}
+			}
+		}
+	}
+	return &Responder{
+		iface:    iface,
+		host:     dnsclient.Fqdn(host),
+		addrs:    addrs,
+		network:  network,
+		services: make([]Service, 0),
+	}, nil
+}
+
+// Host is the published host name with trailing dot.
+func (r *Responder) Host() string {
+	return r.host
+}
+
+// AddService publishes s, announcing it when the responder runs.
+func (r *Responder) AddService(s Service) {
+	r.mu.Lock()
+	r.services = append(r.services, s)
+	running := r.conns != nil
+	r.mu.Unlock()
+	if running {
+		r.announce(r.serviceRecords(s, hostTTL, serviceTTL))
+	}
+}
+
+// RemoveService withdraws the instance with a goodbye packet.
+func (r *Responder) RemoveService(instance, service string) {
+	r.mu.Lock()
+	var removed []Service
+	kept := r.services[:0]
+	for _, s := range r.services {
+		if s.Instance == instance && strings.EqualFold(ServiceFqdn(s.Service), ServiceFqdn(service)) {
+			removed = append(removed, s)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	r.services = kept
+	running := r.conns != nil
+	typeInUse := false
+	for _, s := range kept {
+		if strings.EqualFold(ServiceFqdn(s.Service), ServiceFqdn(service)) {
+			typeInUse = true
+		}
+	}
+	r.mu.Unlock()
+	if !running {
+		return
+	}
+	for _, s := range removed {
+		goodbyes := r.serviceRecords(s, 0, 0)
+		if typeInUse {
+			goodbyes = goodbyes[1:]
+		}
+		r.send(goodbyes, nil)
+	}
+}
+
+// Start joins the multicast groups, serves queries and announces the records.
+func (r *Responder) Start() error {
+	r.mu.Lock()
+	if r.conns != nil {
+		r.mu.Unlock()
+		return ErrResponderStarted
+	}
+	conns := make([]*mconn, 0, 2)
+	for _, network := range networks(r.network) {
+		c, err := listen(network, r.iface, true)
+		if err != nil {
+			for _, c := range conns {
+				c.close()
+			}
+			r.mu.Unlock()
+			return err
+		}
+		conns = append(conns, c)
+	}
+	r.conns = conns
+	r.closed = make(chan struct{})
+	r.mu.Unlock()
+
+	for _, c := range conns {
+		r.wg.Add(1)
+		go r.serve(c)
+	}
+	// two announcements one second apart (section 8.3)
+	r.announce(r.allRecords(hostTTL, serviceTTL))
+	return nil
+}
+
+// Close sends goodbyes and stops the responder.
+func (r *Responder) Close() error {
+	r.mu.Lock()
+	conns := r.conns
+	if conns == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+	r.send(r.allRecords(0, 0), nil)
+
+	r.mu.Lock()
+	close(r.closed)
+	r.conns = nil
+	r.mu.Unlock()
+	var err error
+	for _, c := range conns {
+		if cerr := c.close(); cerr != nil {
+			err = cerr
+		}
+	}
+	r.wg.Wait()
+	return err
+}
+
+func (r *Responder) announce(records []dnsclient.Resource) {
+	r.send(records, nil)
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		select {
+		case <-time.After(time.Second):
+			r.send(records, nil)
+		case <-closed:
+		}
+	}()
+}
+
+// send multicasts an unsolicited response, or answers to a unicast dst.
+func (r *Responder) send(records []dnsclient.Resource, dst *net.UDPAddr) {
+	if len(records) == 0 {
+		return
+	}
+	msg := &dnsclient.Message{Header: dnsclient.Header{Response: true, Authoritative: true}, Answers: records}
+	b, err := msg.Pack()
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	conns := r.conns
+	r.mu.Unlock()
+	for _, c := range conns {
+		if dst != nil {
+			if (dst.IP.To4() != nil) == (c.p4 != nil) {
+				c.writeTo(b, dst)
+			}
+			continue
+		}
+		c.writeTo(b, c.group)
+	}
+}
+
+func (r *Responder) serve(c *mconn) {
+	defer r.wg.Done()
+	buf := make([]byte, maxPacket)
+	for {
+		n, ifIndex, src, err := c.readFrom(buf)
+		if err != nil {
+			return
+		}
+		if ifIndex != 0 && ifIndex != r.iface.Index {
+			continue
+		}
+		query := &dnsclient.Message{}
+		if query.Unpack(buf[:n]) != nil || query.Response || query.Opcode != 0 || src == nil {
+			continue
+		}
+		r.handle(c, query, src)
+	}
+}
+
+func (r *Responder) handle(c *mconn, query *dnsclient.Message, src *net.UDPAddr) {
+	// a query from another port than 5353 is a legacy or one-shot query
+	legacy := src.Port != Port
+	unicast := legacy
+	answers := make([]dnsclient.Resource, 0)
+	additionals := make([]dnsclient.Resource, 0)
+	shared := false
+	for _, q := range query.Questions {
+		if q.Class&classQU != 0 {
+			unicast = true
+		}
+		ans, add := r.answer(q)
+		for _, rr := range ans {
+			if knownAnswer(query.Answers, rr) {
+				continue
+			}
+			if rr.Type == dnsclient.TypePTR {
+				shared = true
+			}
+			answers = appendRecord(answers, rr)
+		}
+		for _, rr := range add {
+			additionals = appendRecord(additionals, rr)
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+	resp := &dnsclient.Message{Header: dnsclient.Header{Response: true, Authoritative: true}, Answers: answers}
+	if legacy {
+		resp.ID = query.ID
+		resp.Questions = query.Questions
+	}
+	for _, section := range [][]dnsclient.Resource{resp.Answers, additionals} {
+		for i := range section {
+			rr := &section[i]
+			if legacy {
+				// no cache flush bit and short TTLs for legacy resolvers
+				rr.Class &^= classCacheFlush
+				if rr.TTL > legacyTTL {
+					rr.TTL = legacyTTL
+				}
+			}
+		}
+	}
+	for _, rr := range additionals {
+		if !containsRecord(answers, rr) {
+			resp.Additionals = append(resp.Additionals, rr)
+		}
+	}
+	b, err := resp.Pack()
+	if err != nil {
+		return
+	}
+	dst := c.group
+	if unicast {
+		dst = src
+	}
+	if shared && !unicast {
+		// shared records get a random delay so responders do not collide
+		time.AfterFunc(time.Duration(20+rand.Intn(100))*time.Millisecond, func() {
+			c.writeTo(b, dst)
+		})
+		return
+	}
+	c.writeTo(b, dst)
+}
+
+// answer returns the answers and additional records for one question.
+func (r *Responder) answer(q dnsclient.Question) ([]dnsclient.Resource, []dnsclient.Resource) {
+	name := dnsclient.CanonicalName(q.Name)
+	all := r.allRecords(hostTTL, serviceTTL)
+	answers := make([]dnsclient.Resource, 0)
+	for _, rr := range all {
+		if dnsclient.CanonicalName(rr.Name) == name && (q.Type == rr.Type || q.Type == dnsclient.TypeANY) {
+			answers = append(answers, rr)
+		}
+	}
+	// additionals follow RFC 6763 section 12
+	additionals := make([]dnsclient.Resource, 0)
+	for _, ans := range answers {
+		var targets []string
+		switch d := ans.Data.(type) {
+		case *dnsclient.NameData:
+			if ans.Type == dnsclient.TypePTR {
+				targets = []string{d.Target}
+			}
+		case *dnsclient.SRV:
+			targets = []string{d.Target}
+		}
+		for _, target := range targets {
+			target = dnsclient.CanonicalName(target)
+			for _, rr := range all {
+				if dnsclient.CanonicalName(rr.Name) != target {
+					continue
+				}
+				additionals = append(additionals, rr)
+				if srv, ok := rr.Data.(*dnsclient.SRV); ok {
+					host := dnsclient.CanonicalName(srv.Target)
+					for _, hr := range all {
+						if dnsclient.CanonicalName(hr.Name) == host && (hr.Type == dnsclient.TypeA || hr.Type == dnsclient.TypeAAAA) {
+							additionals = append(additionals, hr)
+						}
+					}
+				}
+			}
+		}
+	}
+	return answers, additionals
+}
+
+// allRecords builds every published record with the given TTLs,
+// 0 makes goodbye records.
+func (r *Responder) allRecords(uniqueTTL, sharedTTL uint32) []dnsclient.Resource {
+	records := make([]dnsclient.Resource, 0)
+	for _, addr := range r.addrs {
+		rr := dnsclient.Resource{Name: r.host, Class: dnsclient.ClassINET | classCacheFlush, TTL: uniqueTTL}
+		if addr.Is4() {
+			rr.Type, rr.Data = dnsclient.TypeA, &dnsclient.A{Addr: addr}
+		} else {
+			rr.Type, rr.Data = dnsclient.TypeAAAA, &dnsclient.AAAA{Addr: addr}
+		}
+		records = append(records, rr)
+		records = append(records, dnsclient.Resource{Name: reverseName(addr), Type: dnsclient.TypePTR,
+			Class: dnsclient.ClassINET | classCacheFlush, TTL: uniqueTTL, Data: &dnsclient.NameData{Target: r.host}})
+	}
+	r.mu.Lock()
+	services := append([]Service{}, r.services...)
+	r.mu.Unlock()
+	for _, s := range services {
+		for _, rr := range r.serviceRecords(s, uniqueTTL, sharedTTL) {
+			// the service type PTR is shared by all instances of a type
+			records = appendRecord(records, rr)
+		}
+	}
+	return records
+}
+
+func (r *Responder) serviceRecords(s Service, uniqueTTL, sharedTTL uint32) []dnsclient.Resource {
+	svc := ServiceFqdn(s.Service)
+	instance := InstanceFqdn(s.Instance, s.Service)
+	host := r.host
+	if s.Host != "" {
+		host = dnsclient.Fqdn(s.Host)
+	}
+	txt := s.TXT
+	if len(txt) == 0 {
+		// a TXT record must hold at least one string (section 6.1)
+		txt = []string{""}
+	}
+	return []dnsclient.Resource{
+		{Name: ServicesName, Type: dnsclient.TypePTR, Class: dnsclient.ClassINET, TTL: sharedTTL, Data: &dnsclient.NameData{Target: svc}},
+		{Name: svc, Type: dnsclient.TypePTR, Class: dnsclient.ClassINET, TTL: sharedTTL, Data: &dnsclient.NameData{Target: instance}},
+		{Name: instance, Type: dnsclient.TypeSRV, Class: dnsclient.ClassINET | classCacheFlush, TTL: uniqueTTL, Data: &dnsclient.SRV{Port: s.Port, Target: host}},
+		{Name: instance, Type: dnsclient.TypeTXT, Class: dnsclient.ClassINET | classCacheFlush, TTL: sharedTTL, Data: &dnsclient.TXT{Strings: txt}},
+	}
+}
+
+// knownAnswer implements known-answer suppression (section 7.1).
+func knownAnswer(known []dnsclient.Resource, rr dnsclient.Resource) bool {
+	for _, k := range known {
+		if sameRecord(k, rr) && k.TTL >= rr.TTL/2 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRecord(list []dnsclient.Resource, rr dnsclient.Resource) bool {
+	for _, item := range list {
+		if sameRecord(item, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendRecord(list []dnsclient.Resource, rr dnsclient.Resource) []dnsclient.Resource {
+	if containsRecord(list, rr) {
+		return list
+	}
+	return append(list, rr)
+}
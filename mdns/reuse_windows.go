@@ -0,0 +1,21 @@
+//go:build windows
+
+package mdns
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// reuseControl lets the socket share the mDNS port with the system responder.
+func reuseControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
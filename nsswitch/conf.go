@@ -0,0 +1,182 @@
+package nsswitch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const NSSWITCH_CONF_PATH = "/etc/nsswitch.conf"
+
+// lookup results of a source, nsswitch.conf(5)
+const (
+	StatusSuccess  = "SUCCESS"
+	StatusNotFound = "NOTFOUND"
+	StatusUnavail  = "UNAVAIL"
+	StatusTryAgain = "TRYAGAIN"
+
+	ActionReturn   = "return"
+	ActionContinue = "continue"
+	ActionMerge    = "merge"
+)
+
+// glibc falls back to this when the hosts line is missing
+const defaultHostsLine = "files dns"
+
+// Criterion is one "[STATUS=action]" item, Negate for "[!STATUS=action]".
+type Criterion struct {
+	Status string `json:"status"`
+	Negate bool   `json:"negate,omitempty"`
+	Action string `json:"action"`
+}
+
+type Source struct {
+	Name     string      `json:"name"`
+	Criteria []Criterion `json:"criteria,omitempty"`
+}
+
+// ActionFor returns what happens after the source returned status.
+func (s Source) ActionFor(status string) string {
+	for _, c := range s.Criteria {
+		if (c.Status == status) != c.Negate {
+			return c.Action
+		}
+	}
+	if status == StatusSuccess {
+		return ActionReturn
+	}
+	return ActionContinue
+}
+
+func (s Source) String() string {
+	var sb strings.Builder
+	sb.WriteString(s.Name)
+	for _, c := range s.Criteria {
+		sb.WriteString(" [")
+		if c.Negate {
+			sb.WriteString("!")
+		}
+		sb.WriteString(c.Status + "=" + c.Action + "]")
+	}
+	return sb.String()
+}
+
+// Conf maps database names (hosts, passwd, ...) to their sources.
+type Conf struct {
+	Databases map[string][]Source `json:"databases"`
+}
+
+// Load parses path, usually NSSWITCH_CONF_PATH.
+func Load(path string) (*Conf, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return Parse(fd)
+}
+
+func Parse(r io.Reader) (*Conf, error) {
+	c := &Conf{Databases: make(map[string][]Source)}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		db, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("nsswitch.conf line %d: missing colon", lineNo)
+			}
+			continue
+		}
+		sources, err := ParseSources(rest)
+		if err != nil {
+			return nil, fmt.Errorf("nsswitch.conf line %d: %w", lineNo, err)
+		}
+		c.Databases[strings.TrimSpace(db)] = sources
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseSources parses the right hand side of a database line.
+func ParseSources(s string) ([]Source, error) {
+	sources := make([]Source, 0)
+	for len(s) != 0 {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		if s[0] == '[' {
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated action in %q", s)
+			}
+			if len(sources) == 0 {
+				return nil, fmt.Errorf("action %q before any source", s[:end+1])
+			}
+			criteria, err := parseCriteria(s[1:end])
+			if err != nil {
+				return nil, err
+			}
+			last := &sources[len(sources)-1]
+			last.Criteria = append(last.Criteria, criteria...)
+			s = s[end+1:]
+			continue
+		}
+		end := strings.IndexAny(s, " \t[")
+		if end < 0 {
+			end = len(s)
+		}
+		sources = append(sources, Source{Name: s[:end]})
+		s = s[end:]
+	}
+	return sources, nil
+}
+
+// parseCriteria handles "NOTFOUND=return", "!UNAVAIL=return" and
+// several items inside one bracket.
+func parseCriteria(s string) ([]Criterion, error) {
+	criteria := make([]Criterion, 0, 1)
+	for _, item := range strings.Fields(s) {
+		status, action, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad action %q", item)
+		}
+		c := Criterion{Action: strings.ToLower(action)}
+		if strings.HasPrefix(status, "!") {
+			c.Negate = true
+			status = status[1:]
+		}
+		c.Status = strings.ToUpper(status)
+		switch c.Status {
+		case StatusSuccess, StatusNotFound, StatusUnavail, StatusTryAgain:
+		default:
+			return nil, fmt.Errorf("unknown status %q", status)
+		}
+		switch c.Action {
+		case ActionReturn, ActionContinue, ActionMerge:
+		default:
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+		criteria = append(criteria, c)
+	}
+	return criteria, nil
+}
+
+// Hosts returns the sources of the hosts database with the glibc default.
+func (c *Conf) Hosts() []Source {
+	if sources, ok := c.Databases["hosts"]; ok && len(sources) != 0 {
+		return sources
+	}
+	sources, _ := ParseSources(defaultHostsLine)
+	return sources
+}
@@ -0,0 +1,275 @@
+package nsswitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/kmahyyg/go-network-compo/dns"
+	"github.com/kmahyyg/go-network-compo/dnsclient"
+	"github.com/kmahyyg/go-network-compo/hosts"
+)
+
+// Step is what one source of the hosts line did for the traced name.
+type Step struct {
+	Source  string       `json:"source"`
+	Status  string       `json:"status,omitempty"`
+	Action  string       `json:"action,omitempty"`
+	Addrs   []netip.Addr `json:"addrs,omitempty"`
+	Skipped bool         `json:"skipped"`
+	Note    string       `json:"note,omitempty"`
+}
+
+func (s Step) ToTableString() string {
+	if s.Skipped {
+		return fmt.Sprintf("%s\tskipped\t%s\n", s.Source, s.Note)
+	}
+	return fmt.Sprintf("%s\t%s -> %s\t%v\t%s\n", s.Source, s.Status, s.Action, s.Addrs, s.Note)
+}
+
+// Result is the provenance of a host name lookup, like `getent ahosts`
+// telling which source answered.
+type Result struct {
+	Name       string       `json:"name"`
+	Steps      []Step       `json:"steps"`
+	AnsweredBy string       `json:"answered_by,omitempty"` // empty if nothing answered
+	Addrs      []netip.Addr `json:"addrs"`
+	// the walk stopped at a source that is not emulated, glibc may have
+	// answered or returned there, so AnsweredBy and Addrs stay empty
+	Indeterminate bool   `json:"indeterminate"`
+	StoppedAt     string `json:"stopped_at,omitempty"`
+}
+
+func (r *Result) ToPortableJSON() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// Options replace parts of the system setup, zero values read the system files.
+type Options struct {
+	Conf       *Conf
+	HostsPath  string
+	Client     *dnsclient.Client
+	ResolvConf *dns.ResolvConf // search list and ndots for the dns source
+}
+
+// Trace walks the hosts sources of nsswitch.conf for name: files is looked up
+// in the hosts file, dns with the stub client over the glibc search list, myhostname is emulated.
+// Other sources like resolve or mdns are not queried: the walk stops there and
+// the result is Indeterminate. mdns*_minimal only continue for names outside .local.
+func Trace(ctx context.Context, name string, opts Options) (*Result, error) {
+	conf := opts.Conf
+	if conf == nil {
+		var err error
+		if conf, err = Load(NSSWITCH_CONF_PATH); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			conf = &Conf{Databases: make(map[string][]Source)}
+		}
+	}
+	if opts.HostsPath == "" {
+		opts.HostsPath = hosts.DefaultPath()
+	}
+
+	res := &Result{Name: name, Steps: make([]Step, 0), Addrs: make([]netip.Addr, 0)}
+	// a success replaces earlier ones unless they asked to merge
+	collected := make([]netip.Addr, 0)
+	from := make([]string, 0)
+	mergePending := false
+	done := false
+	for _, src := range conf.Hosts() {
+		if done {
+			note := "not reached"
+			if res.Indeterminate {
+				note = "not reached, outcome of " + res.StoppedAt + " unknown"
+			}
+			res.Steps = append(res.Steps, Step{Source: src.String(), Skipped: true, Note: note})
+			continue
+		}
+		step := Step{Source: src.String()}
+		switch src.Name {
+		case "files":
+			step.Status, step.Addrs, step.Note = lookupFiles(opts.HostsPath, name)
+		case "dns":
+			step.Status, step.Addrs, step.Note = lookupDNS(ctx, opts.Client, opts.ResolvConf, name)
+		case "myhostname":
+			step.Status, step.Addrs, step.Note = lookupMyHostname(name)
+		case "mdns", "mdns4", "mdns6", "mdns_minimal", "mdns4_minimal", "mdns6_minimal":
+			step.Skipped = true
+			step.Note = "multicast DNS is not emulated"
+			if strings.HasSuffix(src.Name, "_minimal") && !isLocalName(name) {
+				// minimal variants only handle .local, NOTFOUND otherwise
+				step.Skipped = false
+				step.Status = StatusNotFound
+				step.Note = "not a .local name"
+			}
+		case "resolve":
+			step.Skipped = true
+			step.Note = "handled by systemd-resolved, not emulated"
+		default:
+			step.Skipped = true
+			step.Note = "nss module " + src.Name + " is not emulated"
+		}
+		if step.Skipped {
+			// glibc would query it and may return, do not guess past it
+			res.Steps = append(res.Steps, step)
+			res.Indeterminate, res.StoppedAt = true, src.Name
+			done = true
+			continue
+		}
+		step.Action = src.ActionFor(step.Status)
+		res.Steps = append(res.Steps, step)
+		if step.Status == StatusSuccess {
+			if !mergePending {
+				collected, from = collected[:0], from[:0]
+			}
+			collected = append(collected, step.Addrs...)
+			from = append(from, src.Name)
+			mergePending = step.Action == ActionMerge
+		}
+		if step.Action == ActionReturn {
+			done = true
+		}
+	}
+	if len(collected) != 0 && !res.Indeterminate {
+		res.Addrs = dedup(collected)
+		res.AnsweredBy = strings.Join(from, "+")
+	}
+	return res, nil
+}
+
+func lookupFiles(path, name string) (string, []netip.Addr, string) {
+	f, err := hosts.Load(path)
+	if err != nil {
+		return StatusUnavail, nil, err.Error()
+	}
+	addrs := f.LookupName(name)
+	if len(addrs) == 0 {
+		return StatusNotFound, nil, path
+	}
+	return StatusSuccess, addrs, path
+}
+
+func lookupDNS(ctx context.Context, client *dnsclient.Client, rc *dns.ResolvConf, name string) (string, []netip.Addr, string) {
+	if client == nil {
+		var err error
+		if client, err = dnsclient.NewSystemClient(); err != nil {
+			return StatusUnavail, nil, err.Error()
+		}
+	}
+	if rc == nil {
+		rc = dns.NewResolvConf()
+		if cfg, err := dns.RetrieveConfig(); err == nil && cfg.ResolvConf != nil {
+			rc = cfg.ResolvConf
+		}
+	}
+	// the next candidate is only tried when this one does not exist
+	for _, candidate := range rc.Candidates(name, dns.SearchModeGlibc) {
+		status, addrs, note := queryAddrs(ctx, client, candidate)
+		if status == StatusNotFound {
+			continue
+		}
+		if status == StatusSuccess {
+			note = "as " + candidate
+		}
+		return status, addrs, note
+	}
+	return StatusNotFound, nil, ""
+}
+
+func queryAddrs(ctx context.Context, client *dnsclient.Client, name string) (string, []netip.Addr, string) {
+	addrs := make([]netip.Addr, 0)
+	notFound := 0
+	var lastErr error
+	for _, t := range []dnsclient.Type{dnsclient.TypeA, dnsclient.TypeAAAA} {
+		resp, err := client.Query(ctx, name, t)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch resp.RCode {
+		case dnsclient.RCodeSuccess:
+			found := resp.AnswerAddrs()
+			if len(found) == 0 {
+				notFound++
+			}
+			addrs = append(addrs, found...)
+		case dnsclient.RCodeNameError:
+			notFound++
+		default:
+			lastErr = errors.New(resp.RCode.String())
+		}
+	}
+	switch {
+	case len(addrs) != 0:
+		return StatusSuccess, addrs, ""
+	case notFound == 2:
+		return StatusNotFound, nil, ""
+	case errors.Is(lastErr, dnsclient.ErrNoUpstreams):
+		return StatusUnavail, nil, lastErr.Error()
+	case lastErr != nil:
+		return StatusTryAgain, nil, lastErr.Error()
+	}
+	return StatusNotFound, nil, ""
+}
+
+// lookupMyHostname follows nss-myhostname: localhost names are loopback,
+// the local host name gets the configured addresses.
+func lookupMyHostname(name string) (string, []netip.Addr, string) {
+	lname := strings.ToLower(strings.TrimSuffix(name, "."))
+	if lname == "localhost" || strings.HasSuffix(lname, ".localhost") ||
+		lname == "localhost.localdomain" {
+		return StatusSuccess, []netip.Addr{netip.IPv6Loopback(), netip.AddrFrom4([4]byte{127, 0, 0, 1})}, "loopback"
+	}
+	hostname, err := os.Hostname()
+	if err != nil || !strings.EqualFold(lname, hostname) {
+		return StatusNotFound, nil, ""
+	}
+	addrs := make([]netip.Addr, 0)
+	ifAddrs, _ := net.InterfaceAddrs()
+	for _, a := range ifAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		if addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, netip.AddrFrom4([4]byte{127, 0, 0, 2}))
+	}
+	return StatusSuccess, addrs, "local host name"
+}
+
+func isLocalName(name string) bool {
+	lname := strings.ToLower(strings.TrimSuffix(name, "."))
+	return lname == "local" || strings.HasSuffix(lname, ".local")
+}
+
+func dedup(addrs []netip.Addr) []netip.Addr {
+	seen := make(map[netip.Addr]bool)
+	out := make([]netip.Addr, 0, len(addrs))
+	for _, a := range addrs {
+		if !seen[a] {
+			seen[a] = true
+			out = append(out, a)
+		}
+	}
+	return out
+}
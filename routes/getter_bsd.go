@@ -5,6 +5,7 @@ package routes
 import (
 	"github.com/kmahyyg/go-network-compo/utils"
 	"golang.org/x/net/route"
+	"net"
 	"strconv"
 	"syscall"
 )
@@ -110,11 +111,14 @@ func Retrieve() ([]NetRoute, error) {
 			gatewayStr = "unk"
 		}
 
+		// interface name, from RTAX_IFP when sent, else from the route's interface index
 		netIfAddr := rmsg.Addrs[syscall.RTAX_IFA]
-		netIfName := rmsg.Addrs[syscall.RTAX_IFP]
+		netIfName, _ := rmsg.Addrs[syscall.RTAX_IFP].(*route.LinkAddr)
 		var netIfStr = ""
-		if netIfName != nil {
-			netIfStr = ""
+		if netIfName != nil && netIfName.Name != "" {
+			netIfStr = netIfName.Name
+		} else if iface, err := net.InterfaceByIndex(rmsg.Index); rmsg.Index > 0 && err == nil {
+			netIfStr = iface.Name
 		} else {
 			switch netIfAddr.(type) {
 			case (*route.Inet4Addr):
@@ -0,0 +1,70 @@
+//go:build linux
+
+package routes
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// KernelLookup asks the kernel which route a packet to dst takes, like
+// `ip route get`: IPv6 and policy routing rules included, unlike Lookup on
+// the main IPv4 table. Destination is dst as host route, Gateway "0.0.0.0"
+// or "::" on link. Unreachable destinations return ErrNoRoute.
+func KernelLookup(dst netip.Addr) (*NetRoute, error) {
+	dst = dst.Unmap()
+	h := &unix.RtMsg{Family: unix.AF_INET, Dst_len: 32}
+	gateway := "0.0.0.0"
+	if dst.Is6() {
+		h.Family, h.Dst_len, gateway = unix.AF_INET6, 128, "::"
+	}
+	body := rtnl.AppendAttr(rtnl.RtMsgBytes(h), unix.RTA_DST, dst.AsSlice())
+	c, err := rtnl.Dial(0)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	msgs, err := c.Execute(unix.RTM_GETROUTE, 0, body)
+	if errors.Is(err, unix.ENETUNREACH) || errors.Is(err, unix.EHOSTUNREACH) {
+		return nil, ErrNoRoute
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		if m.Type != unix.RTM_NEWROUTE {
+			continue
+		}
+		rt, attrs, err := rtnl.RtMsg(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		if rt.Type != unix.RTN_UNICAST && rt.Type != unix.RTN_LOCAL {
+			return nil, ErrNoRoute
+		}
+		rf := RouteFlag{U: true, H: true}
+		nr := &NetRoute{Destination: dst.String() + "/" + strconv.Itoa(dst.BitLen()), Gateway: gateway}
+		for _, a := range attrs {
+			switch a.Type {
+			case unix.RTA_OIF:
+				if iface, err := net.InterfaceByIndex(int(a.Uint32())); err == nil {
+					nr.NetIf = iface.Name
+				}
+			case unix.RTA_GATEWAY:
+				if gw, ok := netip.AddrFromSlice(a.Data); ok {
+					nr.Gateway, rf.G = gw.String(), true
+				}
+			case unix.RTA_PRIORITY:
+				nr.Metric = a.Uint32()
+			}
+		}
+		nr.Flags = rf.ToTableString()
+		return nr, nil
+	}
+	return nil, ErrNoRoute
+}
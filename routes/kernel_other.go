@@ -0,0 +1,13 @@
+//go:build !linux
+
+package routes
+
+import (
+	"net/netip"
+)
+
+// KernelLookup asks the kernel which route a packet to dst takes, only on
+// Linux. Use Lookup on the table of Retrieve elsewhere.
+func KernelLookup(dst netip.Addr) (*NetRoute, error) {
+	return nil, ErrNoKernelLookup
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoRoute           = errors.New("no route to destination")
+	ErrBadDestination    = errors.New("invalid route destination")
+	ErrNonContiguousMask = errors.New("non contiguous netmask")
+	ErrNoKernelLookup    = errors.New("kernel route lookup is only available on Linux")
+)
+
+// ParseDestination parses NetRoute.Destination, which is "ip/mask" on Linux
+// and BSD (mask "0" when the kernel sent none) and "ip/len" on Windows.
+func ParseDestination(dest string) (netip.Prefix, error) {
+	ipStr, maskStr, ok := strings.Cut(dest, "/")
+	if !ok {
+		return netip.Prefix{}, ErrBadDestination
+	}
+	addr, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return netip.Prefix{}, ErrBadDestination
+	}
+	addr = addr.Unmap()
+	var bits int
+	if mask, err := netip.ParseAddr(maskStr); err == nil {
+		if bits, err = maskBits(mask); err != nil {
+			return netip.Prefix{}, err
+		}
+	} else if bits, err = strconv.Atoi(maskStr); err != nil || bits < 0 || bits > addr.BitLen() {
+		return netip.Prefix{}, ErrBadDestination
+	}
+	return addr.Prefix(bits)
+}
+
+func maskBits(mask netip.Addr) (int, error) {
+	bits := 0
+	seenZero := false
+	for _, b := range mask.AsSlice() {
+		for i := 7; i >= 0; i-- {
+			if b&(1<<i) != 0 {
+				if seenZero {
+					return 0, ErrNonContiguousMask
+				}
+				bits++
+			} else {
+				seenZero = true
+			}
+		}
+	}
+	return bits, nil
+}
+
+// HasFlag reports whether the Flags string contains the RouteFlag field name,
+// e.g. "G" or "Rejected".
+func (nr NetRoute) HasFlag(name string) bool {
+	for _, f := range strings.Split(nr.Flags, ",") {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup emulates the kernel route selection for dst on a table from
+// Retrieve: the longest matching prefix wins, then the lowest metric.
+// Routes not up or rejected are skipped, host routes match the address only.
+func Lookup(table []NetRoute, dst netip.Addr) (*NetRoute, error) {
+	dst = dst.Unmap()
+	var best *NetRoute
+	bestBits := -1
+	for i := range table {
+		nr := &table[i]
+		if !nr.HasFlag("U") || nr.HasFlag("Rejected") {
+			continue
+		}
+		prefix, err := ParseDestination(nr.Destination)
+		if err != nil || prefix.Addr().BitLen() != dst.BitLen() {
+			continue
+		}
+		if nr.HasFlag("H") && prefix.Bits() == 0 {
+			// bsd host routes come without netmask
+			prefix = netip.PrefixFrom(prefix.Addr(), prefix.Addr().BitLen())
+		}
+		if !prefix.Contains(dst) {
+			continue
+		}
+		if prefix.Bits() > bestBits || (prefix.Bits() == bestBits && nr.Metric < best.Metric) {
+			best, bestBits = nr, prefix.Bits()
+		}
+	}
+	if best == nil {
+		return nil, ErrNoRoute
+	}
+	return best, nil
+}
+
+// OnLink reports whether the route has no gateway address, so the
+// destination is reached directly on the interface. BSD link gateways
+// like "link#4" count as on link.
+func (nr NetRoute) OnLink() bool {
+	gw, err := netip.ParseAddr(nr.Gateway)
+	return err != nil || gw.IsUnspecified()
+}
@@ -0,0 +1,9 @@
+package routes
+
+import "errors"
+
+// errors of Add, Replace and Delete
+var (
+	ErrNoInterface = errors.New("on link route without interface")
+	ErrUnsupported = errors.New("route changes are only supported on Linux")
+)
@@ -0,0 +1,108 @@
+//go:build linux
+
+package routes
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/kmahyyg/go-network-compo/rtnl"
+	"golang.org/x/sys/unix"
+)
+
+// Add installs nr in the main table over rtnetlink: Destination as from
+// Retrieve or "ip/len", Gateway empty or unspecified for an on link route,
+// NetIf and Metric optional when a gateway is given. IPv6 works too.
+func Add(nr NetRoute) error {
+	body, err := routeBody(nr, false)
+	if err == nil {
+		err = rtnl.Request(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, body)
+	}
+	if err != nil {
+		return fmt.Errorf("add route %s: %w", nr.Destination, err)
+	}
+	return nil
+}
+
+// Replace installs nr like Add, replacing a route to the same destination.
+func Replace(nr NetRoute) error {
+	body, err := routeBody(nr, false)
+	if err == nil {
+		err = rtnl.Request(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_REPLACE, body)
+	}
+	if err != nil {
+		return fmt.Errorf("replace route %s: %w", nr.Destination, err)
+	}
+	return nil
+}
+
+// Delete removes the route to Destination, Gateway, NetIf and Metric
+// narrow the match when set.
+func Delete(nr NetRoute) error {
+	body, err := routeBody(nr, true)
+	if err == nil {
+		err = rtnl.Request(unix.RTM_DELROUTE, 0, body)
+	}
+	if err != nil {
+		return fmt.Errorf("delete route %s: %w", nr.Destination, err)
+	}
+	return nil
+}
+
+func routeBody(nr NetRoute, del bool) ([]byte, error) {
+	prefix, err := ParseDestination(nr.Destination)
+	if err != nil {
+		return nil, err
+	}
+	family := uint8(unix.AF_INET)
+	if prefix.Addr().Is6() {
+		family = unix.AF_INET6
+	}
+	h := &unix.RtMsg{
+		Family:   family,
+		Dst_len:  uint8(prefix.Bits()),
+		Table:    unix.RT_TABLE_MAIN,
+		Protocol: unix.RTPROT_STATIC,
+		Scope:    unix.RT_SCOPE_UNIVERSE,
+		Type:     unix.RTN_UNICAST,
+	}
+	var gw netip.Addr
+	if nr.Gateway != "" {
+		if gw, err = netip.ParseAddr(nr.Gateway); err != nil {
+			return nil, ErrBadDestination
+		}
+		gw = gw.Unmap()
+	}
+	onLink := !gw.IsValid() || gw.IsUnspecified()
+	switch {
+	case del:
+		// match routes of any scope, protocol and type
+		h.Scope, h.Protocol, h.Type = unix.RT_SCOPE_NOWHERE, 0, 0
+	case onLink:
+		h.Scope = unix.RT_SCOPE_LINK
+	}
+	body := rtnl.RtMsgBytes(h)
+	if prefix.Bits() > 0 {
+		body = rtnl.AppendAttr(body, unix.RTA_DST, prefix.Masked().Addr().AsSlice())
+	}
+	if !onLink {
+		if gw.BitLen() != prefix.Addr().BitLen() {
+			return nil, ErrBadDestination
+		}
+		body = rtnl.AppendAttr(body, unix.RTA_GATEWAY, gw.AsSlice())
+	}
+	if nr.NetIf != "" {
+		iface, err := net.InterfaceByName(nr.NetIf)
+		if err != nil {
+			return nil, err
+		}
+		body = rtnl.AppendUint32(body, unix.RTA_OIF, uint32(iface.Index))
+	} else if onLink && !del {
+		return nil, ErrNoInterface
+	}
+	if nr.Metric > 0 {
+		body = rtnl.AppendUint32(body, unix.RTA_PRIORITY, nr.Metric)
+	}
+	return body, nil
+}
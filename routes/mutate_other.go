@@ -0,0 +1,18 @@
+//go:build !linux
+
+package routes
+
+// Add installs a route, only supported on Linux.
+func Add(nr NetRoute) error {
+	return ErrUnsupported
+}
+
+// Replace installs a route replacing an existing one, only supported on Linux.
+func Replace(nr NetRoute) error {
+	return ErrUnsupported
+}
+
+// Delete removes a route, only supported on Linux.
+func Delete(nr NetRoute) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,201 @@
+//go:build linux
+
+package rtnl
+
+import (
+	"encoding/binary"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// attribute type without NLA_F_NESTED and NLA_F_NET_BYTEORDER
+const attrTypeMask = 0x3fff
+
+// netlink uses the byte order of the host
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// Attr is one route attribute, Type without the nested and byte order bits.
+type Attr struct {
+	Type uint16
+	Data []byte
+}
+
+// Attrs is a list of attributes in kernel order.
+type Attrs []Attr
+
+// ParseAttrs splits b into attributes, stopping at the first malformed one.
+func ParseAttrs(b []byte) Attrs {
+	attrs := make(Attrs, 0, 8)
+	for len(b) >= unix.SizeofRtAttr {
+		l := int(nativeEndian.Uint16(b))
+		typ := nativeEndian.Uint16(b[2:])
+		if l < unix.SizeofRtAttr || l > len(b) {
+			break
+		}
+		attrs = append(attrs, Attr{Type: typ & attrTypeMask, Data: b[unix.SizeofRtAttr:l]})
+		if al := attrAlign(l); al < len(b) {
+			b = b[al:]
+		} else {
+			break
+		}
+	}
+	return attrs
+}
+
+// Get returns the first attribute of type typ.
+func (as Attrs) Get(typ uint16) (Attr, bool) {
+	for _, a := range as {
+		if a.Type == typ {
+			return a, true
+		}
+	}
+	return Attr{}, false
+}
+
+// String returns the value without the trailing NUL.
+func (a Attr) String() string {
+	return strings.TrimRight(string(a.Data), "\x00")
+}
+
+func (a Attr) Uint8() uint8 {
+	if len(a.Data) < 1 {
+		return 0
+	}
+	return a.Data[0]
+}
+
+func (a Attr) Uint16() uint16 {
+	if len(a.Data) < 2 {
+		return 0
+	}
+	return nativeEndian.Uint16(a.Data)
+}
+
+func (a Attr) Uint32() uint32 {
+	if len(a.Data) < 4 {
+		return 0
+	}
+	return nativeEndian.Uint32(a.Data)
+}
+
+func (a Attr) Uint64() uint64 {
+	if len(a.Data) < 8 {
+		return 0
+	}
+	return nativeEndian.Uint64(a.Data)
+}
+
+// Nested parses the value as attributes.
+func (a Attr) Nested() Attrs {
+	return ParseAttrs(a.Data)
+}
+
+// AppendAttr appends an attribute with its padding to b.
+func AppendAttr(b []byte, typ uint16, data []byte) []byte {
+	l := unix.SizeofRtAttr + len(data)
+	b = append(b, 0, 0, 0, 0)
+	nativeEndian.PutUint16(b[len(b)-4:], uint16(l))
+	nativeEndian.PutUint16(b[len(b)-2:], typ)
+	b = append(b, data...)
+	return append(b, make([]byte, attrAlign(l)-l)...)
+}
+
+func attrAlign(n int) int {
+	return (n + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+}
+
+// IfInfomsg splits a RTM_NEWLINK payload into header and attributes.
+func IfInfomsg(data []byte) (*unix.IfInfomsg, Attrs, error) {
+	if len(data) < unix.SizeofIfInfomsg {
+		return nil, nil, ErrTruncated
+	}
+	h := *(*unix.IfInfomsg)(unsafe.Pointer(&data[0]))
+	return &h, ParseAttrs(data[unix.SizeofIfInfomsg:]), nil
+}
+
+// IfInfomsgBytes is the wire form of h, the body of link requests.
+func IfInfomsgBytes(h *unix.IfInfomsg) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg)
+	*(*unix.IfInfomsg)(unsafe.Pointer(&b[0])) = *h
+	return b
+}
+
+// IfAddrmsg splits a RTM_NEWADDR payload into header and attributes.
+func IfAddrmsg(data []byte) (*unix.IfAddrmsg, Attrs, error) {
+	if len(data) < unix.SizeofIfAddrmsg {
+		return nil, nil, ErrTruncated
+	}
+	h := *(*unix.IfAddrmsg)(unsafe.Pointer(&data[0]))
+	return &h, ParseAttrs(data[unix.SizeofIfAddrmsg:]), nil
+}
+
+// IfAddrmsgBytes is the wire form of h, the body of address requests.
+func IfAddrmsgBytes(h *unix.IfAddrmsg) []byte {
+	b := make([]byte, unix.SizeofIfAddrmsg)
+	*(*unix.IfAddrmsg)(unsafe.Pointer(&b[0])) = *h
+	return b
+}
+
+// RtMsg splits a RTM_NEWROUTE payload into header and attributes.
+func RtMsg(data []byte) (*unix.RtMsg, Attrs, error) {
+	if len(data) < unix.SizeofRtMsg {
+		return nil, nil, ErrTruncated
+	}
+	h := *(*unix.RtMsg)(unsafe.Pointer(&data[0]))
+	return &h, ParseAttrs(data[unix.SizeofRtMsg:]), nil
+}
+
+// RtMsgBytes is the wire form of h, the body of route requests.
+func RtMsgBytes(h *unix.RtMsg) []byte {
+	b := make([]byte, unix.SizeofRtMsg)
+	*(*unix.RtMsg)(unsafe.Pointer(&b[0])) = *h
+	return b
+}
+
+// NdMsg splits a RTM_NEWNEIGH payload into header and attributes.
+func NdMsg(data []byte) (*unix.NdMsg, Attrs, error) {
+	if len(data) < unix.SizeofNdMsg {
+		return nil, nil, ErrTruncated
+	}
+	h := *(*unix.NdMsg)(unsafe.Pointer(&data[0]))
+	return &h, ParseAttrs(data[unix.SizeofNdMsg:]), nil
+}
+
+// NdMsgBytes is the wire form of h, the body of neighbour requests.
+func NdMsgBytes(h *unix.NdMsg) []byte {
+	b := make([]byte, unix.SizeofNdMsg)
+	*(*unix.NdMsg)(unsafe.Pointer(&b[0])) = *h
+	return b
+}
+
+// AppendNested appends the attributes in inner as one nested attribute.
+func AppendNested(b []byte, typ uint16, inner []byte) []byte {
+	return AppendAttr(b, typ|unix.NLA_F_NESTED, inner)
+}
+
+// AppendUint32 appends a native endian u32 attribute.
+func AppendUint32(b []byte, typ uint16, v uint32) []byte {
+	data := make([]byte, 4)
+	nativeEndian.PutUint32(data, v)
+	return AppendAttr(b, typ, data)
+}
+
+// AppendUint16 appends a native endian u16 attribute.
+func AppendUint16(b []byte, typ uint16, v uint16) []byte {
+	data := make([]byte, 2)
+	nativeEndian.PutUint16(data, v)
+	return AppendAttr(b, typ, data)
+}
+
+// AppendString appends a NUL terminated string attribute.
+func AppendString(b []byte, typ uint16, s string) []byte {
+	return AppendAttr(b, typ, append([]byte(s), 0))
+}
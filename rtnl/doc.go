@@ -0,0 +1,4 @@
+// Package rtnl is a minimal rtnetlink client shared by the Linux code of
+// the other packages: requests, dumps, notifications and attribute parsing.
+// It is empty on other systems.
+package rtnl
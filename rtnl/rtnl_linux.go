@@ -0,0 +1,194 @@
+//go:build linux
+
+package rtnl
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+var ErrTruncated = errors.New("truncated netlink message")
+
+// Message is one netlink message, Data is the payload after the header.
+type Message struct {
+	Type  uint16
+	Flags uint16
+	Seq   uint32
+	Data  []byte
+}
+
+// Conn is a NETLINK_ROUTE socket.
+type Conn struct {
+	fd   int
+	file *os.File // set by Listen
+	seq  uint32
+}
+
+// Dial opens a socket, subscribed to the RTMGRP_* multicast groups.
+func Dial(groups uint32) (*Conn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groups}); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return &Conn{fd: fd}, nil
+}
+
+// Listen opens a socket for the notifications of the RTMGRP_* groups.
+// It goes to the runtime poller, so Close unblocks a pending Receive.
+// Receive fails with ENOBUFS when notifications were lost.
+func Listen(groups uint32) (*Conn, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groups}); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// a larger buffer makes overflows rarer, the default is fine too
+	_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 1<<20)
+	return &Conn{fd: fd, file: os.NewFile(uintptr(fd), "rtnetlink")}, nil
+}
+
+func (c *Conn) Close() error {
+	if c.file != nil {
+		return c.file.Close()
+	}
+	return unix.Close(c.fd)
+}
+
+// Send writes one request and returns its sequence number.
+func (c *Conn) Send(typ, flags uint16, body []byte) (uint32, error) {
+	seq := atomic.AddUint32(&c.seq, 1)
+	b := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(body))
+	*(*unix.NlMsghdr)(unsafe.Pointer(&b[0])) = unix.NlMsghdr{
+		Len:   uint32(unix.SizeofNlMsghdr + len(body)),
+		Type:  typ,
+		Flags: flags | unix.NLM_F_REQUEST,
+		Seq:   seq,
+	}
+	b = append(b, body...)
+	if err := unix.Sendto(c.fd, b, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return 0, os.NewSyscallError("sendto", err)
+	}
+	return seq, nil
+}
+
+// Receive reads the messages of one datagram.
+func (c *Conn) Receive() ([]Message, error) {
+	buf := make([]byte, 64*1024)
+	if c.file != nil {
+		n, err := c.file.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return ParseMessages(buf[:n])
+	}
+	for {
+		n, _, err := unix.Recvfrom(c.fd, buf, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, os.NewSyscallError("recvfrom", err)
+		}
+		return ParseMessages(buf[:n])
+	}
+}
+
+// Execute sends a request and collects the replies with its sequence
+// number until the dump is done or the kernel acknowledged it.
+func (c *Conn) Execute(typ, flags uint16, body []byte) ([]Message, error) {
+	if flags&unix.NLM_F_DUMP != unix.NLM_F_DUMP {
+		flags |= unix.NLM_F_ACK
+	}
+	seq, err := c.Send(typ, flags, body)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]Message, 0)
+	for {
+		batch, err := c.Receive()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range batch {
+			if m.Seq != seq {
+				continue
+			}
+			switch m.Type {
+			case unix.NLMSG_DONE:
+				return msgs, errorCode(m.Data)
+			case unix.NLMSG_ERROR:
+				// error 0 is the acknowledgement
+				return msgs, errorCode(m.Data)
+			}
+			msgs = append(msgs, m)
+			if m.Flags&unix.NLM_F_MULTI == 0 && flags&unix.NLM_F_ACK == 0 {
+				return msgs, nil
+			}
+		}
+	}
+}
+
+func errorCode(data []byte) error {
+	if len(data) < 4 {
+		return nil
+	}
+	if code := int32(nativeEndian.Uint32(data)); code < 0 {
+		return unix.Errno(-code)
+	}
+	return nil
+}
+
+// Dump runs one NLM_F_DUMP request on a fresh socket.
+func Dump(typ uint16, body []byte) ([]Message, error) {
+	c, err := Dial(0)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.Execute(typ, unix.NLM_F_DUMP, body)
+}
+
+// Request runs one acknowledged request on a fresh socket.
+func Request(typ, flags uint16, body []byte) error {
+	c, err := Dial(0)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Execute(typ, flags, body)
+	return err
+}
+
+// ParseMessages splits a datagram into messages.
+func ParseMessages(b []byte) ([]Message, error) {
+	msgs := make([]Message, 0, 4)
+	for len(b) >= unix.SizeofNlMsghdr {
+		h := (*unix.NlMsghdr)(unsafe.Pointer(&b[0]))
+		if int(h.Len) < unix.SizeofNlMsghdr || int(h.Len) > len(b) {
+			return msgs, ErrTruncated
+		}
+		msgs = append(msgs, Message{
+			Type:  h.Type,
+			Flags: h.Flags,
+			Seq:   h.Seq,
+			Data:  b[unix.SizeofNlMsghdr:h.Len],
+		})
+		b = b[align(int(h.Len)):]
+	}
+	return msgs, nil
+}
+
+func align(n int) int {
+	return (n + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+}
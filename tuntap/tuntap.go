@@ -0,0 +1,78 @@
+// Package tuntap creates TUN and TAP devices and moves packets through them.
+// Linux only, over /dev/net/tun.
+package tuntap
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// device types
+const (
+	TypeTUN = "tun" // IP packets
+	TypeTAP = "tap" // ethernet frames
+)
+
+var (
+	ErrUnsupported = errors.New("tun/tap devices are only supported on Linux")
+	ErrShortPacket = errors.New("packet shorter than the vnet header")
+)
+
+// Config describes the device to create or attach to.
+type Config struct {
+	Name    string // "" lets the kernel pick tunN / tapN
+	Type    string // TypeTUN when empty
+	Persist bool   // keep the device after Close, delete it with SetPersist(false)
+	Queues  int    // more than 1 opens a multiqueue device with one file per queue
+	VnetHdr bool   // prefix packets with a virtio_net_hdr carrying offload metadata
+	Offload bool   // with VnetHdr: accept checksum offload and TSO, packets up to 64k
+	Owner   int    // uid allowed to attach to a persistent device, -1 for none, 0 is root
+	Group   int    // gid allowed to attach to a persistent device, -1 for none, 0 is root
+}
+
+// VnetHdr flags and GSO types, from linux/virtio_net.h
+const (
+	VnetHdrNeedsCsum = 1 // VIRTIO_NET_HDR_F_NEEDS_CSUM
+	VnetHdrDataValid = 2 // VIRTIO_NET_HDR_F_DATA_VALID
+
+	GSONone  = 0    // VIRTIO_NET_HDR_GSO_NONE
+	GSOTCPv4 = 1    // VIRTIO_NET_HDR_GSO_TCPV4
+	GSOUDP   = 3    // VIRTIO_NET_HDR_GSO_UDP
+	GSOTCPv6 = 4    // VIRTIO_NET_HDR_GSO_TCPV6
+	GSOECN   = 0x80 // VIRTIO_NET_HDR_GSO_ECN
+)
+
+// VnetHdrLen is the size of the virtio_net_hdr in front of every packet.
+const VnetHdrLen = 10
+
+// VnetHdr is the offload metadata of a packet: a packet with GSOType other
+// than GSONone is a segment train of GSOSize payloads, NeedsCsum means the
+// checksum at CsumStart+CsumOffset is still to be filled in.
+type VnetHdr struct {
+	Flags      uint8
+	GSOType    uint8
+	HdrLen     uint16
+	GSOSize    uint16
+	CsumStart  uint16
+	CsumOffset uint16
+}
+
+// the header is little endian, Create sets TUNSETVNETLE so it is on every host
+func (h VnetHdr) encode(b []byte) {
+	b[0], b[1] = h.Flags, h.GSOType
+	binary.LittleEndian.PutUint16(b[2:], h.HdrLen)
+	binary.LittleEndian.PutUint16(b[4:], h.GSOSize)
+	binary.LittleEndian.PutUint16(b[6:], h.CsumStart)
+	binary.LittleEndian.PutUint16(b[8:], h.CsumOffset)
+}
+
+func decodeVnetHdr(b []byte) VnetHdr {
+	return VnetHdr{
+		Flags:      b[0],
+		GSOType:    b[1],
+		HdrLen:     binary.LittleEndian.Uint16(b[2:]),
+		GSOSize:    binary.LittleEndian.Uint16(b[4:]),
+		CsumStart:  binary.LittleEndian.Uint16(b[6:]),
+		CsumOffset: binary.LittleEndian.Uint16(b[8:]),
+	}
+}
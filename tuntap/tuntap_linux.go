@@ -0,0 +1,264 @@
+//go:build linux
+
+package tuntap
+
+import (
+	"net/netip"
+	"os"
+	"sync"
+
+	"github.com/kmahyyg/go-network-compo/ifaces"
+	"github.com/kmahyyg/go-network-compo/routes"
+	"golang.org/x/sys/unix"
+)
+
+const TUN_DEVICE_PATH = "/dev/net/tun"
+
+// TUN_F_* offloads for TUNSETOFFLOAD, missing in x/sys
+const (
+	tunFCsum   = 0x01
+	tunFTSO4   = 0x02
+	tunFTSO6   = 0x04
+	tunFTSOECN = 0x08
+)
+
+// Device is an open TUN or TAP device with one Queue per file.
+type Device struct {
+	Name string
+	Type string
+
+	queues []*Queue
+}
+
+// Queue is one file of a device, queues of a multiqueue device are read
+// and written in parallel.
+type Queue struct {
+	file    *os.File
+	vnetHdr bool
+
+	wmu  sync.Mutex
+	wbuf []byte
+}
+
+// Create opens a new device, or attaches to an existing persistent one with
+// the same name and flags.
+func Create(cfg Config) (*Device, error) {
+	if cfg.Type == "" {
+		cfg.Type = TypeTUN
+	}
+	op := "create " + cfg.Type
+	flags := uint16(unix.IFF_NO_PI)
+	switch cfg.Type {
+	case TypeTUN:
+		flags |= unix.IFF_TUN
+	case TypeTAP:
+		flags |= unix.IFF_TAP
+	default:
+		return nil, ifaces.NewConfigError(op, cfg.Name, ifaces.ErrInvalid)
+	}
+	if cfg.Queues < 1 {
+		cfg.Queues = 1
+	}
+	if cfg.Queues > 1 {
+		flags |= unix.IFF_MULTI_QUEUE
+	}
+	if cfg.VnetHdr {
+		flags |= unix.IFF_VNET_HDR
+	}
+	// a persistent device we attach to must survive a failed Create
+	existed := false
+	if cfg.Name != "" {
+		_, err := ifaces.IndexOf(op, cfg.Name)
+		existed = err == nil
+	}
+	d := &Device{Name: cfg.Name, Type: cfg.Type}
+	for i := 0; i < cfg.Queues; i++ {
+		q, name, err := openQueue(d.Name, flags, cfg, i == 0)
+		if err != nil {
+			if cfg.Persist && !existed && len(d.queues) != 0 {
+				d.SetPersist(false)
+			}
+			d.Close()
+			return nil, ifaces.NewConfigError(op, d.Name, err)
+		}
+		d.Name = name
+		d.queues = append(d.queues, q)
+	}
+	return d, nil
+}
+
+func openQueue(name string, flags uint16, cfg Config, first bool) (*Queue, string, error) {
+	fd, err := unix.Open(TUN_DEVICE_PATH, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", ifaces.ErrInvalid
+	}
+	ifr.SetUint16(flags)
+	err = unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr)
+	if err == nil {
+		// nonblocking, so reads go through the runtime poller and Close interrupts them
+		err = unix.SetNonblock(fd, true)
+	}
+	// last, nothing may fail after TUNSETPERSIST
+	if err == nil && first {
+		err = setupDevice(fd, cfg)
+	}
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", err
+	}
+	q := &Queue{file: os.NewFile(uintptr(fd), TUN_DEVICE_PATH), vnetHdr: cfg.VnetHdr}
+	return q, ifr.Name(), nil
+}
+
+// setupDevice applies the per device settings once.
+func setupDevice(fd int, cfg Config) error {
+	if cfg.VnetHdr {
+		if err := unix.IoctlSetPointerInt(fd, unix.TUNSETVNETLE, 1); err != nil {
+			return err
+		}
+		offload := 0
+		if cfg.Offload {
+			offload = tunFCsum | tunFTSO4 | tunFTSO6 | tunFTSOECN
+		}
+		if err := unix.IoctlSetInt(fd, unix.TUNSETOFFLOAD, offload); err != nil {
+			return err
+		}
+	}
+	if cfg.Owner != -1 {
+		if err := unix.IoctlSetInt(fd, unix.TUNSETOWNER, cfg.Owner); err != nil {
+			return err
+		}
+	}
+	if cfg.Group != -1 {
+		if err := unix.IoctlSetInt(fd, unix.TUNSETGROUP, cfg.Group); err != nil {
+			return err
+		}
+	}
+	if cfg.Persist {
+		return unix.IoctlSetInt(fd, unix.TUNSETPERSIST, 1)
+	}
+	return nil
+}
+
+// Queues returns the queues of the device, one unless Config.Queues asked for more.
+func (d *Device) Queues() []*Queue {
+	return d.queues
+}
+
+// Read reads one packet from the first queue, see Queue.Read.
+func (d *Device) Read(p []byte) (int, error) {
+	return d.queues[0].Read(p)
+}
+
+// Write writes one packet to the first queue, see Queue.Write.
+func (d *Device) Write(p []byte) (int, error) {
+	return d.queues[0].Write(p)
+}
+
+// ReadPacket reads one packet and its offload metadata from the first queue.
+func (d *Device) ReadPacket(buf []byte) (int, VnetHdr, error) {
+	return d.queues[0].ReadPacket(buf)
+}
+
+// WritePacket writes one packet with its offload metadata to the first queue.
+func (d *Device) WritePacket(hdr VnetHdr, pkt []byte) (int, error) {
+	return d.queues[0].WritePacket(hdr, pkt)
+}
+
+// SetPersist keeps the device after Close, or lets it go with the last
+// open file when persist is false.
+func (d *Device) SetPersist(persist bool) error {
+	v := 0
+	if persist {
+		v = 1
+	}
+	rc, err := d.queues[0].file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	cerr := rc.Control(func(fd uintptr) {
+		err = unix.IoctlSetInt(int(fd), unix.TUNSETPERSIST, v)
+	})
+	if cerr != nil {
+		err = cerr
+	}
+	return ifaces.NewConfigError("set persist", d.Name, err)
+}
+
+// AddRoute points prefix at the device, which has to be up.
+func (d *Device) AddRoute(prefix netip.Prefix) error {
+	return routes.Add(routes.NetRoute{Destination: prefix.String(), NetIf: d.Name})
+}
+
+// DeleteRoute removes a route added with AddRoute.
+func (d *Device) DeleteRoute(prefix netip.Prefix) error {
+	return routes.Delete(routes.NetRoute{Destination: prefix.String(), NetIf: d.Name})
+}
+
+// Close closes every queue, a device that is not persistent disappears.
+func (d *Device) Close() error {
+	var err error
+	for _, q := range d.queues {
+		if cerr := q.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Read reads one packet, with the raw vnet header in front when the device
+// was created with VnetHdr.
+func (q *Queue) Read(p []byte) (int, error) {
+	return q.file.Read(p)
+}
+
+// Write writes one packet, which starts with a vnet header when the device
+// was created with VnetHdr.
+func (q *Queue) Write(p []byte) (int, error) {
+	return q.file.Write(p)
+}
+
+// ReadPacket reads one packet into buf and splits off its vnet header,
+// the header is zero without VnetHdr.
+func (q *Queue) ReadPacket(buf []byte) (int, VnetHdr, error) {
+	n, err := q.file.Read(buf)
+	if err != nil || !q.vnetHdr {
+		return n, VnetHdr{}, err
+	}
+	if n < VnetHdrLen {
+		return 0, VnetHdr{}, ErrShortPacket
+	}
+	hdr := decodeVnetHdr(buf)
+	return copy(buf, buf[VnetHdrLen:n]), hdr, nil
+}
+
+// WritePacket writes pkt behind the encoded hdr, hdr is ignored without
+// VnetHdr. It returns the length of pkt written.
+func (q *Queue) WritePacket(hdr VnetHdr, pkt []byte) (int, error) {
+	if !q.vnetHdr {
+		return q.file.Write(pkt)
+	}
+	q.wmu.Lock()
+	defer q.wmu.Unlock()
+	if cap(q.wbuf) < VnetHdrLen+len(pkt) {
+		q.wbuf = make([]byte, VnetHdrLen+len(pkt))
+	}
+	b := q.wbuf[:VnetHdrLen+len(pkt)]
+	hdr.encode(b)
+	copy(b[VnetHdrLen:], pkt)
+	n, err := q.file.Write(b)
+	if n -= VnetHdrLen; n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// Close closes the file of the queue, pending reads return os.ErrClosed.
+func (q *Queue) Close() error {
+	return q.file.Close()
+}
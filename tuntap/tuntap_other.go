@@ -0,0 +1,77 @@
+//go:build !linux
+
+package tuntap
+
+import (
+	"net/netip"
+)
+
+// Device is an open TUN or TAP device, only supported on Linux.
+type Device struct {
+	Name string
+	Type string
+}
+
+// Queue is one file of a device.
+type Queue struct{}
+
+// Create opens a new device.
+func Create(cfg Config) (*Device, error) {
+	return nil, ErrUnsupported
+}
+
+func (d *Device) Queues() []*Queue {
+	return nil
+}
+
+func (d *Device) Read(p []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (d *Device) Write(p []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (d *Device) ReadPacket(buf []byte) (int, VnetHdr, error) {
+	return 0, VnetHdr{}, ErrUnsupported
+}
+
+func (d *Device) WritePacket(hdr VnetHdr, pkt []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (d *Device) SetPersist(persist bool) error {
+	return ErrUnsupported
+}
+
+func (d *Device) AddRoute(prefix netip.Prefix) error {
+	return ErrUnsupported
+}
+
+func (d *Device) DeleteRoute(prefix netip.Prefix) error {
+	return ErrUnsupported
+}
+
+func (d *Device) Close() error {
+	return ErrUnsupported
+}
+
+func (q *Queue) Read(p []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (q *Queue) Write(p []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (q *Queue) ReadPacket(buf []byte) (int, VnetHdr, error) {
+	return 0, VnetHdr{}, ErrUnsupported
+}
+
+func (q *Queue) WritePacket(hdr VnetHdr, pkt []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (q *Queue) Close() error {
+	return ErrUnsupported
+}
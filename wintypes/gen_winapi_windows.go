@@ -41,6 +41,7 @@ var (
 	moddnsapi   = windows.NewLazySystemDLL("dnsapi.dll")
 	modiphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
 
+	procDnsFlushResolverCache    = moddnsapi.NewProc("DnsFlushResolverCache")
 	procDnsQueryConfig           = moddnsapi.NewProc("DnsQueryConfig")
 	procCreateIpForwardEntry2    = modiphlpapi.NewProc("CreateIpForwardEntry2")
 	procDeleteIpForwardEntry2    = modiphlpapi.NewProc("DeleteIpForwardEntry2")
@@ -55,6 +56,12 @@ var (
 	procSetIpForwardEntry2       = modiphlpapi.NewProc("SetIpForwardEntry2")
 )
 
+func dnsFlushResolverCache() (ok bool) {
+	r0, _, _ := syscall.Syscall(procDnsFlushResolverCache.Addr(), 0, 0, 0, 0)
+	ok = r0 != 0
+	return
+}
+
 func dnsQueryConfig(config DnsConfigType, flag uint32, wsAdapterName uintptr, reserved uintptr, buffer *byte, buflen *uint32) (ret error) {
 	r0, _, _ := syscall.Syscall6(procDnsQueryConfig.Addr(), 6, uintptr(config), uintptr(flag), uintptr(wsAdapterName), uintptr(reserved), uintptr(unsafe.Pointer(buffer)), uintptr(unsafe.Pointer(buflen)))
 	if r0 != 0 {
@@ -3,6 +3,7 @@
 package wintypes
 
 import (
+	"errors"
 	"github.com/kmahyyg/go-network-compo/utils"
 	"golang.org/x/sys/windows"
 	"net"
@@ -24,6 +25,7 @@ import (
 //sys	deleteIPForwardEntry2(route *MibIPforwardRow2) (ret error) = iphlpapi.DeleteIpForwardEntry2
 //sys	getIPForwardTable2(family AddressFamily, table **mibIPforwardTable2) (ret error) = iphlpapi.GetIpForwardTable2
 //sys   dnsQueryConfig(config DnsConfigType, flag uint32, wsAdapterName uintptr, reserved uintptr, buffer *byte, buflen *uint32) (ret error) = dnsapi.DnsQueryConfig
+//sys   dnsFlushResolverCache() (ok bool) = dnsapi.DnsFlushResolverCache
 
 // GetIPForwardTable2 function retrieves the IP route entries on the local computer.
 // https://docs.microsoft.com/en-us/windows/desktop/api/netioapi/nf-netioapi-getipforwardtable2
@@ -62,6 +64,15 @@ func GetInterfaceDnsSettings(iface *windows.GUID, settings *DnsInterfaceSettings
 	return nil
 }
 
+// DnsFlushResolverCache empties the cache of the DNS Client service, like `ipconfig /flushdns`.
+// The function is undocumented but exported by dnsapi.dll since Windows 2000.
+func DnsFlushResolverCache() error {
+	if !dnsFlushResolverCache() {
+		return errors.New("DnsFlushResolverCache failed")
+	}
+	return nil
+}
+
 // DnsQueryConfig enables application programmers to query for the configuration of the local
 // computer or a specific adapter.
 // https://docs.microsoft.com/en-us/windows/win32/api/windns/nf-windns-dnsqueryconfig